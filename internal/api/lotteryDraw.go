@@ -70,18 +70,24 @@ func (lh *LotteryDrawHandler) ListLotteryDraws(ctx *gin.Context, req req.ListLot
 // CreateLotteryDraw 创建新的抽奖活动
 func (lh *LotteryDrawHandler) CreateLotteryDraw(ctx *gin.Context, req req.CreateLotteryDrawReq) (Result, error) {
 	input := domain.LotteryDraw{
-		Name:        req.Name,
-		Description: req.Description,
-		StartTime:   req.StartTime,
-		EndTime:     req.EndTime,
+		Name:           req.Name,
+		Description:    req.Description,
+		ImageURL:       req.ImageURL,
+		StartTime:      req.StartTime,
+		EndTime:        req.EndTime,
+		EntryStartTime: req.EntryStartTime,
+		EntryEndTime:   req.EntryEndTime,
 	}
 
 	err := lh.svc.CreateLotteryDraw(ctx, domain.LotteryDraw{
-		Name:        input.Name,
-		Description: input.Description,
-		StartTime:   input.StartTime,
-		EndTime:     input.EndTime,
-		Status:      domain.LotteryStatusPending,
+		Name:           input.Name,
+		Description:    input.Description,
+		ImageURL:       input.ImageURL,
+		StartTime:      input.StartTime,
+		EndTime:        input.EndTime,
+		EntryStartTime: input.EntryStartTime,
+		EntryEndTime:   input.EntryEndTime,
+		Status:         domain.LotteryStatusPending,
 	})
 	if err != nil {
 		return Result{
@@ -158,6 +164,7 @@ func (lh *LotteryDrawHandler) CreateSecondKillEvent(ctx *gin.Context, req req.Cr
 	input := domain.SecondKillEvent{
 		Name:        req.Name,
 		Description: req.Description,
+		ImageURL:    req.ImageURL,
 		StartTime:   req.StartTime,
 		EndTime:     req.EndTime,
 	}
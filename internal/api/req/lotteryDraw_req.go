@@ -9,10 +9,13 @@ type ListLotteryDrawsReq struct {
 
 // CreateLotteryDrawReq 定义创建新的抽奖活动的请求参数
 type CreateLotteryDrawReq struct {
-	Name        string `json:"name"`        // 抽奖活动名称
-	Description string `json:"description"` // 抽奖活动描述
-	StartTime   int64  `json:"startTime"`   // 活动开始时间，必须晚于当前时间
-	EndTime     int64  `json:"endTime"`     // 活动结束时间，必须晚于开始时间
+	Name           string `json:"name"`                     // 抽奖活动名称
+	Description    string `json:"description"`              // 抽奖活动描述
+	ImageURL       string `json:"imageUrl"`                 // 抽奖活动图片地址，需为 http(s) URL
+	StartTime      int64  `json:"startTime"`                // 活动开始时间，必须晚于当前时间
+	EndTime        int64  `json:"endTime"`                  // 活动结束时间，必须晚于开始时间
+	EntryStartTime int64  `json:"entryStartTime,omitempty"` // 报名开始时间，不填时与活动开始时间相同
+	EntryEndTime   int64  `json:"entryEndTime,omitempty"`   // 报名结束时间，不填时与活动结束时间相同
 }
 
 // GetLotteryDrawReq 定义获取指定ID抽奖活动的请求参数
@@ -36,6 +39,7 @@ type GetAllSecondKillEventsReq struct {
 type CreateSecondKillEventReq struct {
 	Name        string `json:"name"`        // 秒杀活动名称
 	Description string `json:"description"` // 秒杀活动描述
+	ImageURL    string `json:"imageUrl"`    // 秒杀活动图片地址，需为 http(s) URL
 	StartTime   int64  `json:"startTime"`   // 活动开始时间，必须晚于当前时间
 	EndTime     int64  `json:"endTime"`     // 活动结束时间，必须晚于开始时间
 }
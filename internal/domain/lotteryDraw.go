@@ -8,12 +8,42 @@ const (
 	LotteryStatusPending   string = "pending"   // 待开始
 	LotteryStatusActive    string = "active"    // 进行中
 	LotteryStatusCompleted string = "completed" // 已完成
+	LotteryStatusCancelled string = "cancelled" // 已取消
+	LotteryStatusPaused    string = "paused"    // 已暂停
 )
 
+// ScheduledLotteryStatus 按状态调度的时间规则计算抽奖活动在 now 时刻应处的状态，供 DAO 的 RefreshStatusesForIDs 使用：
+// 待开始且已到开始时间的活动进入进行中，进行中且已到结束时间的活动进入已完成；开始和结束时间均已过的待开始活动直接进入已完成
+// 其他状态（已取消、已暂停、已完成）不随时间变化，原样返回
+func ScheduledLotteryStatus(status string, startTime, endTime, now int64) string {
+	switch {
+	case status == LotteryStatusPending && startTime <= now && endTime <= now:
+		return LotteryStatusCompleted
+	case status == LotteryStatusPending && startTime <= now:
+		return LotteryStatusActive
+	case status == LotteryStatusActive && endTime <= now:
+		return LotteryStatusCompleted
+	default:
+		return status
+	}
+}
+
 const (
 	SecondKillStatusPending   string = "pending"   // 待开始
 	SecondKillStatusActive    string = "active"    // 进行中
 	SecondKillStatusCompleted string = "completed" // 已完成
+	SecondKillStatusPaused    string = "paused"    // 已暂停
+)
+
+const (
+	ReservationStatusReserved  string = "reserved"  // 已预留
+	ReservationStatusConfirmed string = "confirmed" // 已确认
+	ReservationStatusExpired   string = "expired"   // 已过期
+)
+
+const (
+	ActivityTypeLottery    string = "lottery"    // 抽奖活动
+	ActivityTypeSecondKill string = "secondkill" // 秒杀活动
 )
 
 // Participant 表示参与者的记录，适用于抽奖和秒杀活动
@@ -22,19 +52,26 @@ type Participant struct {
 	LotteryID      *int   // 关联的活动ID（可以是抽奖或秒杀活动）
 	SecondKillID   *int
 	ActivityType   string
-	UserID         int64 // 参与者的用户ID
-	ParticipatedAt int64 // UNIX 时间戳，表示参与时间
+	UserID         int64  // 参与者的用户ID
+	ParticipatedAt int64  // UNIX 时间戳，表示参与时间
+	ExternalRef    string // 外部系统的参与编号，可为空
 }
 
 // LotteryDraw 表示一个抽奖活动
 type LotteryDraw struct {
-	ID           int           // 抽奖活动的唯一标识符
-	Name         string        // 抽奖活动名称
-	Description  string        // 抽奖活动描述
-	StartTime    int64         // UNIX 时间戳，表示活动开始时间
-	EndTime      int64         // UNIX 时间戳，表示活动结束时间
-	Status       string        // 抽奖活动状态
-	Participants []Participant // 参与者列表
+	ID             int           // 抽奖活动的唯一标识符
+	Name           string        // 抽奖活动名称
+	Description    string        // 抽奖活动描述
+	ImageURL       string        // 抽奖活动图片地址
+	StartTime      int64         // UNIX 时间戳，表示活动开始时间
+	EndTime        int64         // UNIX 时间戳，表示活动结束时间
+	EntryStartTime int64         // UNIX 时间戳，表示报名开始时间，0 表示与 StartTime 相同
+	EntryEndTime   int64         // UNIX 时间戳，表示报名结束时间，0 表示与 EndTime 相同
+	SeedHash       string        // 开奖种子的 SHA-256 摘要，开奖前公开
+	Seed           string        // 开奖种子，仅在开奖完成后公开
+	Status         string        // 抽奖活动状态
+	Category       string        // 抽奖活动分类，为空表示未分类
+	Participants   []Participant // 参与者列表
 }
 
 // SecondKillEvent 表示一个秒杀活动
@@ -42,8 +79,10 @@ type SecondKillEvent struct {
 	ID           int           // 秒杀活动的唯一标识符
 	Name         string        // 秒杀活动名称
 	Description  string        // 秒杀活动描述
+	ImageURL     string        // 秒杀活动图片地址
 	StartTime    int64         // UNIX 时间戳，表示活动开始时间
 	EndTime      int64         // UNIX 时间戳，表示活动结束时间
 	Status       string        // 秒杀活动状态
+	Category     string        // 秒杀活动分类，为空表示未分类
 	Participants []Participant // 参与者列表
 }
@@ -6,7 +6,16 @@ import (
 
 // InitTables 初始化数据库表
 func InitTables(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := migrateParticipantExternalRef(db); err != nil {
+		return err
+	}
+
+	// drawn_at 列由 AutoMigrate 添加，需在迁移前判断是否为首次添加，只有首次添加时才需要补充历史数据
+	backfillDrawnAt := db.Migrator().HasTable(&LotteryDraw{}) && !db.Migrator().HasColumn(&LotteryDraw{}, "DrawnAt")
+
+	// 抽奖和秒杀活动的 category 列及 (category, status) 组合索引（idx_category_status、idx_second_kill_category_status）
+	// 由 AutoMigrate 添加，已有活动的分类默认为空字符串
+	if err := db.AutoMigrate(
 		&User{},
 		&Profile{},
 		&Post{},
@@ -27,5 +36,54 @@ func InitTables(db *gorm.DB) error {
 		&LotteryDraw{},
 		&SecondKillEvent{},
 		&Participant{},
-	)
+		&Prize{},
+		&DrawAudit{},
+		&SecondKillReservation{},
+	); err != nil {
+		return err
+	}
+
+	if backfillDrawnAt {
+		return backfillLotteryDrawnAt(db)
+	}
+
+	return nil
+}
+
+// migrateParticipantExternalRef 在外部参与编号改为可空唯一索引前清理历史数据：
+// 空字符串置为 NULL，避免同一活动下多条无编号记录触发唯一索引冲突，并删除被唯一索引取代的普通索引
+// 唯一索引已存在时说明迁移已完成，直接跳过，避免每次启动都扫描参与记录表
+func migrateParticipantExternalRef(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Participant{}) {
+		return nil
+	}
+
+	if db.Migrator().HasIndex(&Participant{}, "uniq_lottery_external_ref") &&
+		db.Migrator().HasIndex(&Participant{}, "uniq_second_kill_external_ref") {
+		return nil
+	}
+
+	if err := db.Model(&Participant{}).
+		Where("external_ref = ?", "").
+		Update("external_ref", gorm.Expr("NULL")).Error; err != nil {
+		return err
+	}
+
+	for _, index := range []string{"idx_lottery_external_ref", "idx_second_kill_external_ref"} {
+		if db.Migrator().HasIndex(&Participant{}, index) {
+			if err := db.Migrator().DropIndex(&Participant{}, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// backfillLotteryDrawnAt 为新增 drawn_at 列之前已开奖的抽奖活动补充开奖时间，使其开奖种子仍可公开和校验
+// 以存在中奖者作为已开奖的依据，开奖时间取活动的最后更新时间；仅在 drawn_at 列首次添加时由 InitTables 调用
+func backfillLotteryDrawnAt(db *gorm.DB) error {
+	return db.Model(&LotteryDraw{}).
+		Where("drawn_at = ? AND EXISTS (SELECT 1 FROM participants p WHERE p.lottery_id = lottery_draws.id AND p.is_winner = ?)", 0, true).
+		Update("drawn_at", gorm.Expr("updated_at")).Error
 }
@@ -2,10 +2,111 @@ package dao
 
 import (
 	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/GoSimplicity/LinkMe/internal/domain"
+	"github.com/google/uuid"
+	"github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrLotteryDrawNotActive 表示抽奖活动不处于进行中状态
+	ErrLotteryDrawNotActive = errors.New("抽奖活动不处于进行中状态")
+	// ErrInvalidEndTime 表示新的结束时间未晚于当前结束时间
+	ErrInvalidEndTime = errors.New("新的结束时间必须晚于当前结束时间")
+	// ErrDuplicateExternalRef 表示同一活动下外部参与编号重复
+	ErrDuplicateExternalRef = errors.New("同一活动下外部参与编号已存在")
+	// ErrActivityNotFound 表示抽奖和秒杀活动中均不存在该ID
+	ErrActivityNotFound = errors.New("活动不存在")
+	// ErrAmbiguousActivityType 表示该ID同时存在于抽奖和秒杀活动中
+	ErrAmbiguousActivityType = errors.New("活动ID同时存在于抽奖和秒杀活动中")
+	// ErrInvalidWinProbability 表示中奖概率不在 [0, 1] 范围内
+	ErrInvalidWinProbability = errors.New("中奖概率必须在0到1之间")
+	// ErrInvalidTimeWindow 表示活动的开始时间不早于结束时间
+	ErrInvalidTimeWindow = errors.New("无效的活动时间范围")
+	// ErrDuplicateLotteryDrawName 表示抽奖活动名称重复
+	ErrDuplicateLotteryDrawName = errors.New("同名的抽奖活动已存在")
+	// ErrInvalidMetaField 表示元数据字段不在允许的范围内
+	ErrInvalidMetaField = errors.New("不支持的元数据字段")
+	// ErrNoUpcomingActivity 表示没有用户可参与的即将开始的活动
+	ErrNoUpcomingActivity = errors.New("没有即将开始的可参与活动")
+	// ErrBelowMinParticipants 表示参与人数未达到开奖所需的最低人数
+	ErrBelowMinParticipants = errors.New("参与人数未达到最低开奖人数")
+	// ErrInvalidWinnerCount 表示中奖人数不合法
+	ErrInvalidWinnerCount = errors.New("中奖人数必须大于0")
+	// ErrInvalidPercentile 表示百分位不在 (0, 1] 范围内
+	ErrInvalidPercentile = errors.New("百分位必须在0到1之间且大于0")
+	// ErrClaimNotRefundable 表示参与记录不是有效的秒杀抢购记录，或已退款
+	ErrClaimNotRefundable = errors.New("参与记录不是可退款的秒杀抢购记录")
+	// ErrMergeSameActivity 表示合并活动时源活动与目标活动相同
+	ErrMergeSameActivity = errors.New("不能将活动合并到自身")
+	// ErrEmptyIDs 表示批量操作的活动ID列表为空
+	ErrEmptyIDs = errors.New("活动ID列表不能为空")
+	// ErrNoParticipantCap 表示抽奖活动没有设置参与人数上限
+	ErrNoParticipantCap = errors.New("抽奖活动未设置参与人数上限")
+	// ErrNoParticipants 表示抽奖活动没有有效参与者，无法开奖
+	ErrNoParticipants = errors.New("抽奖活动没有有效参与者")
+	// ErrAlreadyDrawn 表示抽奖活动已开奖
+	ErrAlreadyDrawn = errors.New("抽奖活动已开奖")
+	// ErrSoldOut 表示秒杀活动库存不足或活动不在进行中
+	ErrSoldOut = errors.New("秒杀活动库存不足或不在进行中")
+	// ErrReservationUnavailable 表示预留记录不存在、已过期或已被处理
+	ErrReservationUnavailable = errors.New("预留记录不存在、已过期或已被处理")
+	// ErrInvalidStatus 表示状态参数不是已知的活动状态
+	ErrInvalidStatus = errors.New("无效的活动状态")
+	// ErrParticipantNotWinner 表示被替换的参与者不是该抽奖活动的中奖者
+	ErrParticipantNotWinner = errors.New("被替换的参与者不是该活动的中奖者")
+	// ErrInvalidReplacementWinner 表示替补参与者不是该抽奖活动中未中奖的有效参与者
+	ErrInvalidReplacementWinner = errors.New("替补参与者不是该活动中未中奖的有效参与者")
+	// ErrEventEnded 表示秒杀活动已结束且超出宽限期
+	ErrEventEnded = errors.New("秒杀活动已结束")
+	// ErrInvalidPrizeRemaining 表示奖品剩余数量小于 0 或超过总数量
+	ErrInvalidPrizeRemaining = errors.New("奖品剩余数量必须在0到总数量之间")
+	// ErrDrawNotVerifiable 表示抽奖活动尚未开奖或缺少开奖种子，无法校验公平性
+	ErrDrawNotVerifiable = errors.New("抽奖活动尚未开奖或缺少开奖种子")
+	// ErrEntryWindowClosed 表示当前不在抽奖活动的报名时间窗口内
+	ErrEntryWindowClosed = errors.New("当前不在活动报名时间内")
+	// ErrInvalidImageURL 表示活动图片地址不是合法的 http(s) URL
+	ErrInvalidImageURL = errors.New("活动图片地址必须是合法的 http(s) URL")
+	// ErrParticipationLocked 表示活动的参与已被锁定（如合规冻结），活动仍可见但不接受参与
+	ErrParticipationLocked = errors.New("活动参与已被锁定")
+	// ErrActivityPaused 表示活动已暂停，暂不接受参与
+	ErrActivityPaused = errors.New("活动已暂停")
+	// ErrInvalidStatusTransition 表示活动当前状态不允许该状态变更
+	ErrInvalidStatusTransition = errors.New("活动当前状态不允许该操作")
+	// ErrEventNotActive 表示秒杀活动不在进行中
+	ErrEventNotActive = errors.New("秒杀活动不在进行中")
+	// ErrWithdrawalClosed 表示抽奖活动已结束或已开奖，不再允许退出
+	ErrWithdrawalClosed = errors.New("抽奖活动已结束或已开奖，不能退出")
+	// ErrAlreadyClaimed 表示用户已抢购过该秒杀活动
+	ErrAlreadyClaimed = errors.New("用户已抢购该秒杀活动")
+	// ErrUserLevelTooLow 表示用户等级低于活动要求的最低等级
+	ErrUserLevelTooLow = errors.New("用户等级低于活动要求")
+	// ErrActivityFull 表示抽奖活动的参与人数已达上限
+	ErrActivityFull = errors.New("抽奖活动参与人数已达上限")
+	// ErrUserEntryLimitReached 表示用户在抽奖活动中的参与次数已达上限
+	ErrUserEntryLimitReached = errors.New("用户参与次数已达上限")
+	// ErrEntryCooldown 表示用户距上次参与的时间不足活动要求的间隔
+	ErrEntryCooldown = errors.New("参与过于频繁，请稍后再试")
 )
 
 type LotteryDrawDAO interface {
@@ -13,6 +114,7 @@ type LotteryDrawDAO interface {
 	GetLotteryDrawByID(ctx context.Context, id int) (LotteryDraw, error)
 	ListLotteryDraws(ctx context.Context, status string, pagination domain.Pagination) ([]LotteryDraw, error)
 	ExistsLotteryDrawByName(ctx context.Context, name string) (bool, error)
+	ExtendLotteryDraw(ctx context.Context, id int, newEndTime int64) error
 	HasUserParticipatedInLottery(ctx context.Context, id int, userID int64) (bool, error)
 
 	CreateSecondKillEvent(ctx context.Context, model SecondKillEvent) error
@@ -22,6 +124,7 @@ type LotteryDrawDAO interface {
 	HasUserParticipatedInSecondKill(ctx context.Context, id int, userID int64) (bool, error)
 
 	AddParticipant(ctx context.Context, model Participant) error
+	AddParticipants(ctx context.Context, models []Participant) (BatchResult, error)
 
 	ListPendingLotteryDraws(ctx context.Context, currentTime int64) ([]LotteryDraw, error)
 	UpdateLotteryDrawStatus(ctx context.Context, id int, status string) error
@@ -29,80 +132,658 @@ type LotteryDrawDAO interface {
 	UpdateSecondKillEventStatus(ctx context.Context, id int, status string) error
 	ListActiveLotteryDraws(ctx context.Context, currentTime int64) ([]LotteryDraw, error)
 	ListActiveSecondKillEvents(ctx context.Context, currentTime int64) ([]SecondKillEvent, error)
+
+	GlobalParticipationByDay(ctx context.Context, fromTs, toTs int64) ([]DayCount, error)
+	ListStuckActiveDraws(ctx context.Context, now int64) ([]LotteryDraw, error)
+	ListStuckActiveSecondKillEvents(ctx context.Context, now int64) ([]SecondKillEvent, error)
+	ResolveActivityType(ctx context.Context, activityID int) (string, error)
+
+	WithdrawParticipation(ctx context.Context, participantID string) error
+	CountActiveParticipants(ctx context.Context, activityID int) (int64, error)
+
+	ListDrawAudits(ctx context.Context, activityID int, pagination domain.Pagination) ([]DrawAudit, error)
+	InstantDraw(ctx context.Context, activityID int, userID int64, winProbability float64) (bool, Participant, error)
+	BulkCreateLotteryDraws(ctx context.Context, models []LotteryDraw) (BatchResult, error)
+	BulkCreateLotteryDrawsBestEffort(ctx context.Context, models []LotteryDraw) (BatchResult, error)
+
+	ListUserWins(ctx context.Context, userID int64, pagination domain.Pagination) ([]WinRecord, error)
+	CloneLotteryDraw(ctx context.Context, sourceID int, newName string, newStart, newEnd int64) (int, error)
+	GroupParticipantsByMetaField(ctx context.Context, activityID int, field string) (map[string][]Participant, error)
+	MarkWinners(ctx context.Context, activityID int, userIDs []int64) (BatchResult, error)
+
+	GetNextEligibleActivity(ctx context.Context, userID int64, userLevel int, now int64) (ActivitySummary, error)
+	CountSecondKillOutcomes(ctx context.Context, fromTs, toTs int64) (int64, int64, error)
+
+	DrawWinners(ctx context.Context, activityID int, winnerCount int) ([]Participant, error)
+	ListNonWinners(ctx context.Context, activityID int, pagination domain.Pagination) ([]Participant, error)
+	ListWinners(ctx context.Context, activityID int, pagination domain.Pagination) ([]Participant, error)
+
+	ReserveSecondKill(ctx context.Context, eventID int, userID int64, expiresAt int64) (SecondKillReservation, error)
+	ConfirmSecondKillReservation(ctx context.Context, reservationID string, now int64) (Participant, error)
+	ExpireStaleReservations(ctx context.Context, now int64) (int64, error)
+	GetLotteryDrawForUser(ctx context.Context, id int, userID int64) (LotteryDraw, bool, error)
+	GetSecondKillFunnel(ctx context.Context, eventID int, views int64) (FunnelStats, error)
+	IterateParticipants(ctx context.Context, activityID int, batchSize int, fn func([]Participant) error) error
+	ParticipationByHourOfDay(ctx context.Context, activityID int) ([24]int64, error)
+
+	PauseActivity(ctx context.Context, id int) error
+	ResumeActivity(ctx context.Context, id int) error
+	ClaimSecondKill(ctx context.Context, eventID int, userID int64, now int64) (Participant, error)
+	GetLiveParticipantCount(ctx context.Context, activityID int) (int64, error)
+	ReconcileLiveParticipantCounts(ctx context.Context, now int64) error
+	ListJoinableActivitiesForUser(ctx context.Context, userID int64, userLevel int, now int64, limit int) ([]ActivitySummary, error)
+	GetTotalAwardedValue(ctx context.Context, activityID int) (int64, error)
+	ListLotteryDrawsModifiedSince(ctx context.Context, since int64, pagination domain.Pagination) ([]LotteryDraw, error)
+	SwapWinner(ctx context.Context, activityID int, oldParticipantID, newParticipantID string) error
+	TopParticipantsByEntries(ctx context.Context, activityID int, topN int) ([]UserEntryCount, error)
+	GetLotteryDrawsByNames(ctx context.Context, names []string) (map[string]LotteryDraw, error)
+	GetPrizeWinnerCounts(ctx context.Context, activityID int) (map[int]int64, error)
+	FilterUserJoinedActivities(ctx context.Context, userID int64, activityIDs []int) ([]int, error)
+	ListTrendingActivities(ctx context.Context, sinceTs int64, limit int, now int64) ([]ActivitySummary, error)
+	GetParticipantRank(ctx context.Context, activityID int, participantID string) (int64, error)
+	CountDistinctParticipatingUsers(ctx context.Context, fromTs, toTs int64) (int64, error)
+	SetPrizeRemaining(ctx context.Context, prizeID int, remaining int) error
+	ListActivitiesNeedingDraw(ctx context.Context, now int64, pagination domain.Pagination) ([]LotteryDrawSummary, error)
+	VerifyDrawFairness(ctx context.Context, activityID int) (bool, error)
+	ExportFairnessProof(ctx context.Context, activityID int, w io.Writer) error
+	ListUserSecondKillClaims(ctx context.Context, userID int64, pagination domain.Pagination) ([]Participant, error)
+	GetLotteryDrawWithParticipantPage(ctx context.Context, id int, pagination domain.Pagination) (LotteryDraw, error)
+	SetParticipationLock(ctx context.Context, id int, locked bool) error
+	ListParticipationLockedActivities(ctx context.Context) ([]ActivitySummary, error)
+	FilterJoinedForFeed(ctx context.Context, userID int64, activityIDs []int) (map[int]bool, error)
+	ValidateSecondKillEvent(ctx context.Context, eventID int, now int64) ([]string, error)
+	GetLotteryDrawsByIDsOrdered(ctx context.Context, ids []int) ([]LotteryDraw, error)
+	CountLateJoiners(ctx context.Context, activityID int, windowSeconds int) (int64, error)
+	IterateLotteryDraws(ctx context.Context, status string, batchSize int, fn func(LotteryDraw) error) error
+	MergeActivities(ctx context.Context, sourceID, targetID int) (int64, error)
+	GetParticipationPercentiles(ctx context.Context, activityID int, percentiles []float64) (map[float64]int64, error)
+	RefundSecondKillClaim(ctx context.Context, participantID string, refund func(userID int64) error) error
+	ListCancelledForLowParticipation(ctx context.Context, pagination domain.Pagination) ([]LotteryDraw, error)
+	GetAverageEntriesPerUser(ctx context.Context, activityID int) (float64, error)
+	FlushSecondKillCacheToDB(ctx context.Context, eventID int) (int, error)
+	ClaimSecondKillCached(ctx context.Context, eventID int, userID int64, now int64) error
+	CanUserEnter(ctx context.Context, activityID int, userID int64, userLevel int, now int64) (bool, string, error)
+	ListWinnersForActivities(ctx context.Context, activityIDs []int, pagination domain.Pagination) ([]WinnerRecord, error)
+	GetUserLastParticipation(ctx context.Context, userID int64) (int64, error)
+	FindOrphanParticipants(ctx context.Context) ([]Participant, error)
+	GetSecondKillBurnRate(ctx context.Context, eventID int, windowSeconds int, now int64) (soldPerSecond float64, estimatedSelloutTs int64, err error)
+	AnonymizeUserParticipations(ctx context.Context, userID int64) (int64, error)
+	GetTimeToFill(ctx context.Context, activityID int) (seconds int64, filled bool, err error)
+	RefreshStatusesForIDs(ctx context.Context, ids []int, now int64) (int64, error)
+	FindOversoldEvents(ctx context.Context) ([]SecondKillEvent, error)
+	GetUserWinRate(ctx context.Context, userID int64) (wins int64, entries int64, err error)
+	RemoveUsersFromActivities(ctx context.Context, activityIDs []int, userIDs []int64) (int64, error)
+	SnapshotActivity(ctx context.Context, activityID int) (ActivitySnapshot, error)
 }
 
 type lotteryDrawDAO struct {
-	db *gorm.DB
-	l  *zap.Logger
+	db          *gorm.DB
+	l           *zap.Logger
+	logNotFound bool
+	// cancelBelowMin 参与人数不足时是否自动取消抽奖活动
+	cancelBelowMin bool
+	// redis 用于维护实时参与人数计数器，为空时直接查询数据库
+	redis redis.Cmdable
+	// pool 连接池配置，为空时不修改 db 的连接池设置
+	pool *PoolConfig
+	// claimIsolation 秒杀抢购事务的隔离级别，默认使用数据库默认级别并依赖行锁
+	claimIsolation sql.IsolationLevel
+	// maxConcurrentDraws 同时执行的开奖数量上限，0 表示不限制
+	maxConcurrentDraws int
+	// drawSem 开奖信号量，容量为 maxConcurrentDraws，为空时不限制并发
+	drawSem chan struct{}
+	// nameCache 抽奖活动名称是否存在的本地短期缓存，为空时不缓存
+	nameCache *cache.Cache
+	// userLevel 查询用户等级，为空时所有用户按等级 0 处理
+	userLevel UserLevelResolver
+}
+
+// PoolConfig 数据库连接池配置，字段为零值时保持 sql.DB 的原有设置
+type PoolConfig struct {
+	MaxOpenConns    int           // 最大打开连接数
+	MaxIdleConns    int           // 最大空闲连接数
+	ConnMaxLifetime time.Duration // 连接最大存活时间，应小于 MySQL 的 wait_timeout
+}
+
+// DefaultPoolConfig 推荐的连接池配置：
+// 最大连接数需低于 MySQL max_connections 除以实例数，空闲连接保留一部分以应对突发流量，
+// 连接存活时间小于 MySQL 默认 wait_timeout（8 小时），避免使用被服务端关闭的连接
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    100,
+	MaxIdleConns:    20,
+	ConnMaxLifetime: time.Hour,
+}
+
+// LotteryDrawDAOOption 抽奖 DAO 的可选配置
+type LotteryDrawDAOOption func(*lotteryDrawDAO)
+
+// WithLogNotFound 设置记录不存在时是否输出 warn 日志，默认输出
+// 关闭后仍会返回错误，仅用于抑制被随机 ID 探测时产生的大量日志
+func WithLogNotFound(enabled bool) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		l.logNotFound = enabled
+	}
+}
+
+// WithCancelBelowMinParticipants 设置开奖时参与人数不足是否自动将活动置为已取消，默认不取消
+func WithCancelBelowMinParticipants(enabled bool) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		l.cancelBelowMin = enabled
+	}
+}
+
+// WithRedis 设置用于实时参与人数计数的 Redis 客户端，不设置时计数直接查询数据库
+func WithRedis(client redis.Cmdable) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		l.redis = client
+	}
+}
+
+// WithPoolConfig 设置底层 sql.DB 的连接池参数，可传入 DefaultPoolConfig
+func WithPoolConfig(cfg PoolConfig) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		l.pool = &cfg
+	}
+}
+
+// WithClaimIsolationLevel 设置秒杀抢购事务的隔离级别，例如 sql.LevelSerializable
+// 默认不指定隔离级别，通过 SELECT ... FOR UPDATE 锁定活动行保证库存扣减的正确性；
+// 需确认所用数据库驱动支持该隔离级别，SQLite 仅支持默认级别和串行化
+func WithClaimIsolationLevel(level sql.IsolationLevel) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		l.claimIsolation = level
+	}
+}
+
+// WithMaxConcurrentDraws 设置同时执行 DrawWinners 的最大数量，超出时排队等待，默认不限制
+// 大量活动同时结束时，限制并发开奖可以避免大事务同时占用数据库连接和行锁
+func WithMaxConcurrentDraws(n int) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		l.maxConcurrentDraws = n
+	}
+}
+
+// WithNameExistsCache 为 ExistsLotteryDrawByName 启用本地短期缓存，ttl 建议为秒级，默认不缓存
+// 缓存仅作为快速路径的提示：其他实例创建的同名活动在 ttl 内可能仍被判断为不存在，不能替代数据库层面的唯一性保证
+func WithNameExistsCache(ttl time.Duration) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		if ttl > 0 {
+			l.nameCache = cache.New(ttl, 2*ttl)
+		}
+	}
+}
+
+// UserLevelResolver 查询用户当前的等级，用于校验活动的最低用户等级
+type UserLevelResolver func(ctx context.Context, userID int64) (int, error)
+
+// WithUserLevelResolver 设置用户等级的查询方式，参与类方法据此校验活动的最低用户等级
+// 未设置时所有用户按等级 0 处理，设置了最低等级的活动将拒绝所有参与
+func WithUserLevelResolver(resolve UserLevelResolver) LotteryDrawDAOOption {
+	return func(l *lotteryDrawDAO) {
+		l.userLevel = resolve
+	}
+}
+
+// resolveUserLevel 查询用户等级，活动未设置最低等级时无需查询，直接返回 0
+func resolveUserLevel(ctx context.Context, resolve UserLevelResolver, userID int64, minUserLevel int) (int, error) {
+	if minUserLevel <= 0 || resolve == nil {
+		return 0, nil
+	}
+
+	return resolve(ctx, userID)
 }
 
 // LotteryDraw 数据库中的抽奖活动模型
 type LotteryDraw struct {
-	ID           int           `gorm:"primaryKey;autoIncrement"`                                                         // 抽奖活动的唯一标识符
-	Name         string        `gorm:"column:name;not null"`                                                             // 抽奖活动名称
-	Description  string        `gorm:"column:description;type:text"`                                                     // 抽奖活动描述
-	StartTime    int64         `gorm:"column:start_time;not null"`                                                       // 活动开始时间（UNIX 时间戳）
-	EndTime      int64         `gorm:"column:end_time;not null"`                                                         // 活动结束时间（UNIX 时间戳）
-	Status       string        `gorm:"column:status;type:varchar(20)"`                                                   // 活动状态
-	CreatedAt    int64         `gorm:"column:created_at;autoCreateTime"`                                                 // 创建时间（UNIX 时间戳）
-	UpdatedAt    int64         `gorm:"column:updated_at;autoUpdateTime"`                                                 // 更新时间（UNIX 时间戳）
-	Participants []Participant `gorm:"foreignKey:LotteryID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"` // 参与者列表
+	ID                   int           `gorm:"primaryKey;autoIncrement"`                                                                                      // 抽奖活动的唯一标识符
+	Name                 string        `gorm:"column:name;not null"`                                                                                          // 抽奖活动名称
+	Description          string        `gorm:"column:description;type:text"`                                                                                  // 抽奖活动描述
+	ImageURL             string        `gorm:"column:image_url;type:varchar(512)"`                                                                            // 活动图片地址
+	StartTime            int64         `gorm:"column:start_time;not null;index:idx_lottery_status_start,priority:2"`                                          // 活动开始时间（UNIX 时间戳）
+	EndTime              int64         `gorm:"column:end_time;not null"`                                                                                      // 活动结束时间（UNIX 时间戳）
+	Status               string        `gorm:"column:status;type:varchar(20);index:idx_lottery_status_start,priority:1;index:idx_category_status,priority:2"` // 活动状态
+	Category             string        `gorm:"column:category;type:varchar(32);not null;default:'';index:idx_category_status,priority:1"`                     // 活动分类，为空表示未分类
+	MinUserLevel         int           `gorm:"column:min_user_level;not null;default:0"`                                                                      // 参与所需的最低用户等级，0 表示不限制
+	MinParticipants      int           `gorm:"column:min_participants;not null;default:0"`                                                                    // 开奖所需的最低参与人数，0 表示不限制
+	MaxParticipants      int           `gorm:"column:max_participants;not null;default:0"`                                                                    // 活动的参与人数上限，0 表示不设上限
+	MaxEntriesPerUser    int           `gorm:"column:max_entries_per_user;not null;default:0"`                                                                // 每个用户的参与次数上限，0 表示不限制
+	EntryCooldownSeconds int           `gorm:"column:entry_cooldown_seconds;not null;default:0"`                                                              // 同一用户两次参与之间的最小间隔秒数，0 表示不限制
+	EntryStartTime       int64         `gorm:"column:entry_start_time;not null;default:0"`                                                                    // 报名开始时间（UNIX 时间戳），0 表示与 StartTime 相同
+	EntryEndTime         int64         `gorm:"column:entry_end_time;not null;default:0"`                                                                      // 报名结束时间（UNIX 时间戳），0 表示与 EndTime 相同
+	ParticipationLocked  bool          `gorm:"column:participation_locked;not null;default:false"`                                                            // 是否锁定参与，独立于活动状态，用于合规冻结
+	CancelReason         string        `gorm:"column:cancel_reason;type:varchar(32);not null;default:''"`                                                     // 取消原因，未取消或手动取消时为空
+	SeedHash             string        `gorm:"column:seed_hash;type:char(64)"`                                                                                // 开奖种子的 SHA-256 摘要，开奖前公开
+	Seed                 string        `gorm:"column:seed;type:varchar(64)"`                                                                                  // 开奖种子，开奖后公开用于复现中奖结果
+	DrawnAt              int64         `gorm:"column:drawn_at;not null;default:0"`                                                                            // 开奖时间（UNIX 时间戳），0 表示尚未开奖
+	CreatedAt            int64         `gorm:"column:created_at;autoCreateTime"`                                                                              // 创建时间（UNIX 时间戳）
+	UpdatedAt            int64         `gorm:"column:updated_at;autoUpdateTime;index:idx_lottery_updated_at"`                                                 // 更新时间（UNIX 时间戳）
+	Participants         []Participant `gorm:"foreignKey:LotteryID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`                              // 参与者列表
+	Prizes               []Prize       `gorm:"foreignKey:LotteryID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`                              // 奖品列表
+	// ParticipantTotal 参与记录总数，不对应数据库列，仅由 GetLotteryDrawWithParticipantPage 填充
+	ParticipantTotal int64 `gorm:"-"`
+}
+
+// AfterFind 尚未开奖的抽奖活动不返回开奖种子，保证种子在开奖前不会经由任何查询泄露
+// 查询未选取 drawn_at 列时同样视为未开奖；需要读取种子的开奖流程通过 SkipHooks 会话查询
+func (d *LotteryDraw) AfterFind(tx *gorm.DB) error {
+	if d.DrawnAt == 0 {
+		d.Seed = ""
+	}
+	return nil
 }
 
 // SecondKillEvent 数据库中的秒杀活动模型
 type SecondKillEvent struct {
-	ID           int           `gorm:"primaryKey;autoIncrement"`                                                            // 秒杀活动的唯一标识符
-	Name         string        `gorm:"column:name;not null"`                                                                // 秒杀活动名称
-	Description  string        `gorm:"column:description;type:text"`                                                        // 秒杀活动描述
-	StartTime    int64         `gorm:"column:start_time;not null"`                                                          // 活动开始时间（UNIX 时间戳）
-	EndTime      int64         `gorm:"column:end_time;not null"`                                                            // 活动结束时间（UNIX 时间戳）
-	Status       string        `gorm:"column:status;type:varchar(20)"`                                                      // 活动状态
-	CreatedAt    int64         `gorm:"column:created_at;autoCreateTime"`                                                    // 创建时间（UNIX 时间戳）
-	UpdatedAt    int64         `gorm:"column:updated_at;autoUpdateTime"`                                                    // 更新时间（UNIX 时间戳）
-	Participants []Participant `gorm:"foreignKey:SecondKillID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"` // 参与者列表
+	ID                  int           `gorm:"primaryKey;autoIncrement"`                                                                                                      // 秒杀活动的唯一标识符
+	Name                string        `gorm:"column:name;not null"`                                                                                                          // 秒杀活动名称
+	Description         string        `gorm:"column:description;type:text"`                                                                                                  // 秒杀活动描述
+	ImageURL            string        `gorm:"column:image_url;type:varchar(512)"`                                                                                            // 活动图片地址
+	StartTime           int64         `gorm:"column:start_time;not null;index:idx_second_kill_status_start,priority:2"`                                                      // 活动开始时间（UNIX 时间戳）
+	EndTime             int64         `gorm:"column:end_time;not null"`                                                                                                      // 活动结束时间（UNIX 时间戳）
+	Status              string        `gorm:"column:status;type:varchar(20);index:idx_second_kill_status_start,priority:1;index:idx_second_kill_category_status,priority:2"` // 活动状态
+	Category            string        `gorm:"column:category;type:varchar(32);not null;default:'';index:idx_second_kill_category_status,priority:1"`                         // 活动分类，为空表示未分类
+	MinUserLevel        int           `gorm:"column:min_user_level;not null;default:0"`                                                                                      // 参与所需的最低用户等级，0 表示不限制
+	Stock               int           `gorm:"column:stock;not null;default:0"`                                                                                               // 库存总量
+	SoldCount           int           `gorm:"column:sold_count;not null;default:0"`                                                                                          // 已售数量
+	GracePeriodSeconds  int           `gorm:"column:grace_period_seconds;not null;default:0"`                                                                                // 结束后仍接受抢购的宽限秒数，用于容忍客户端时钟偏差
+	ParticipationLocked bool          `gorm:"column:participation_locked;not null;default:false"`                                                                            // 是否锁定参与，独立于活动状态，用于合规冻结
+	CreatedAt           int64         `gorm:"column:created_at;autoCreateTime"`                                                                                              // 创建时间（UNIX 时间戳）
+	UpdatedAt           int64         `gorm:"column:updated_at;autoUpdateTime"`                                                                                              // 更新时间（UNIX 时间戳）
+	Participants        []Participant `gorm:"foreignKey:SecondKillID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`                                           // 参与者列表
+	// OversoldBy 超卖数量（sold_count - stock），不对应数据库列，仅由 FindOversoldEvents 填充
+	OversoldBy int `gorm:"-"`
 }
 
 // Participant 数据库中的参与者记录模型
 type Participant struct {
-	ID             string `gorm:"primaryKey;column:id;type:char(36)"` // 参与记录的唯一标识符 (UUID)
-	LotteryID      *int   `gorm:"column:lottery_id"`                  // 抽奖活动ID，可为null
-	SecondKillID   *int   `gorm:"column:second_kill_id"`              // 秒杀活动ID，可为null
-	UserID         int64  `gorm:"column:user_id;not null"`            // 参与者的用户ID
-	ParticipatedAt int64  `gorm:"column:participated_at;not null"`    // 参与时间（UNIX 时间戳）
+	ID             string            `gorm:"primaryKey;column:id;type:char(36)"`                                                                                                         // 参与记录的唯一标识符 (UUID)
+	LotteryID      *int              `gorm:"column:lottery_id;uniqueIndex:uniq_lottery_external_ref,priority:1;index:idx_lottery_participated,priority:1"`                               // 抽奖活动ID，可为null
+	SecondKillID   *int              `gorm:"column:second_kill_id;uniqueIndex:uniq_second_kill_external_ref,priority:1"`                                                                 // 秒杀活动ID，可为null
+	UserID         int64             `gorm:"column:user_id;not null;index:idx_participant_user"`                                                                                         // 参与者的用户ID
+	ParticipatedAt int64             `gorm:"column:participated_at;not null;index:idx_lottery_participated,priority:2;index:idx_participated_at"`                                        // 参与时间（UNIX 时间戳）
+	ExternalRef    *string           `gorm:"column:external_ref;type:varchar(64);uniqueIndex:uniq_lottery_external_ref,priority:2;uniqueIndex:uniq_second_kill_external_ref,priority:2"` // 外部系统的参与编号，可为 NULL，非空时由唯一索引保证在同一活动内唯一
+	Withdrawn      bool              `gorm:"column:withdrawn;not null;default:false"`                                                                                                    // 是否已退出活动，退出后保留记录用于审计
+	IsWinner       bool              `gorm:"column:is_winner;not null;default:false"`                                                                                                    // 是否中奖
+	PrizeID        *int              `gorm:"column:prize_id;index"`                                                                                                                      // 中奖奖品ID，可为null
+	Metadata       map[string]string `gorm:"column:metadata;type:json;serializer:json"`                                                                                                  // 参与元数据（JSON），如设备、IP 等
+}
+
+// DayCount 按天聚合的参与统计
+type DayCount struct {
+	Day   int64 `gorm:"column:day"`   // 当天零点（UTC）的 UNIX 时间戳
+	Count int64 `gorm:"column:count"` // 当天参与次数
+}
+
+// Prize 数据库中的抽奖奖品模型
+type Prize struct {
+	ID        int    `gorm:"primaryKey;autoIncrement"`               // 奖品的唯一标识符
+	LotteryID int    `gorm:"column:lottery_id;not null;index"`       // 所属抽奖活动ID
+	Name      string `gorm:"column:name;type:varchar(100);not null"` // 奖品名称
+	Quantity  int    `gorm:"column:quantity;not null"`               // 奖品总数量
+	Remaining int    `gorm:"column:remaining;not null"`              // 剩余数量
+	Value     int    `gorm:"column:value;not null;default:0"`        // 单个奖品价值
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime"`       // 创建时间（UNIX 时间戳）
+	UpdatedAt int64  `gorm:"column:updated_at;autoUpdateTime"`       // 更新时间（UNIX 时间戳）
+}
+
+// DrawAudit 数据库中的开奖审计记录模型
+type DrawAudit struct {
+	ID             int64    `gorm:"primaryKey;autoIncrement"`                                               // 审计记录的唯一标识符
+	ActivityID     int      `gorm:"column:activity_id;not null;index:idx_activity_created,priority:1"`      // 抽奖活动ID
+	Actor          int64    `gorm:"column:actor;not null"`                                                  // 操作人用户ID
+	Action         string   `gorm:"column:action;type:varchar(32);not null"`                                // 操作类型
+	ParticipantIDs []string `gorm:"column:participant_ids;type:text;serializer:json"`                       // 受影响的参与记录ID列表
+	CreatedAt      int64    `gorm:"column:created_at;autoCreateTime;index:idx_activity_created,priority:2"` // 创建时间（UNIX 时间戳）
+}
+
+// 开奖审计的操作类型
+const (
+	DrawAuditActionSwapWinner  = "swap_winner"  // 手动替换中奖者
+	DrawAuditActionMerge       = "merge"        // 合并其他活动的参与者
+	DrawAuditActionRemoveUsers = "remove_users" // 批量移除参与者
+)
+
+// AnonymizedUserID 匿名化后参与记录使用的占位用户ID
+const AnonymizedUserID int64 = 0
+
+// 抽奖活动的取消原因
+const (
+	CancelReasonBelowMinParticipants = "below_min_participants" // 参与人数未达到最低开奖人数
+	CancelReasonMerged               = "merged"                 // 参与者已合并到其他活动
+)
+
+// CanUserEnter 返回的原因码
+const (
+	EntryReasonAllowed             = "allowed"              // 允许参与
+	EntryReasonParticipationLocked = "participation_locked" // 活动参与已被锁定
+	EntryReasonPaused              = "paused"               // 活动已暂停
+	EntryReasonNotActive           = "not_active"           // 活动不在进行中
+	EntryReasonEntryWindowClosed   = "entry_window_closed"  // 不在报名时间内
+	EntryReasonUserLevelTooLow     = "user_level_too_low"   // 用户等级低于活动要求
+	EntryReasonActivityFull        = "activity_full"        // 参与人数已达上限
+	EntryReasonEntryLimitReached   = "entry_limit_reached"  // 用户参与次数已达上限
+	EntryReasonCooldown            = "cooldown"             // 距上次参与的时间不足
+)
+
+// WinRecord 用户中奖记录，包含活动和奖品信息
+type WinRecord struct {
+	ParticipantID  string `gorm:"column:participant_id"`  // 参与记录ID
+	ActivityID     int    `gorm:"column:activity_id"`     // 抽奖活动ID
+	ActivityName   string `gorm:"column:activity_name"`   // 抽奖活动名称
+	PrizeID        *int   `gorm:"column:prize_id"`        // 奖品ID，可为null
+	PrizeName      string `gorm:"column:prize_name"`      // 奖品名称，未分配奖品时为空
+	ParticipatedAt int64  `gorm:"column:participated_at"` // 参与时间（UNIX 时间戳）
+}
+
+// BatchSkipped 批量操作中被跳过的条目
+type BatchSkipped struct {
+	Index  int    // 条目在输入中的下标
+	Reason string // 跳过原因
+}
+
+// BatchFailed 批量操作中处理失败的条目
+type BatchFailed struct {
+	Index int   // 条目在输入中的下标
+	Err   error // 失败原因
+}
+
+// BatchResult 批量操作的逐条处理结果，Succeeded 为成功条目在输入中的下标
+// 批量方法仅在发生整体性错误（如数据库或上下文错误）时返回顶层 error，其余情况通过 BatchResult 报告
+type BatchResult struct {
+	Succeeded []int
+	Skipped   []BatchSkipped
+	Failed    []BatchFailed
+}
+
+func (r *BatchResult) skip(index int, reason string) {
+	r.Skipped = append(r.Skipped, BatchSkipped{Index: index, Reason: reason})
+}
+
+func (r *BatchResult) fail(index int, err error) {
+	r.Failed = append(r.Failed, BatchFailed{Index: index, Err: err})
+}
+
+// ActivitySummary 抽奖或秒杀活动的摘要信息
+type ActivitySummary struct {
+	ID        int    `gorm:"column:id"`         // 活动ID
+	Type      string `gorm:"column:type"`       // 活动类型，lottery 或 secondkill
+	Name      string `gorm:"column:name"`       // 活动名称
+	StartTime int64  `gorm:"column:start_time"` // 活动开始时间（UNIX 时间戳）
+	EndTime   int64  `gorm:"column:end_time"`   // 活动结束时间（UNIX 时间戳）
+	Status    string `gorm:"column:status"`     // 活动状态
+}
+
+// SecondKillReservation 数据库中的秒杀库存预留记录模型
+type SecondKillReservation struct {
+	ID           string `gorm:"primaryKey;column:id;type:char(36)"`                                          // 预留记录的唯一标识符 (UUID)
+	SecondKillID int    `gorm:"column:second_kill_id;not null;index"`                                        // 秒杀活动ID
+	UserID       int64  `gorm:"column:user_id;not null"`                                                     // 用户ID
+	Status       string `gorm:"column:status;type:varchar(20);not null;index:idx_status_expires,priority:1"` // 预留状态
+	ExpiresAt    int64  `gorm:"column:expires_at;not null;index:idx_status_expires,priority:2"`              // 预留过期时间（UNIX 时间戳）
+	CreatedAt    int64  `gorm:"column:created_at;autoCreateTime"`                                            // 创建时间（UNIX 时间戳）
+	UpdatedAt    int64  `gorm:"column:updated_at;autoUpdateTime"`                                            // 更新时间（UNIX 时间戳）
+}
+
+// FunnelStats 秒杀活动的转化漏斗统计
+type FunnelStats struct {
+	Views                     int64   // 浏览次数，由调用方从独立计数器传入
+	Reservations              int64   // 预留次数
+	Confirmations             int64   // 确认次数
+	Purchases                 int64   // 完成购买次数
+	ReservationToConfirmation float64 // 预留到确认的转化率
+}
+
+// UserEntryCount 用户在活动中的参与次数
+type UserEntryCount struct {
+	UserID  int64 `gorm:"column:user_id"` // 用户ID
+	Entries int64 `gorm:"column:entries"` // 有效参与次数
+}
+
+// LotteryDrawSummary 抽奖活动的摘要信息，附带参与人数和开奖情况，用于运营后台的待开奖队列
+type LotteryDrawSummary struct {
+	ID               int    `gorm:"column:id"`                // 抽奖活动ID
+	Name             string `gorm:"column:name"`              // 抽奖活动名称
+	StartTime        int64  `gorm:"column:start_time"`        // 活动开始时间（UNIX 时间戳）
+	EndTime          int64  `gorm:"column:end_time"`          // 活动结束时间（UNIX 时间戳）
+	Status           string `gorm:"column:status"`            // 抽奖活动状态
+	ParticipantCount int64  `gorm:"column:participant_count"` // 有效参与人数（不含已退出）
+	HasWinners       bool   `gorm:"column:has_winners"`       // 是否已产生中奖者
+}
+
+// WinnerRecord 抽奖活动的中奖者记录，包含活动和奖品信息，用于批量履约
+type WinnerRecord struct {
+	ParticipantID  string `gorm:"column:participant_id"`  // 参与记录ID
+	ActivityID     int    `gorm:"column:activity_id"`     // 抽奖活动ID
+	ActivityName   string `gorm:"column:activity_name"`   // 抽奖活动名称
+	UserID         int64  `gorm:"column:user_id"`         // 中奖用户ID
+	PrizeID        *int   `gorm:"column:prize_id"`        // 奖品ID，可为null
+	PrizeName      string `gorm:"column:prize_name"`      // 奖品名称，未分配奖品时为空
+	PrizeValue     int    `gorm:"column:prize_value"`     // 单个奖品价值，未分配奖品时为 0
+	ParticipatedAt int64  `gorm:"column:participated_at"` // 参与时间（UNIX 时间戳）
+}
+
+// ActivitySnapshot 活动在某一时刻的状态快照，用于财务等需要数值前后一致的报表
+// 快照只包含值类型字段，返回后不会随活动继续进行而变化
+type ActivitySnapshot struct {
+	ActivityID       int    // 活动ID
+	ActivityType     string // 活动类型，lottery 或 secondkill
+	Name             string // 活动名称
+	Status           string // 活动状态
+	ParticipantCount int64  // 有效参与记录数，不含已退出的记录
+	WithdrawnCount   int64  // 已退出（含已退款）的参与记录数
+	UniqueUsers      int64  // 有效参与的去重用户数
+	WinnerCount      int64  // 中奖记录数
+	PrizeQuantity    int    // 抽奖活动的奖品总数量，秒杀活动为 0
+	PrizeRemaining   int    // 抽奖活动的奖品剩余数量，秒杀活动为 0
+	Stock            int    // 秒杀活动的库存总量，抽奖活动为 0
+	SoldCount        int    // 秒杀活动的已售数量，抽奖活动为 0
+	SnapshotAt       int64  // 快照时间（UNIX 时间戳）
+}
+
+func NewLotteryDrawDAO(db *gorm.DB, l *zap.Logger, opts ...LotteryDrawDAOOption) LotteryDrawDAO {
+	dao := &lotteryDrawDAO{
+		db:          db,
+		l:           l,
+		logNotFound: true,
+	}
+
+	for _, opt := range opts {
+		opt(dao)
+	}
+
+	if dao.pool != nil {
+		dao.applyPoolConfig(*dao.pool)
+	}
+
+	if dao.maxConcurrentDraws > 0 {
+		dao.drawSem = make(chan struct{}, dao.maxConcurrentDraws)
+	}
+
+	return dao
+}
+
+// applyPoolConfig 将连接池配置应用到底层 sql.DB，获取失败时仅记录日志
+func (l *lotteryDrawDAO) applyPoolConfig(cfg PoolConfig) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		l.l.Error("获取底层数据库连接失败，连接池配置未生效", zap.Error(err))
+		return
+	}
+
+	if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+
+	if cfg.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+}
+
+type ctxLoggerKey struct{}
+
+type ctxRequestIDKey struct{}
+
+type ctxActorKey struct{}
+
+// lotteryStatuses 抽奖活动的合法状态
+var lotteryStatuses = []string{
+	domain.LotteryStatusPending,
+	domain.LotteryStatusActive,
+	domain.LotteryStatusCompleted,
+	domain.LotteryStatusCancelled,
+	domain.LotteryStatusPaused,
+}
+
+// secondKillStatuses 秒杀活动的合法状态
+var secondKillStatuses = []string{
+	domain.SecondKillStatusPending,
+	domain.SecondKillStatusActive,
+	domain.SecondKillStatusCompleted,
+	domain.SecondKillStatusPaused,
+}
+
+// normalizeStatus 去除首尾空白并转为小写后校验状态，空字符串表示不过滤
+func normalizeStatus(status string, known []string) (string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == "" {
+		return "", nil
+	}
+
+	for _, s := range known {
+		if status == s {
+			return status, nil
+		}
+	}
+
+	return "", ErrInvalidStatus
+}
+
+// ContextWithLogger 将请求级别的 logger 写入上下文，DAO 记录日志时会优先使用它
+func ContextWithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxLoggerKey{}, logger)
+}
+
+// ContextWithRequestID 将请求ID写入上下文，DAO 记录日志时会附带该字段
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxRequestIDKey{}, requestID)
+}
+
+// ContextWithActor 将操作人用户ID写入上下文，写入审计记录时使用
+func ContextWithActor(ctx context.Context, actor int64) context.Context {
+	return context.WithValue(ctx, ctxActorKey{}, actor)
 }
 
-func NewLotteryDrawDAO(db *gorm.DB, l *zap.Logger) LotteryDrawDAO {
-	return &lotteryDrawDAO{
-		db: db,
-		l:  l,
+// actorFrom 从上下文中获取操作人用户ID，不存在时返回 0 表示系统操作
+func actorFrom(ctx context.Context) int64 {
+	actor, _ := ctx.Value(ctxActorKey{}).(int64)
+	return actor
+}
+
+// loggerFrom 优先从上下文中获取 logger 及请求ID，不存在时回退到注入的 logger
+func (l *lotteryDrawDAO) loggerFrom(ctx context.Context) *zap.Logger {
+	logger := l.l
+	if ctxLogger, ok := ctx.Value(ctxLoggerKey{}).(*zap.Logger); ok && ctxLogger != nil {
+		logger = ctxLogger
+	}
+
+	if requestID, ok := ctx.Value(ctxRequestIDKey{}).(string); ok && requestID != "" {
+		logger = logger.With(zap.String("request_id", requestID))
+	}
+
+	return logger
+}
+
+// warnNotFound 记录未找到数据的 warn 日志，可通过 WithLogNotFound 关闭
+func (l *lotteryDrawDAO) warnNotFound(ctx context.Context, msg string, fields ...zap.Field) {
+	if !l.logNotFound {
+		return
+	}
+
+	l.loggerFrom(ctx).Warn(msg, fields...)
+}
+
+// orderParticipants 参与者统一按参与时间和ID排序，保证相同时间戳下顺序稳定
+func orderParticipants(db *gorm.DB) *gorm.DB {
+	return db.Order("participated_at, id")
+}
+
+// validateImageURL 校验活动图片地址，为空表示不设置图片
+func validateImageURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidImageURL
 	}
+
+	return nil
+}
+
+// maxPageOffset 分页允许的最大偏移量，超过时直接返回空页，避免深分页拖垮数据库
+const maxPageOffset = 100000
+
+// pageBounds 根据分页参数计算 limit 和 offset，未设置时使用默认每页数量
+// 负数偏移量按 0 处理；偏移量超过 maxPageOffset 时 ok 为 false，调用方应直接返回空页
+func pageBounds(pagination domain.Pagination) (limit int, offset int, ok bool) {
+	var size int64 = 10
+	if pagination.Size != nil && *pagination.Size > 0 {
+		size = *pagination.Size
+	}
+
+	var off int64
+	if pagination.Offset != nil && *pagination.Offset > 0 {
+		off = *pagination.Offset
+	}
+
+	if off > maxPageOffset {
+		return int(size), 0, false
+	}
+
+	return int(size), int(off), true
 }
 
 // CreateLotteryDraw 创建一个新的抽奖活动
 func (l *lotteryDrawDAO) CreateLotteryDraw(ctx context.Context, model LotteryDraw) error {
+	if err := validateImageURL(model.ImageURL); err != nil {
+		return err
+	}
+
+	if err := ensureDrawSeed(&model); err != nil {
+		return err
+	}
+
 	if err := l.db.WithContext(ctx).Create(&model).Error; err != nil {
-		l.l.Error("创建抽奖活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("创建抽奖活动失败", zap.Error(err))
 		return err
 	}
 
+	l.markLotteryDrawNamesExist(model.Name)
+
 	return nil
 }
 
 // GetLotteryDrawByID 根据ID获取指定的抽奖活动
+// 会一次性预加载全部参与者，仅适用于参与人数较少的活动，大型活动请使用 IterateParticipants 分批处理
 func (l *lotteryDrawDAO) GetLotteryDrawByID(ctx context.Context, id int) (LotteryDraw, error) {
 	var lotteryDraw LotteryDraw
 
 	// 使用 Preload 预加载参与者，避免 N+1 查询问题
 	if err := l.db.WithContext(ctx).
-		Preload("Participants").
+		Preload("Participants", orderParticipants).
 		Where("id = ?", id).
 		First(&lotteryDraw).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			l.l.Warn("未找到指定ID的抽奖活动", zap.Int("ID", id))
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", id))
 			return LotteryDraw{}, err
 		}
 
-		l.l.Error("获取抽奖活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("获取抽奖活动失败", zap.Error(err))
 
 		return LotteryDraw{}, err
 	}
@@ -112,29 +793,35 @@ func (l *lotteryDrawDAO) GetLotteryDrawByID(ctx context.Context, id int) (Lotter
 
 // ListLotteryDraws 获取所有抽奖活动，支持状态过滤和分页
 func (l *lotteryDrawDAO) ListLotteryDraws(ctx context.Context, status string, pagination domain.Pagination) ([]LotteryDraw, error) {
+	// 请求已取消时直接返回，避免无效的数据库查询
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	status, err := normalizeStatus(status, lotteryStatuses)
+	if err != nil {
+		return nil, err
+	}
+
 	var lotteryDraws []LotteryDraw
-	var defaultSize int64 = 10
 
-	query := l.db.WithContext(ctx).Preload("Participants")
+	// 应用分页，偏移量超出上限时直接返回空页
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDraw{}, nil
+	}
+
+	query := l.db.WithContext(ctx).Preload("Participants", orderParticipants)
 
 	// 根据状态进行过滤
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
 
-	// 应用分页
-	if pagination.Page <= 0 {
-		pagination.Page = 1
-	}
-
-	if *pagination.Size <= 0 {
-		pagination.Size = &defaultSize
-	}
-
-	query = query.Limit(int(*pagination.Size)).Offset(int(*pagination.Offset))
+	query = query.Limit(limit).Offset(offset)
 
 	if err := query.Find(&lotteryDraws).Error; err != nil {
-		l.l.Error("获取抽奖活动列表失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("获取抽奖活动列表失败", zap.Error(err))
 		return nil, err
 	}
 
@@ -143,19 +830,81 @@ func (l *lotteryDrawDAO) ListLotteryDraws(ctx context.Context, status string, pa
 
 // ExistsLotteryDrawByName 检查抽奖活动名称是否存在
 func (l *lotteryDrawDAO) ExistsLotteryDrawByName(ctx context.Context, name string) (bool, error) {
+	if l.nameCache != nil {
+		if exists, ok := l.nameCache.Get(name); ok {
+			return exists.(bool), nil
+		}
+	}
+
 	var count int64
 
 	if err := l.db.WithContext(ctx).
 		Model(&LotteryDraw{}).
 		Where("name = ?", name).
 		Count(&count).Error; err != nil {
-		l.l.Error("检查抽奖活动名称是否存在失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("检查抽奖活动名称是否存在失败", zap.Error(err))
 		return false, err
 	}
 
+	if l.nameCache != nil {
+		l.nameCache.SetDefault(name, count > 0)
+	}
+
 	return count > 0, nil
 }
 
+// markLotteryDrawNamesExist 创建抽奖活动成功后刷新名称缓存，避免缓存中残留“不存在”的结果
+func (l *lotteryDrawDAO) markLotteryDrawNamesExist(names ...string) {
+	if l.nameCache == nil {
+		return
+	}
+
+	for _, name := range names {
+		l.nameCache.SetDefault(name, true)
+	}
+}
+
+// ExtendLotteryDraw 延长进行中抽奖活动的结束时间，只允许向后延长
+func (l *lotteryDrawDAO) ExtendLotteryDraw(ctx context.Context, id int, newEndTime int64) error {
+	return l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var lotteryDraw LotteryDraw
+
+		if err := tx.Select("id", "status", "end_time").
+			Where("id = ?", id).
+			First(&lotteryDraw).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", id))
+				return err
+			}
+			l.loggerFrom(ctx).Error("获取抽奖活动失败", zap.Error(err))
+			return err
+		}
+
+		if lotteryDraw.Status != domain.LotteryStatusActive {
+			return ErrLotteryDrawNotActive
+		}
+
+		if newEndTime <= lotteryDraw.EndTime {
+			return ErrInvalidEndTime
+		}
+
+		// 以状态和原结束时间作为条件，防止并发修改
+		result := tx.Model(&LotteryDraw{}).
+			Where("id = ? AND status = ? AND end_time = ?", id, domain.LotteryStatusActive, lotteryDraw.EndTime).
+			Update("end_time", newEndTime)
+		if result.Error != nil {
+			l.loggerFrom(ctx).Error("延长抽奖活动结束时间失败", zap.Int("ID", id), zap.Int64("newEndTime", newEndTime), zap.Error(result.Error))
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrLotteryDrawNotActive
+		}
+
+		return nil
+	})
+}
+
 // HasUserParticipatedInLottery 检查用户是否已参与某个抽奖活动
 func (l *lotteryDrawDAO) HasUserParticipatedInLottery(ctx context.Context, id int, userID int64) (bool, error) {
 	var count int64
@@ -164,7 +913,7 @@ func (l *lotteryDrawDAO) HasUserParticipatedInLottery(ctx context.Context, id in
 		Model(&Participant{}).
 		Where("lottery_id = ? AND user_id = ?", id, userID).
 		Count(&count).Error; err != nil {
-		l.l.Error("检查用户是否已参与抽奖活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("检查用户是否已参与抽奖活动失败", zap.Error(err))
 		return false, err
 	}
 
@@ -173,8 +922,12 @@ func (l *lotteryDrawDAO) HasUserParticipatedInLottery(ctx context.Context, id in
 
 // CreateSecondKillEvent 创建一个新的秒杀活动
 func (l *lotteryDrawDAO) CreateSecondKillEvent(ctx context.Context, model SecondKillEvent) error {
+	if err := validateImageURL(model.ImageURL); err != nil {
+		return err
+	}
+
 	if err := l.db.WithContext(ctx).Create(&model).Error; err != nil {
-		l.l.Error("创建秒杀活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("创建秒杀活动失败", zap.Error(err))
 		return err
 	}
 
@@ -187,13 +940,13 @@ func (l *lotteryDrawDAO) GetSecondKillEventByID(ctx context.Context, id int) (Se
 
 	// 使用 Preload 预加载参与者，避免 N+1 查询问题
 	if err := l.db.WithContext(ctx).
-		Preload("Participants").
+		Preload("Participants", orderParticipants).
 		First(&secondKillEvent, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			l.l.Warn("未找到指定ID的秒杀活动", zap.Int("ID", id))
+			l.warnNotFound(ctx, "未找到指定ID的秒杀活动", zap.Int("ID", id))
 			return SecondKillEvent{}, err
 		}
-		l.l.Error("获取秒杀活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("获取秒杀活动失败", zap.Error(err))
 		return SecondKillEvent{}, err
 	}
 
@@ -202,29 +955,34 @@ func (l *lotteryDrawDAO) GetSecondKillEventByID(ctx context.Context, id int) (Se
 
 // ListSecondKillEvents 获取所有秒杀活动，支持状态过滤和分页
 func (l *lotteryDrawDAO) ListSecondKillEvents(ctx context.Context, status string, pagination domain.Pagination) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	status, err := normalizeStatus(status, secondKillStatuses)
+	if err != nil {
+		return nil, err
+	}
+
 	var secondKillEvents []SecondKillEvent
-	var defaultSize int64 = 10
 
-	query := l.db.WithContext(ctx).Preload("Participants")
+	// 应用分页，偏移量超出上限时直接返回空页
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []SecondKillEvent{}, nil
+	}
+
+	query := l.db.WithContext(ctx).Preload("Participants", orderParticipants)
 
 	// 根据状态进行过滤
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
 
-	// 应用分页
-	if pagination.Page <= 0 {
-		pagination.Page = 1
-	}
-
-	if *pagination.Size <= 0 {
-		pagination.Size = &defaultSize
-	}
-
-	query = query.Limit(int(*pagination.Size)).Offset(int(*pagination.Offset))
+	query = query.Limit(limit).Offset(offset)
 
 	if err := query.Find(&secondKillEvents).Error; err != nil {
-		l.l.Error("获取秒杀活动列表失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("获取秒杀活动列表失败", zap.Error(err))
 		return nil, err
 	}
 
@@ -239,7 +997,7 @@ func (l *lotteryDrawDAO) ExistsSecondKillEventByName(ctx context.Context, name s
 		Model(&SecondKillEvent{}).
 		Where("name = ?", name).
 		Count(&count).Error; err != nil {
-		l.l.Error("检查秒杀活动名称是否存在失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("检查秒杀活动名称是否存在失败", zap.Error(err))
 		return false, err
 	}
 
@@ -254,74 +1012,304 @@ func (l *lotteryDrawDAO) HasUserParticipatedInSecondKill(ctx context.Context, id
 		Model(&Participant{}).
 		Where("second_kill_id = ? AND user_id = ?", id, userID).
 		Count(&count).Error; err != nil {
-		l.l.Error("检查用户是否已参与秒杀活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("检查用户是否已参与秒杀活动失败", zap.Error(err))
 		return false, err
 	}
 
 	return count > 0, nil
 }
 
-// AddParticipant 添加参与者
+// AddParticipant 添加参与者，参与规则由 evaluateParticipation 判定，与 CanUserEnter 完全一致
+// 外部参与编号非空时校验其在同一活动内唯一
 func (l *lotteryDrawDAO) AddParticipant(ctx context.Context, model Participant) error {
-	// 插入参与者记录
-	if err := l.db.WithContext(ctx).Create(&model).Error; err != nil {
-		l.l.Error("添加参与者记录失败", zap.Error(err), zap.Any("participant", model))
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := l.checkParticipationAllowed(ctx, tx, model); err != nil {
+			return err
+		}
+
+		// 插入参与者记录，外部参与编号的唯一性由唯一索引保证
+		if err := tx.Create(&model).Error; err != nil {
+			if model.ExternalRef != nil && isDuplicateKeyError(tx, err) {
+				return ErrDuplicateExternalRef
+			}
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		if _, rejected := entryRejectionReason(err); rejected || errors.Is(err, ErrDuplicateExternalRef) {
+			return err
+		}
+		l.loggerFrom(ctx).Error("添加参与者记录失败", zap.Error(err), zap.Any("participant", model))
 		return err
 	}
 
+	if model.LotteryID != nil {
+		l.incrLiveParticipantCount(ctx, *model.LotteryID, 1)
+	}
+
 	return nil
 }
 
-// ListPendingLotteryDraws 获取所有待激活的抽奖活动
-func (l *lotteryDrawDAO) ListPendingLotteryDraws(ctx context.Context, currentTime int64) ([]LotteryDraw, error) {
-	var lotteryDraws []LotteryDraw
+// AddParticipants 逐条添加参与者，每条记录使用独立事务，结果中的下标对应 models
+// 外部参与编号重复的条目记为跳过，其余被拒绝的条目记为失败，上下文取消或超时时停止处理并返回顶层 error
+func (l *lotteryDrawDAO) AddParticipants(ctx context.Context, models []Participant) (BatchResult, error) {
+	var result BatchResult
 
-	if err := l.db.WithContext(ctx).
-		Preload("Participants").
-		Where("status = ? AND start_time <= ?", domain.LotteryStatusPending, currentTime).
-		Find(&lotteryDraws).Error; err != nil {
-		l.l.Error("获取待激活抽奖活动失败", zap.Error(err))
-		return nil, err
+	for i, model := range models {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		err := l.AddParticipant(ctx, model)
+		switch {
+		case err == nil:
+			result.Succeeded = append(result.Succeeded, i)
+		case errors.Is(err, ErrDuplicateExternalRef):
+			result.skip(i, err.Error())
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return result, err
+		default:
+			result.fail(i, err)
+		}
 	}
 
-	return lotteryDraws, nil
+	return result, nil
 }
 
-// UpdateLotteryDrawStatus 更新抽奖活动的状态
-func (l *lotteryDrawDAO) UpdateLotteryDrawStatus(ctx context.Context, id int, status string) error {
-	if err := l.db.WithContext(ctx).
-		Model(&LotteryDraw{}).
-		Where("id = ?", id).
-		Update("status", status).Error; err != nil {
-		l.l.Error("更新抽奖活动状态失败", zap.Int("ID", id), zap.String("status", status), zap.Error(err))
-		return err
+// isDuplicateKeyError 判断错误是否为唯一索引冲突，借助数据库方言将驱动错误转换为 gorm.ErrDuplicatedKey
+func isDuplicateKeyError(db *gorm.DB, err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
 	}
 
-	return nil
+	translator, ok := db.Dialector.(gorm.ErrorTranslator)
+	return ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
 }
 
-// ListPendingSecondKillEvents 获取所有待激活的秒杀活动
-func (l *lotteryDrawDAO) ListPendingSecondKillEvents(ctx context.Context, currentTime int64) ([]SecondKillEvent, error) {
-	var secondKillEvents []SecondKillEvent
+// checkParticipationAllowed 校验用户能否以 model 参与其所属的活动，所有生成参与记录的路径共用该校验
+// 活动行被锁定至事务结束，使人数上限等基于计数的规则在并发参与下仍然成立；参与时间为空时使用当前时间
+func (l *lotteryDrawDAO) checkParticipationAllowed(ctx context.Context, tx *gorm.DB, model Participant) error {
+	rules, state, err := loadParticipation(tx, model, true)
+	if err != nil {
+		return err
+	}
 
-	if err := l.db.WithContext(ctx).
-		Preload("Participants").
-		Where("status = ? AND start_time <= ?", domain.SecondKillStatusPending, currentTime).
-		Find(&secondKillEvents).Error; err != nil {
-		l.l.Error("获取待激活秒杀活动失败", zap.Error(err))
-		return nil, err
+	userLevel, err := resolveUserLevel(ctx, l.userLevel, model.UserID, rules.MinUserLevel)
+	if err != nil {
+		return err
 	}
 
-	return secondKillEvents, nil
+	enteredAt := model.ParticipatedAt
+	if enteredAt == 0 {
+		enteredAt = time.Now().Unix()
+	}
+
+	return evaluateParticipation(rules, state, model.LotteryID != nil, userLevel, enteredAt)
 }
 
-// UpdateSecondKillEventStatus 更新秒杀活动的状态
-func (l *lotteryDrawDAO) UpdateSecondKillEventStatus(ctx context.Context, id int, status string) error {
-	if err := l.db.WithContext(ctx).
-		Model(&SecondKillEvent{}).
+// lotteryParticipationColumns 判定抽奖活动参与规则所需的列
+var lotteryParticipationColumns = []string{
+	"status", "participation_locked", "start_time", "end_time", "entry_start_time", "entry_end_time",
+	"min_user_level", "max_participants", "max_entries_per_user", "entry_cooldown_seconds",
+}
+
+// loadParticipation 加载 model 所属活动的参与规则及判定所需的计数，活动不存在时返回 ErrActivityNotFound
+// 计数仅在活动配置了对应限制时查询；lock 为 true 时锁定活动行
+func loadParticipation(db *gorm.DB, model Participant, lock bool) (participationRules, participationState, error) {
+	var rules participationRules
+	var state participationState
+
+	query := db.Model(&SecondKillEvent{}).Select("status", "participation_locked", "min_user_level").Where("id = ?", model.SecondKillID)
+	if model.LotteryID != nil {
+		query = db.Model(&LotteryDraw{}).Select(lotteryParticipationColumns).Where("id = ?", *model.LotteryID)
+	}
+
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	result := query.Limit(1).Scan(&rules)
+	if result.Error != nil {
+		return rules, state, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return rules, state, ErrActivityNotFound
+	}
+
+	if model.LotteryID == nil {
+		return rules, state, nil
+	}
+
+	if rules.MaxParticipants > 0 {
+		if err := db.Model(&Participant{}).
+			Where("lottery_id = ? AND withdrawn = ?", *model.LotteryID, false).
+			Count(&state.Participants).Error; err != nil {
+			return rules, state, err
+		}
+	}
+
+	if rules.MaxEntriesPerUser > 0 {
+		if err := db.Model(&Participant{}).
+			Where("lottery_id = ? AND user_id = ? AND withdrawn = ?", *model.LotteryID, model.UserID, false).
+			Count(&state.UserEntries).Error; err != nil {
+			return rules, state, err
+		}
+	}
+
+	// 冷却时间包含已退出的参与记录，退出不会重置冷却
+	if rules.EntryCooldownSeconds > 0 {
+		if err := db.Model(&Participant{}).
+			Select("COALESCE(MAX(participated_at), 0)").
+			Where("lottery_id = ? AND user_id = ?", *model.LotteryID, model.UserID).
+			Scan(&state.UserLastEntry).Error; err != nil {
+			return rules, state, err
+		}
+	}
+
+	return rules, state, nil
+}
+
+// participationRules 判定能否参与活动所需的活动字段
+type participationRules struct {
+	Status               string `gorm:"column:status"`
+	Locked               bool   `gorm:"column:participation_locked"`
+	StartTime            int64  `gorm:"column:start_time"`
+	EndTime              int64  `gorm:"column:end_time"`
+	EntryStartTime       int64  `gorm:"column:entry_start_time"`
+	EntryEndTime         int64  `gorm:"column:entry_end_time"`
+	MinUserLevel         int    `gorm:"column:min_user_level"`
+	MaxParticipants      int    `gorm:"column:max_participants"`
+	MaxEntriesPerUser    int    `gorm:"column:max_entries_per_user"`
+	EntryCooldownSeconds int    `gorm:"column:entry_cooldown_seconds"`
+}
+
+// participationState 判定能否参与活动所需的实时计数，未配置对应限制时为 0
+type participationState struct {
+	Participants  int64 // 活动中未退出的参与记录数
+	UserEntries   int64 // 用户在活动中未退出的参与记录数
+	UserLastEntry int64 // 用户在活动中最近一次参与的时间（含已退出的记录），从未参与时为 0
+}
+
+// evaluateParticipation 判定 userLevel 等级的用户在 enteredAt 时刻能否参与活动，是参与规则的唯一实现，
+// AddParticipant、InstantDraw、ReserveSecondKill 与 CanUserEnter 均通过它判定，按以下顺序返回第一个不满足的规则：
+// 参与锁定、暂停、不在进行中、报名时间窗口（仅抽奖）、最低用户等级、参与人数上限、每用户参与次数上限、参与间隔
+// isLottery 为 false 时（秒杀活动）活动不在进行中返回 ErrEventNotActive；秒杀活动不配置人数和次数限制，相关规则不生效
+func evaluateParticipation(rules participationRules, state participationState, isLottery bool, userLevel int, enteredAt int64) error {
+	if rules.Locked {
+		return ErrParticipationLocked
+	}
+
+	if rules.Status == domain.LotteryStatusPaused {
+		return ErrActivityPaused
+	}
+
+	if rules.Status != domain.LotteryStatusActive {
+		if isLottery {
+			return ErrLotteryDrawNotActive
+		}
+		return ErrEventNotActive
+	}
+
+	if isLottery {
+		start, end := entryWindow(rules.StartTime, rules.EndTime, rules.EntryStartTime, rules.EntryEndTime)
+		if enteredAt < start || enteredAt > end {
+			return ErrEntryWindowClosed
+		}
+	}
+
+	if userLevel < rules.MinUserLevel {
+		return ErrUserLevelTooLow
+	}
+
+	if rules.MaxParticipants > 0 && state.Participants >= int64(rules.MaxParticipants) {
+		return ErrActivityFull
+	}
+
+	if rules.MaxEntriesPerUser > 0 && state.UserEntries >= int64(rules.MaxEntriesPerUser) {
+		return ErrUserEntryLimitReached
+	}
+
+	if rules.EntryCooldownSeconds > 0 && state.UserLastEntry > 0 && enteredAt < state.UserLastEntry+int64(rules.EntryCooldownSeconds) {
+		return ErrEntryCooldown
+	}
+
+	return nil
+}
+
+// entryWindow 计算抽奖活动的报名时间窗口，未设置报名时间时使用活动的展示时间
+func entryWindow(startTime, endTime, entryStartTime, entryEndTime int64) (int64, int64) {
+	if entryStartTime == 0 {
+		entryStartTime = startTime
+	}
+
+	if entryEndTime == 0 {
+		entryEndTime = endTime
+	}
+
+	return entryStartTime, entryEndTime
+}
+
+// ListPendingLotteryDraws 获取所有待激活的抽奖活动
+func (l *lotteryDrawDAO) ListPendingLotteryDraws(ctx context.Context, currentTime int64) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var lotteryDraws []LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Preload("Participants", orderParticipants).
+		Where("status = ? AND start_time <= ?", domain.LotteryStatusPending, currentTime).
+		Find(&lotteryDraws).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取待激活抽奖活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	return lotteryDraws, nil
+}
+
+// UpdateLotteryDrawStatus 更新抽奖活动的状态
+func (l *lotteryDrawDAO) UpdateLotteryDrawStatus(ctx context.Context, id int, status string) error {
+	if err := l.db.WithContext(ctx).
+		Model(&LotteryDraw{}).
+		Where("id = ?", id).
+		Update("status", status).Error; err != nil {
+		l.loggerFrom(ctx).Error("更新抽奖活动状态失败", zap.Int("ID", id), zap.String("status", status), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ListPendingSecondKillEvents 获取所有待激活的秒杀活动
+func (l *lotteryDrawDAO) ListPendingSecondKillEvents(ctx context.Context, currentTime int64) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var secondKillEvents []SecondKillEvent
+
+	if err := l.db.WithContext(ctx).
+		Preload("Participants", orderParticipants).
+		Where("status = ? AND start_time <= ?", domain.SecondKillStatusPending, currentTime).
+		Find(&secondKillEvents).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取待激活秒杀活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	return secondKillEvents, nil
+}
+
+// UpdateSecondKillEventStatus 更新秒杀活动的状态
+func (l *lotteryDrawDAO) UpdateSecondKillEventStatus(ctx context.Context, id int, status string) error {
+	if err := l.db.WithContext(ctx).
+		Model(&SecondKillEvent{}).
 		Where("id = ?", id).
 		Update("status", status).Error; err != nil {
-		l.l.Error("更新秒杀活动状态失败", zap.Int("ID", id), zap.String("status", status), zap.Error(err))
+		l.loggerFrom(ctx).Error("更新秒杀活动状态失败", zap.Int("ID", id), zap.String("status", status), zap.Error(err))
 		return err
 	}
 
@@ -330,13 +1318,17 @@ func (l *lotteryDrawDAO) UpdateSecondKillEventStatus(ctx context.Context, id int
 
 // ListActiveLotteryDraws 获取所有进行中的抽奖活动
 func (l *lotteryDrawDAO) ListActiveLotteryDraws(ctx context.Context, currentTime int64) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var lotteryDraws []LotteryDraw
 
 	if err := l.db.WithContext(ctx).
-		Preload("Participants").
+		Preload("Participants", orderParticipants).
 		Where("status = ? AND start_time <= ? AND end_time >= ?", domain.LotteryStatusActive, currentTime, currentTime).
 		Find(&lotteryDraws).Error; err != nil {
-		l.l.Error("获取进行中的抽奖活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("获取进行中的抽奖活动失败", zap.Error(err))
 		return nil, err
 	}
 
@@ -345,15 +1337,3706 @@ func (l *lotteryDrawDAO) ListActiveLotteryDraws(ctx context.Context, currentTime
 
 // ListActiveSecondKillEvents 获取所有进行中的秒杀活动
 func (l *lotteryDrawDAO) ListActiveSecondKillEvents(ctx context.Context, currentTime int64) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var secondKillEvents []SecondKillEvent
 
 	if err := l.db.WithContext(ctx).
-		Preload("Participants").
+		Preload("Participants", orderParticipants).
 		Where("status = ? AND start_time <= ? AND end_time >= ?", domain.SecondKillStatusActive, currentTime, currentTime).
 		Find(&secondKillEvents).Error; err != nil {
-		l.l.Error("获取进行中的秒杀活动失败", zap.Error(err))
+		l.loggerFrom(ctx).Error("获取进行中的秒杀活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	return secondKillEvents, nil
+}
+
+// secondsPerDay 一天的秒数，用于按天分组
+const secondsPerDay int64 = 24 * 60 * 60
+
+// GlobalParticipationByDay 统计时间范围内全平台每天的参与次数，缺失的日期补零
+func (l *lotteryDrawDAO) GlobalParticipationByDay(ctx context.Context, fromTs, toTs int64) ([]DayCount, error) {
+	if fromTs > toTs {
+		return []DayCount{}, nil
+	}
+
+	var rows []DayCount
+
+	// 在数据库端按天分组，避免加载参与记录
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("participated_at - participated_at % ? AS day, COUNT(*) AS count", secondsPerDay).
+		Where("participated_at >= ? AND participated_at <= ?", fromTs, toTs).
+		Group("day").
+		Order("day").
+		Scan(&rows).Error; err != nil {
+		l.loggerFrom(ctx).Error("按天统计全平台参与次数失败", zap.Int64("fromTs", fromTs), zap.Int64("toTs", toTs), zap.Error(err))
+		return nil, err
+	}
+
+	counts := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Day] = row.Count
+	}
+
+	firstDay := fromTs - fromTs%secondsPerDay
+	lastDay := toTs - toTs%secondsPerDay
+
+	result := make([]DayCount, 0, (lastDay-firstDay)/secondsPerDay+1)
+	for day := firstDay; day <= lastDay; day += secondsPerDay {
+		result = append(result, DayCount{Day: day, Count: counts[day]})
+	}
+
+	return result, nil
+}
+
+// ListStuckActiveDraws 获取已过结束时间但仍处于进行中的抽奖活动，用于排查状态更新任务
+func (l *lotteryDrawDAO) ListStuckActiveDraws(ctx context.Context, now int64) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var lotteryDraws []LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Where("status = ? AND end_time < ?", domain.LotteryStatusActive, now).
+		Order("end_time").
+		Find(&lotteryDraws).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取滞留的进行中抽奖活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	return lotteryDraws, nil
+}
+
+// ListStuckActiveSecondKillEvents 获取已过结束时间但仍处于进行中的秒杀活动，用于排查状态更新任务
+func (l *lotteryDrawDAO) ListStuckActiveSecondKillEvents(ctx context.Context, now int64) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var secondKillEvents []SecondKillEvent
+
+	if err := l.db.WithContext(ctx).
+		Where("status = ? AND end_time < ?", domain.SecondKillStatusActive, now).
+		Order("end_time").
+		Find(&secondKillEvents).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取滞留的进行中秒杀活动失败", zap.Error(err))
 		return nil, err
 	}
 
 	return secondKillEvents, nil
 }
+
+// ResolveActivityType 根据活动ID判断其属于抽奖还是秒杀活动
+func (l *lotteryDrawDAO) ResolveActivityType(ctx context.Context, activityID int) (string, error) {
+	var lotteryCount, secondKillCount int64
+
+	if err := l.db.WithContext(ctx).
+		Model(&LotteryDraw{}).
+		Where("id = ?", activityID).
+		Count(&lotteryCount).Error; err != nil {
+		l.loggerFrom(ctx).Error("检查抽奖活动是否存在失败", zap.Int("activityID", activityID), zap.Error(err))
+		return "", err
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&SecondKillEvent{}).
+		Where("id = ?", activityID).
+		Count(&secondKillCount).Error; err != nil {
+		l.loggerFrom(ctx).Error("检查秒杀活动是否存在失败", zap.Int("activityID", activityID), zap.Error(err))
+		return "", err
+	}
+
+	switch {
+	case lotteryCount > 0 && secondKillCount > 0:
+		l.loggerFrom(ctx).Warn("活动ID同时存在于抽奖和秒杀活动中，数据可能不一致", zap.Int("activityID", activityID))
+		return "", ErrAmbiguousActivityType
+	case lotteryCount > 0:
+		return domain.ActivityTypeLottery, nil
+	case secondKillCount > 0:
+		return domain.ActivityTypeSecondKill, nil
+	default:
+		return "", ErrActivityNotFound
+	}
+}
+
+// WithdrawParticipation 将参与记录标记为已退出，保留记录用于审计
+// 抽奖活动结束或已开奖后候选名单即冻结，此时退出返回 ErrWithdrawalClosed；已退出的记录重复退出直接返回成功
+// 抽奖活动的参与记录退出成功后同步扣减实时参与人数计数器
+func (l *lotteryDrawDAO) WithdrawParticipation(ctx context.Context, participantID string) error {
+	var participant Participant
+	var withdrawn bool
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", "lottery_id", "withdrawn").
+			Where("id = ?", participantID).
+			First(&participant).Error; err != nil {
+			return err
+		}
+
+		if participant.Withdrawn {
+			return nil
+		}
+
+		if participant.LotteryID != nil {
+			var lotteryDraw LotteryDraw
+
+			// 锁定活动记录，与 DrawWinners 串行，避免开奖过程中候选名单发生变化
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id", "end_time", "drawn_at").
+				Where("id = ?", *participant.LotteryID).
+				Limit(1).
+				Find(&lotteryDraw)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected > 0 && withdrawalClosed(lotteryDraw.EndTime, lotteryDraw.DrawnAt, time.Now().Unix()) {
+				return ErrWithdrawalClosed
+			}
+		}
+
+		result := tx.Model(&Participant{}).
+			Where("id = ? AND withdrawn = ?", participantID, false).
+			Update("withdrawn", true)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		withdrawn = result.RowsAffected > 0
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, ErrWithdrawalClosed) {
+			l.loggerFrom(ctx).Error("退出活动失败", zap.String("participantID", participantID), zap.Error(err))
+		}
+		return err
+	}
+
+	if withdrawn && participant.LotteryID != nil {
+		l.incrLiveParticipantCount(ctx, *participant.LotteryID, -1)
+	}
+
+	return nil
+}
+
+// withdrawalClosed 判断抽奖活动是否已不允许退出：活动已开奖，或已过结束时间（此时状态可能已被定时任务置为完成，但尚未开奖）
+func withdrawalClosed(endTime, drawnAt, now int64) bool {
+	return drawnAt > 0 || now > endTime
+}
+
+// CountActiveParticipants 统计抽奖活动中未退出的参与人数
+func (l *lotteryDrawDAO) CountActiveParticipants(ctx context.Context, activityID int) (int64, error) {
+	var count int64
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("lottery_id = ? AND withdrawn = ?", activityID, false).
+		Count(&count).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计有效参与人数失败", zap.Int("activityID", activityID), zap.Error(err))
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// ListDrawAudits 分页获取抽奖活动的开奖审计记录，按时间倒序排列
+func (l *lotteryDrawDAO) ListDrawAudits(ctx context.Context, activityID int, pagination domain.Pagination) ([]DrawAudit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var audits []DrawAudit
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []DrawAudit{}, nil
+	}
+
+	if err := l.db.WithContext(ctx).
+		Where("activity_id = ?", activityID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&audits).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取开奖审计记录失败", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+
+	return audits, nil
+}
+
+// InstantDraw 即开型抽奖（刮刮卡），用户参与时按中奖概率立即开奖，奖品不足时判定为未中奖
+// 与 AddParticipant 执行相同的参与校验，不满足参与规则时返回对应错误
+func (l *lotteryDrawDAO) InstantDraw(ctx context.Context, activityID int, userID int64, winProbability float64) (bool, Participant, error) {
+	if winProbability < 0 || winProbability > 1 {
+		return false, Participant{}, ErrInvalidWinProbability
+	}
+
+	participant := Participant{
+		ID:             uuid.New().String(),
+		LotteryID:      &activityID,
+		UserID:         userID,
+		ParticipatedAt: time.Now().Unix(),
+	}
+
+	hit := rand.Float64() < winProbability
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := l.checkParticipationAllowed(ctx, tx, participant); err != nil {
+			return err
+		}
+
+		if hit {
+			var prize Prize
+
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("lottery_id = ? AND remaining > 0", activityID).
+				Order("id").
+				First(&prize).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			if err == nil {
+				// 条件扣减库存，确保并发下不会超发
+				result := tx.Model(&Prize{}).
+					Where("id = ? AND remaining > 0", prize.ID).
+					Update("remaining", gorm.Expr("remaining - 1"))
+				if result.Error != nil {
+					return result.Error
+				}
+
+				if result.RowsAffected > 0 {
+					participant.IsWinner = true
+					participant.PrizeID = &prize.ID
+				}
+			}
+		}
+
+		return tx.Create(&participant).Error
+	})
+	if err != nil {
+		if _, rejected := entryRejectionReason(err); !rejected {
+			l.loggerFrom(ctx).Error("即开型抽奖失败", zap.Int("activityID", activityID), zap.Int64("userID", userID), zap.Error(err))
+		}
+		return false, Participant{}, err
+	}
+
+	l.incrLiveParticipantCount(ctx, activityID, 1)
+
+	return participant.IsWinner, participant, nil
+}
+
+// bulkInsertBatchSize 批量插入时每批的记录数
+const bulkInsertBatchSize = 100
+
+// bulkItemError 为批量创建中第 index 个条目的问题附加下标
+func bulkItemError(index int, err error) error {
+	return fmt.Errorf("第 %d 个抽奖活动: %w", index, err)
+}
+
+// BulkCreateLotteryDraws 在同一事务中批量创建抽奖活动，全部条目一并创建或全部不创建
+// 任一条目时间范围或图片地址不合法、与批次内前序条目或已有活动重名时整批不创建，
+// 返回带条目下标的错误，BatchResult 中仅记录该条目
+func (l *lotteryDrawDAO) BulkCreateLotteryDraws(ctx context.Context, models []LotteryDraw) (BatchResult, error) {
+	return l.bulkCreateLotteryDraws(ctx, models, true)
+}
+
+// BulkCreateLotteryDrawsBestEffort 批量创建抽奖活动并逐条报告结果
+// 不合法的条目记为失败，重名的条目记为跳过，不影响其余条目的创建
+func (l *lotteryDrawDAO) BulkCreateLotteryDrawsBestEffort(ctx context.Context, models []LotteryDraw) (BatchResult, error) {
+	return l.bulkCreateLotteryDraws(ctx, models, false)
+}
+
+// bulkCreateLotteryDraws 在同一事务中批量创建抽奖活动
+// 时间范围或图片地址不合法的条目记为失败，与批次内前序条目或已有活动重名的条目记为跳过，其余条目一并创建；
+// atomic 为 true 时任一条目失败或跳过则整批不创建，返回带条目下标的错误
+func (l *lotteryDrawDAO) bulkCreateLotteryDraws(ctx context.Context, models []LotteryDraw, atomic bool) (BatchResult, error) {
+	var result BatchResult
+
+	if len(models) == 0 {
+		return result, nil
+	}
+
+	names := make([]string, 0, len(models))
+	seen := make(map[string]struct{}, len(models))
+	candidates := make([]int, 0, len(models))
+
+	for i, model := range models {
+		if model.StartTime >= model.EndTime {
+			result.fail(i, ErrInvalidTimeWindow)
+			if atomic {
+				return result, bulkItemError(i, ErrInvalidTimeWindow)
+			}
+			continue
+		}
+
+		if err := validateImageURL(model.ImageURL); err != nil {
+			result.fail(i, err)
+			if atomic {
+				return result, bulkItemError(i, err)
+			}
+			continue
+		}
+
+		if _, ok := seen[model.Name]; ok {
+			result.skip(i, ErrDuplicateLotteryDrawName.Error())
+			if atomic {
+				return result, bulkItemError(i, ErrDuplicateLotteryDrawName)
+			}
+			continue
+		}
+
+		if err := ensureDrawSeed(&models[i]); err != nil {
+			return result, err
+		}
+
+		seen[model.Name] = struct{}{}
+		names = append(names, model.Name)
+		candidates = append(candidates, i)
+	}
+
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	var created []int
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []string
+
+		if err := tx.Model(&LotteryDraw{}).
+			Where("name IN ?", names).
+			Pluck("name", &existing).Error; err != nil {
+			return err
+		}
+
+		taken := make(map[string]struct{}, len(existing))
+		for _, name := range existing {
+			taken[name] = struct{}{}
+		}
+
+		toCreate := make([]LotteryDraw, 0, len(candidates))
+		for _, i := range candidates {
+			if _, ok := taken[models[i].Name]; ok {
+				result.skip(i, ErrDuplicateLotteryDrawName.Error())
+				if atomic {
+					return bulkItemError(i, ErrDuplicateLotteryDrawName)
+				}
+				continue
+			}
+
+			toCreate = append(toCreate, models[i])
+			created = append(created, i)
+		}
+
+		if len(toCreate) == 0 {
+			return nil
+		}
+
+		return tx.CreateInBatches(&toCreate, bulkInsertBatchSize).Error
+	})
+	if err != nil {
+		if !errors.Is(err, ErrDuplicateLotteryDrawName) {
+			l.loggerFrom(ctx).Error("批量创建抽奖活动失败", zap.Int("count", len(models)), zap.Error(err))
+		}
+		return result, err
+	}
+
+	result.Succeeded = created
+	for _, i := range created {
+		l.markLotteryDrawNamesExist(models[i].Name)
+	}
+	sort.Slice(result.Skipped, func(i, j int) bool { return result.Skipped[i].Index < result.Skipped[j].Index })
+
+	return result, nil
+}
+
+// ListUserWins 分页获取用户在各抽奖活动中的中奖记录，按参与时间倒序排列
+func (l *lotteryDrawDAO) ListUserWins(ctx context.Context, userID int64, pagination domain.Pagination) ([]WinRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var records []WinRecord
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []WinRecord{}, nil
+	}
+
+	if err := l.db.WithContext(ctx).
+		Table("participants AS p").
+		Select("p.id AS participant_id, p.lottery_id AS activity_id, d.name AS activity_name, "+
+			"p.prize_id AS prize_id, COALESCE(pr.name, '') AS prize_name, p.participated_at AS participated_at").
+		Joins("JOIN lottery_draws AS d ON d.id = p.lottery_id").
+		Joins("LEFT JOIN prizes AS pr ON pr.id = p.prize_id").
+		Where("p.user_id = ? AND p.is_winner = ?", userID, true).
+		Order("p.participated_at DESC, p.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&records).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取用户中奖记录失败", zap.Int64("userID", userID), zap.Error(err))
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// CloneLotteryDraw 以已有抽奖活动为模板复制出新的待开始活动，复制活动配置和奖品，不复制参与者和中奖结果
+func (l *lotteryDrawDAO) CloneLotteryDraw(ctx context.Context, sourceID int, newName string, newStart, newEnd int64) (int, error) {
+	if newStart >= newEnd {
+		return 0, ErrInvalidTimeWindow
+	}
+
+	var clone LotteryDraw
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var source LotteryDraw
+
+		if err := tx.Preload("Prizes").
+			Where("id = ?", sourceID).
+			First(&source).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&LotteryDraw{}).
+			Where("name = ?", newName).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return ErrDuplicateLotteryDrawName
+		}
+
+		// 模板可能是图片地址校验上线前创建的活动，复制时按新建活动的规则重新校验
+		if err := validateImageURL(source.ImageURL); err != nil {
+			return err
+		}
+
+		clone = LotteryDraw{
+			Name:                 newName,
+			Description:          source.Description,
+			ImageURL:             source.ImageURL,
+			StartTime:            newStart,
+			EndTime:              newEnd,
+			Status:               domain.LotteryStatusPending,
+			Category:             source.Category,
+			MinUserLevel:         source.MinUserLevel,
+			MinParticipants:      source.MinParticipants,
+			MaxParticipants:      source.MaxParticipants,
+			MaxEntriesPerUser:    source.MaxEntriesPerUser,
+			EntryCooldownSeconds: source.EntryCooldownSeconds,
+		}
+
+		if err := ensureDrawSeed(&clone); err != nil {
+			return err
+		}
+
+		for _, prize := range source.Prizes {
+			clone.Prizes = append(clone.Prizes, Prize{
+				Name:      prize.Name,
+				Quantity:  prize.Quantity,
+				Remaining: prize.Quantity,
+				Value:     prize.Value,
+			})
+		}
+
+		return tx.Create(&clone).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到作为模板的抽奖活动", zap.Int("sourceID", sourceID))
+			return 0, err
+		}
+		l.loggerFrom(ctx).Error("复制抽奖活动失败", zap.Int("sourceID", sourceID), zap.String("newName", newName), zap.Error(err))
+		return 0, err
+	}
+
+	l.markLotteryDrawNamesExist(newName)
+
+	return clone.ID, nil
+}
+
+// participantMetaFields 允许按其分组的参与元数据字段白名单
+var participantMetaFields = map[string]struct{}{
+	"ip":          {},
+	"device_id":   {},
+	"grace_claim": {},
+}
+
+// GroupParticipantsByMetaField 按元数据字段对抽奖活动的参与者分组，用于发现同一 IP 或设备的可疑参与
+func (l *lotteryDrawDAO) GroupParticipantsByMetaField(ctx context.Context, activityID int, field string) (map[string][]Participant, error) {
+	// 字段名会拼入查询条件，必须经过白名单校验
+	if _, ok := participantMetaFields[field]; !ok {
+		return nil, ErrInvalidMetaField
+	}
+
+	var participants []Participant
+
+	// JSON 函数在各数据库方言间不通用，这里只用 LIKE 粗筛包含该字段名的记录，字段值在反序列化后的元数据中读取
+	if err := l.db.WithContext(ctx).
+		Where("lottery_id = ? AND metadata LIKE ?", activityID, `%"`+field+`"%`).
+		Scopes(orderParticipants).
+		Find(&participants).Error; err != nil {
+		l.loggerFrom(ctx).Error("按元数据字段分组参与者失败", zap.Int("activityID", activityID), zap.String("field", field), zap.Error(err))
+		return nil, err
+	}
+
+	groups := make(map[string][]Participant)
+	for _, p := range participants {
+		if value, ok := p.Metadata[field]; ok {
+			groups[value] = append(groups[value], p)
+		}
+	}
+
+	return groups, nil
+}
+
+// MarkWinners 将外部系统决定的中奖用户标记为中奖，结果中的下标对应 userIDs
+// 未参与活动的用户不会被标记，记为跳过
+func (l *lotteryDrawDAO) MarkWinners(ctx context.Context, activityID int, userIDs []int64) (BatchResult, error) {
+	var result BatchResult
+
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	var found map[int64]struct{}
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var participated []int64
+
+		if err := tx.Model(&Participant{}).
+			Distinct("user_id").
+			Where("lottery_id = ? AND withdrawn = ? AND user_id IN ?", activityID, false, userIDs).
+			Pluck("user_id", &participated).Error; err != nil {
+			return err
+		}
+
+		found = make(map[int64]struct{}, len(participated))
+		for _, id := range participated {
+			found[id] = struct{}{}
+		}
+
+		if len(participated) == 0 {
+			return nil
+		}
+
+		return tx.Model(&Participant{}).
+			Where("lottery_id = ? AND withdrawn = ? AND user_id IN ?", activityID, false, participated).
+			Update("is_winner", true).Error
+	})
+	if err != nil {
+		l.loggerFrom(ctx).Error("批量标记中奖用户失败", zap.Int("activityID", activityID), zap.Int("count", len(userIDs)), zap.Error(err))
+		return result, err
+	}
+
+	for i, id := range userIDs {
+		if _, ok := found[id]; ok {
+			result.Succeeded = append(result.Succeeded, i)
+		} else {
+			result.skip(i, "用户未参与该活动")
+		}
+	}
+
+	return result, nil
+}
+
+// GetNextEligibleActivity 获取用户满足参与条件且尚未参与的、最近即将开始的活动
+func (l *lotteryDrawDAO) GetNextEligibleActivity(ctx context.Context, userID int64, userLevel int, now int64) (ActivitySummary, error) {
+	var candidates []ActivitySummary
+
+	var lottery ActivitySummary
+	lotteryResult := l.db.WithContext(ctx).
+		Model(&LotteryDraw{}).
+		Select("id, ? AS type, name, start_time, end_time, status", domain.ActivityTypeLottery).
+		Where("status = ? AND start_time > ? AND min_user_level <= ?", domain.LotteryStatusPending, now, userLevel).
+		Where("NOT EXISTS (SELECT 1 FROM participants p WHERE p.lottery_id = lottery_draws.id AND p.user_id = ?)", userID).
+		Order("start_time, id").
+		Limit(1).
+		Scan(&lottery)
+	if lotteryResult.Error != nil {
+		l.loggerFrom(ctx).Error("获取即将开始的抽奖活动失败", zap.Int64("userID", userID), zap.Error(lotteryResult.Error))
+		return ActivitySummary{}, lotteryResult.Error
+	}
+	if lotteryResult.RowsAffected > 0 {
+		candidates = append(candidates, lottery)
+	}
+
+	var secondKill ActivitySummary
+	secondKillResult := l.db.WithContext(ctx).
+		Model(&SecondKillEvent{}).
+		Select("id, ? AS type, name, start_time, end_time, status", domain.ActivityTypeSecondKill).
+		Where("status = ? AND start_time > ? AND min_user_level <= ?", domain.SecondKillStatusPending, now, userLevel).
+		Where("NOT EXISTS (SELECT 1 FROM participants p WHERE p.second_kill_id = second_kill_events.id AND p.user_id = ?)", userID).
+		Order("start_time, id").
+		Limit(1).
+		Scan(&secondKill)
+	if secondKillResult.Error != nil {
+		l.loggerFrom(ctx).Error("获取即将开始的秒杀活动失败", zap.Int64("userID", userID), zap.Error(secondKillResult.Error))
+		return ActivitySummary{}, secondKillResult.Error
+	}
+	if secondKillResult.RowsAffected > 0 {
+		candidates = append(candidates, secondKill)
+	}
+
+	if len(candidates) == 0 {
+		return ActivitySummary{}, ErrNoUpcomingActivity
+	}
+
+	next := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.StartTime < next.StartTime {
+			next = c
+		}
+	}
+
+	return next, nil
+}
+
+// CountSecondKillOutcomes 统计结束时间在范围内的已完成秒杀活动中，售罄与未售罄的数量
+func (l *lotteryDrawDAO) CountSecondKillOutcomes(ctx context.Context, fromTs, toTs int64) (int64, int64, error) {
+	var outcome struct {
+		SoldOut          int64 `gorm:"column:sold_out"`
+		ExpiredWithStock int64 `gorm:"column:expired_with_stock"`
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&SecondKillEvent{}).
+		Select("COALESCE(SUM(CASE WHEN sold_count >= stock THEN 1 ELSE 0 END), 0) AS sold_out, "+
+			"COALESCE(SUM(CASE WHEN sold_count < stock THEN 1 ELSE 0 END), 0) AS expired_with_stock").
+		Where("status = ? AND end_time >= ? AND end_time <= ?", domain.SecondKillStatusCompleted, fromTs, toTs).
+		Scan(&outcome).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计秒杀活动售罄情况失败", zap.Int64("fromTs", fromTs), zap.Int64("toTs", toTs), zap.Error(err))
+		return 0, 0, err
+	}
+
+	return outcome.SoldOut, outcome.ExpiredWithStock, nil
+}
+
+// acquireDrawSlot 获取开奖信号量，未配置并发上限时直接返回；等待期间上下文取消或超时则返回其错误
+func (l *lotteryDrawDAO) acquireDrawSlot(ctx context.Context) (func(), error) {
+	if l.drawSem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.drawSem <- struct{}{}:
+		return func() { <-l.drawSem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// checkDrawStatus 校验抽奖活动是否可以开奖：只允许进行中的活动，或已到结束时间被调度任务置为已完成、等待开奖的活动
+// 待开始、已暂停和已取消的活动返回 ErrInvalidStatusTransition
+func checkDrawStatus(status string) error {
+	switch status {
+	case domain.LotteryStatusActive, domain.LotteryStatusCompleted:
+		return nil
+	default:
+		return ErrInvalidStatusTransition
+	}
+}
+
+// DrawWinners 对抽奖活动开奖，从未退出的参与者中随机抽取中奖者并按奖品顺序分配奖品
+// 活动不处于进行中或等待开奖状态时返回 ErrInvalidStatusTransition；
+// 参与人数低于 MinParticipants 时拒绝开奖，返回 ErrBelowMinParticipants；
+// 没有有效参与者时返回 ErrNoParticipants，且不修改活动状态
+func (l *lotteryDrawDAO) DrawWinners(ctx context.Context, activityID int, winnerCount int) ([]Participant, error) {
+	if winnerCount <= 0 {
+		return nil, ErrInvalidWinnerCount
+	}
+
+	release, err := l.acquireDrawSlot(ctx)
+	if err != nil {
+		l.loggerFrom(ctx).Warn("等待开奖名额超时或被取消", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+	defer release()
+
+	var winners []Participant
+	var cancelled bool
+
+	err = l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var lotteryDraw LotteryDraw
+
+		// 锁定活动记录，避免并发重复开奖；跳过 AfterFind 以读取尚未公开的开奖种子
+		if err := tx.Session(&gorm.Session{SkipHooks: true}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", activityID).
+			First(&lotteryDraw).Error; err != nil {
+			return err
+		}
+
+		if err := checkDrawStatus(lotteryDraw.Status); err != nil {
+			return err
+		}
+
+		var drawn int64
+		if err := tx.Model(&Participant{}).
+			Where("lottery_id = ? AND is_winner = ?", activityID, true).
+			Count(&drawn).Error; err != nil {
+			return err
+		}
+
+		if lotteryDraw.DrawnAt > 0 || drawn > 0 {
+			return ErrAlreadyDrawn
+		}
+
+		candidateIDs, err := drawCandidateIDs(tx, activityID)
+		if err != nil {
+			return err
+		}
+
+		if lotteryDraw.MinParticipants > 0 && len(candidateIDs) < lotteryDraw.MinParticipants {
+			if !l.cancelBelowMin {
+				return ErrBelowMinParticipants
+			}
+
+			if err := tx.Model(&LotteryDraw{}).
+				Where("id = ?", activityID).
+				Updates(map[string]interface{}{"status": domain.LotteryStatusCancelled, "cancel_reason": CancelReasonBelowMinParticipants}).Error; err != nil {
+				return err
+			}
+
+			cancelled = true
+			return nil
+		}
+
+		// 没有参与者时不开奖，保持活动状态不变，由运营人员决定延期或取消
+		if len(candidateIDs) == 0 {
+			return ErrNoParticipants
+		}
+
+		// 历史活动创建时没有生成种子，开奖时补充生成，仍可在开奖后复现结果
+		if lotteryDraw.Seed == "" {
+			if err := ensureDrawSeed(&lotteryDraw); err != nil {
+				return err
+			}
+
+			if err := tx.Model(&LotteryDraw{}).
+				Where("id = ?", activityID).
+				Updates(map[string]interface{}{"seed": lotteryDraw.Seed, "seed_hash": lotteryDraw.SeedHash}).Error; err != nil {
+				return err
+			}
+		}
+
+		candidateIDs = selectWinnerIDs(candidateIDs, lotteryDraw.Seed, winnerCount)
+
+		var prizes []Prize
+		if err := tx.Where("lottery_id = ? AND remaining > 0", activityID).
+			Order("id").
+			Find(&prizes).Error; err != nil {
+			return err
+		}
+
+		// 按奖品顺序依次分配，奖品分配完后的中奖者不关联奖品
+		prizeIdx := 0
+		for _, id := range candidateIDs {
+			updates := map[string]interface{}{"is_winner": true}
+
+			for prizeIdx < len(prizes) && prizes[prizeIdx].Remaining == 0 {
+				prizeIdx++
+			}
+
+			if prizeIdx < len(prizes) {
+				updates["prize_id"] = prizes[prizeIdx].ID
+				prizes[prizeIdx].Remaining--
+			}
+
+			if err := tx.Model(&Participant{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, prize := range prizes {
+			if err := tx.Model(&Prize{}).
+				Where("id = ?", prize.ID).
+				Update("remaining", prize.Remaining).Error; err != nil {
+				return err
+			}
+		}
+
+		// drawn_at 与中奖结果在同一事务中写入，开奖种子自此才会被查询返回
+		if err := tx.Model(&LotteryDraw{}).
+			Where("id = ?", activityID).
+			Updates(map[string]interface{}{"status": domain.LotteryStatusCompleted, "drawn_at": time.Now().Unix()}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id IN ?", candidateIDs).
+			Scopes(orderParticipants).
+			Find(&winners).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", activityID))
+			return nil, err
+		}
+		l.loggerFrom(ctx).Error("抽奖活动开奖失败", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+
+	if cancelled {
+		l.loggerFrom(ctx).Info("参与人数不足，抽奖活动已自动取消", zap.Int("activityID", activityID))
+		return nil, ErrBelowMinParticipants
+	}
+
+	return winners, nil
+}
+
+// ListNonWinners 分页获取抽奖活动中未中奖且未退出的参与者，用于发放安慰奖
+// 仅在开奖后才有意义，未开奖时会返回全部未退出的参与者
+func (l *lotteryDrawDAO) ListNonWinners(ctx context.Context, activityID int, pagination domain.Pagination) ([]Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var participants []Participant
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []Participant{}, nil
+	}
+
+	if err := l.db.WithContext(ctx).
+		Where("lottery_id = ? AND (is_winner = ? OR is_winner IS NULL) AND withdrawn = ?", activityID, false, false).
+		Scopes(orderParticipants).
+		Limit(limit).
+		Offset(offset).
+		Find(&participants).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取未中奖参与者失败", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+
+	return participants, nil
+}
+
+// ListWinners 分页获取抽奖活动的中奖者，按参与时间和ID排序
+func (l *lotteryDrawDAO) ListWinners(ctx context.Context, activityID int, pagination domain.Pagination) ([]Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var winners []Participant
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []Participant{}, nil
+	}
+
+	if err := l.db.WithContext(ctx).
+		Where("lottery_id = ? AND is_winner = ?", activityID, true).
+		Scopes(orderParticipants).
+		Limit(limit).
+		Offset(offset).
+		Find(&winners).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取中奖者列表失败", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+
+	return winners, nil
+}
+
+// ReserveSecondKill 为用户预留一份秒杀库存，预留在 expiresAt 前确认才会生成参与记录
+// 与 AddParticipant 执行相同的参与校验，不满足参与规则时返回对应错误
+func (l *lotteryDrawDAO) ReserveSecondKill(ctx context.Context, eventID int, userID int64, expiresAt int64) (SecondKillReservation, error) {
+	reservation := SecondKillReservation{
+		ID:           uuid.New().String(),
+		SecondKillID: eventID,
+		UserID:       userID,
+		Status:       domain.ReservationStatusReserved,
+		ExpiresAt:    expiresAt,
+	}
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := l.checkParticipationAllowed(ctx, tx, Participant{SecondKillID: &eventID, UserID: userID}); err != nil {
+			return err
+		}
+
+		// 条件扣减库存，预留期间库存计入已售数量
+		result := tx.Model(&SecondKillEvent{}).
+			Where("id = ? AND status = ? AND sold_count < stock", eventID, domain.SecondKillStatusActive).
+			Update("sold_count", gorm.Expr("sold_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrSoldOut
+		}
+
+		return tx.Create(&reservation).Error
+	})
+	if err != nil {
+		if _, rejected := entryRejectionReason(err); !rejected && !errors.Is(err, ErrSoldOut) {
+			l.loggerFrom(ctx).Error("预留秒杀库存失败", zap.Int("eventID", eventID), zap.Int64("userID", userID), zap.Error(err))
+		}
+		return SecondKillReservation{}, err
+	}
+
+	return reservation, nil
+}
+
+// ConfirmSecondKillReservation 确认未过期的预留并生成秒杀参与记录
+func (l *lotteryDrawDAO) ConfirmSecondKillReservation(ctx context.Context, reservationID string, now int64) (Participant, error) {
+	var participant Participant
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var reservation SecondKillReservation
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ? AND expires_at >= ?", reservationID, domain.ReservationStatusReserved, now).
+			First(&reservation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrReservationUnavailable
+			}
+			return err
+		}
+
+		if err := tx.Model(&SecondKillReservation{}).
+			Where("id = ?", reservationID).
+			Update("status", domain.ReservationStatusConfirmed).Error; err != nil {
+			return err
+		}
+
+		participant = Participant{
+			ID:             uuid.New().String(),
+			SecondKillID:   &reservation.SecondKillID,
+			UserID:         reservation.UserID,
+			ParticipatedAt: now,
+			Metadata:       map[string]string{"reservation_id": reservation.ID},
+		}
+
+		return tx.Create(&participant).Error
+	})
+	if err != nil {
+		if !errors.Is(err, ErrReservationUnavailable) {
+			l.loggerFrom(ctx).Error("确认秒杀预留失败", zap.String("reservationID", reservationID), zap.Error(err))
+		}
+		return Participant{}, err
+	}
+
+	return participant, nil
+}
+
+// reservationExpireBatchSize 每批回收的过期预留数量，避免一次锁定过大范围
+const reservationExpireBatchSize = 1000
+
+// ExpireStaleReservations 分批将过期的预留标记为已过期并归还库存，返回回收的库存总数
+func (l *lotteryDrawDAO) ExpireStaleReservations(ctx context.Context, now int64) (int64, error) {
+	var total int64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		var reclaimed int64
+
+		err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var stale []SecondKillReservation
+
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id", "second_kill_id").
+				Where("status = ? AND expires_at < ?", domain.ReservationStatusReserved, now).
+				Order("expires_at, id").
+				Limit(reservationExpireBatchSize).
+				Find(&stale).Error; err != nil {
+				return err
+			}
+
+			if len(stale) == 0 {
+				return nil
+			}
+
+			ids := make([]string, 0, len(stale))
+			perEvent := make(map[int]int)
+			for _, r := range stale {
+				ids = append(ids, r.ID)
+				perEvent[r.SecondKillID]++
+			}
+
+			if err := tx.Model(&SecondKillReservation{}).
+				Where("id IN ?", ids).
+				Update("status", domain.ReservationStatusExpired).Error; err != nil {
+				return err
+			}
+
+			for eventID, count := range perEvent {
+				if err := tx.Model(&SecondKillEvent{}).
+					Where("id = ?", eventID).
+					Update("sold_count", gorm.Expr("sold_count - ?", count)).Error; err != nil {
+					return err
+				}
+			}
+
+			reclaimed = int64(len(stale))
+			return nil
+		})
+		if err != nil {
+			l.loggerFrom(ctx).Error("回收过期秒杀预留失败", zap.Int64("reclaimed", total), zap.Error(err))
+			return total, err
+		}
+
+		total += reclaimed
+
+		if reclaimed < reservationExpireBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// GetLotteryDrawForUser 获取抽奖活动（不预加载参与者）以及当前用户是否已参与，已退出的参与记录不算作已参与
+func (l *lotteryDrawDAO) GetLotteryDrawForUser(ctx context.Context, id int, userID int64) (LotteryDraw, bool, error) {
+	var lotteryDraw LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Where("id = ?", id).
+		First(&lotteryDraw).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", id))
+			return LotteryDraw{}, false, err
+		}
+		l.loggerFrom(ctx).Error("获取抽奖活动失败", zap.Error(err))
+		return LotteryDraw{}, false, err
+	}
+
+	var participated bool
+
+	if err := l.db.WithContext(ctx).
+		Raw("SELECT EXISTS (SELECT 1 FROM participants WHERE lottery_id = ? AND user_id = ? AND withdrawn = ?)", id, userID, false).
+		Scan(&participated).Error; err != nil {
+		l.loggerFrom(ctx).Error("检查用户是否已参与抽奖活动失败", zap.Int("ID", id), zap.Int64("userID", userID), zap.Error(err))
+		return LotteryDraw{}, false, err
+	}
+
+	return lotteryDraw, participated, nil
+}
+
+// GetSecondKillFunnel 统计秒杀活动的转化漏斗：浏览 → 预留 → 确认 → 完成购买
+// 浏览次数不在数据库中记录，需由调用方传入
+func (l *lotteryDrawDAO) GetSecondKillFunnel(ctx context.Context, eventID int, views int64) (FunnelStats, error) {
+	stats := FunnelStats{Views: views}
+
+	var reservations struct {
+		Total     int64 `gorm:"column:total"`
+		Confirmed int64 `gorm:"column:confirmed"`
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&SecondKillReservation{}).
+		Select("COUNT(*) AS total, COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0) AS confirmed", domain.ReservationStatusConfirmed).
+		Where("second_kill_id = ?", eventID).
+		Scan(&reservations).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计秒杀预留数据失败", zap.Int("eventID", eventID), zap.Error(err))
+		return FunnelStats{}, err
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("second_kill_id = ?", eventID).
+		Count(&stats.Purchases).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计秒杀购买数据失败", zap.Int("eventID", eventID), zap.Error(err))
+		return FunnelStats{}, err
+	}
+
+	stats.Reservations = reservations.Total
+	stats.Confirmations = reservations.Confirmed
+	if stats.Reservations > 0 {
+		stats.ReservationToConfirmation = float64(stats.Confirmations) / float64(stats.Reservations)
+	}
+
+	return stats, nil
+}
+
+// defaultIterateBatchSize 分批遍历时的默认批大小
+const defaultIterateBatchSize = 500
+
+// IterateParticipants 按 (participated_at, id) 键集分页分批遍历抽奖活动的参与者，内存占用与批大小相关
+// fn 返回错误或上下文取消时停止遍历并返回该错误
+func (l *lotteryDrawDAO) IterateParticipants(ctx context.Context, activityID int, batchSize int, fn func([]Participant) error) error {
+	if batchSize <= 0 {
+		batchSize = defaultIterateBatchSize
+	}
+
+	var last *Participant
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var batch []Participant
+
+		query := l.db.WithContext(ctx).Where("lottery_id = ?", activityID)
+		if last != nil {
+			query = query.Where("(participated_at > ? OR (participated_at = ? AND id > ?))", last.ParticipatedAt, last.ParticipatedAt, last.ID)
+		}
+
+		if err := query.Scopes(orderParticipants).
+			Limit(batchSize).
+			Find(&batch).Error; err != nil {
+			l.loggerFrom(ctx).Error("分批获取参与者失败", zap.Int("activityID", activityID), zap.Error(err))
+			return err
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := fn(batch); err != nil {
+			return err
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+
+		last = &batch[len(batch)-1]
+	}
+}
+
+// ParticipationByHourOfDay 按参与时间的小时（UTC）统计抽奖活动的参与次数
+func (l *lotteryDrawDAO) ParticipationByHourOfDay(ctx context.Context, activityID int) ([24]int64, error) {
+	var hours [24]int64
+	var rows []struct {
+		Hour  int   `gorm:"column:hour"`
+		Count int64 `gorm:"column:count"`
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("FLOOR((participated_at % ?) / 3600) AS hour, COUNT(*) AS count", secondsPerDay).
+		Where("lottery_id = ?", activityID).
+		Group("hour").
+		Scan(&rows).Error; err != nil {
+		l.loggerFrom(ctx).Error("按小时统计参与次数失败", zap.Int("activityID", activityID), zap.Error(err))
+		return hours, err
+	}
+
+	for _, row := range rows {
+		if row.Hour >= 0 && row.Hour < len(hours) {
+			hours[row.Hour] = row.Count
+		}
+	}
+
+	return hours, nil
+}
+
+// PauseActivity 暂停进行中的活动，暂停期间不接受新的参与，活动类型由 ResolveActivityType 确定
+func (l *lotteryDrawDAO) PauseActivity(ctx context.Context, id int) error {
+	return l.transitionActivityStatus(ctx, id, domain.LotteryStatusActive, domain.LotteryStatusPaused)
+}
+
+// ResumeActivity 恢复已暂停的活动，活动类型由 ResolveActivityType 确定
+func (l *lotteryDrawDAO) ResumeActivity(ctx context.Context, id int) error {
+	return l.transitionActivityStatus(ctx, id, domain.LotteryStatusPaused, domain.LotteryStatusActive)
+}
+
+// activityModel 返回活动类型对应的数据库模型，用于按类型更新活动记录
+func activityModel(activityType string) (interface{}, error) {
+	switch activityType {
+	case domain.ActivityTypeLottery:
+		return &LotteryDraw{}, nil
+	case domain.ActivityTypeSecondKill:
+		return &SecondKillEvent{}, nil
+	default:
+		return nil, fmt.Errorf("未知的活动类型 %q", activityType)
+	}
+}
+
+// transitionActivityStatus 仅当活动处于 from 状态时将其更新为 to 状态
+func (l *lotteryDrawDAO) transitionActivityStatus(ctx context.Context, id int, from, to string) error {
+	activityType, err := l.ResolveActivityType(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	model, err := activityModel(activityType)
+	if err != nil {
+		return err
+	}
+
+	result := l.db.WithContext(ctx).
+		Model(model).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+	if result.Error != nil {
+		l.loggerFrom(ctx).Error("更新活动状态失败", zap.String("activityType", activityType), zap.Int("ID", id), zap.String("status", to), zap.Error(result.Error))
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrInvalidStatusTransition
+	}
+
+	return nil
+}
+
+// checkClaimAllowed 校验 userLevel 等级的用户在 now 时刻能否抢购秒杀活动，ClaimSecondKill 与 ClaimSecondKillCached 共用该判定
+// 参与规则由 evaluateParticipation 判定，此外结束时间之后的宽限期内仍接受抢购（此时活动可能已被状态任务置为已完成），
+// inGrace 表示本次抢购是否处于宽限期
+func checkClaimAllowed(event SecondKillEvent, userLevel int, now int64) (inGrace bool, err error) {
+	rules := participationRules{
+		Status:       event.Status,
+		Locked:       event.ParticipationLocked,
+		MinUserLevel: event.MinUserLevel,
+	}
+
+	inGrace = now > event.EndTime
+	if inGrace {
+		if !rules.Locked && now > event.EndTime+int64(event.GracePeriodSeconds) {
+			return false, ErrEventEnded
+		}
+
+		// 宽限期内已完成的活动按进行中判定
+		if rules.Status == domain.SecondKillStatusCompleted {
+			rules.Status = domain.SecondKillStatusActive
+		}
+	}
+
+	if err := evaluateParticipation(rules, participationState{}, false, userLevel, now); err != nil {
+		return false, err
+	}
+
+	return inGrace, nil
+}
+
+// ClaimSecondKill 用户直接抢购秒杀活动，在同一事务中校验参与规则、扣减库存并生成参与记录
+// 每个用户在同一活动中只能抢购一次，已有未退出的参与记录时返回 ErrAlreadyClaimed
+// 活动结束后 GracePeriodSeconds 秒内的抢购仍会被接受并标记为宽限期抢购，超出宽限期返回 ErrEventEnded
+func (l *lotteryDrawDAO) ClaimSecondKill(ctx context.Context, eventID int, userID int64, now int64) (Participant, error) {
+	participant := Participant{
+		ID:             uuid.New().String(),
+		SecondKillID:   &eventID,
+		UserID:         userID,
+		ParticipatedAt: now,
+	}
+
+	var txOpts []*sql.TxOptions
+	if l.claimIsolation != sql.LevelDefault {
+		txOpts = append(txOpts, &sql.TxOptions{Isolation: l.claimIsolation})
+	}
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var event SecondKillEvent
+
+		// 锁定活动行，使并发抢购在校验和扣减库存期间串行执行；不支持行锁的方言（如 SQLite）会忽略该子句
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status", "end_time", "grace_period_seconds", "participation_locked", "min_user_level").
+			Where("id = ?", eventID).
+			First(&event).Error; err != nil {
+			return err
+		}
+
+		userLevel, err := resolveUserLevel(ctx, l.userLevel, userID, event.MinUserLevel)
+		if err != nil {
+			return err
+		}
+
+		inGrace, err := checkClaimAllowed(event, userLevel, now)
+		if err != nil {
+			return err
+		}
+
+		// 活动行已锁定，同一用户的并发抢购在此串行，不会重复生成参与记录
+		var claimed int64
+		if err := tx.Model(&Participant{}).
+			Where("second_kill_id = ? AND user_id = ? AND withdrawn = ?", eventID, userID, false).
+			Count(&claimed).Error; err != nil {
+			return err
+		}
+
+		if claimed > 0 {
+			return ErrAlreadyClaimed
+		}
+
+		// 条件扣减库存，确保并发下不会超卖
+		result := tx.Model(&SecondKillEvent{}).
+			Where("id = ? AND status = ? AND sold_count < stock", eventID, event.Status).
+			Update("sold_count", gorm.Expr("sold_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrSoldOut
+		}
+
+		// 宽限期内的抢购在元数据中单独标记，便于统计
+		if inGrace {
+			participant.Metadata = map[string]string{"grace_claim": "true"}
+		}
+
+		return tx.Create(&participant).Error
+	}, txOpts...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的秒杀活动", zap.Int("ID", eventID))
+		} else {
+			l.loggerFrom(ctx).Error("抢购秒杀活动失败", zap.Int("eventID", eventID), zap.Int64("userID", userID), zap.Error(err))
+		}
+		return Participant{}, err
+	}
+
+	return participant, nil
+}
+
+// liveParticipantCountKeyPrefix 实时参与人数计数器的键前缀
+const liveParticipantCountKeyPrefix = "linkme:lottery_draw:participant_count:"
+
+// liveParticipantCountTTL 计数器过期时间，过期后下次读取会从数据库重新加载以纠正偏差
+const liveParticipantCountTTL = 10 * time.Minute
+
+// incrLiveParticipantScript 仅在计数器已存在时增减，避免缓存缺失时从 0 开始计数
+var incrLiveParticipantScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return nil
+`)
+
+func liveParticipantCountKey(activityID int) string {
+	return fmt.Sprintf("%s%d", liveParticipantCountKeyPrefix, activityID)
+}
+
+// incrLiveParticipantCount 更新实时参与人数计数器，失败时仅记录日志，由定期校准纠正
+func (l *lotteryDrawDAO) incrLiveParticipantCount(ctx context.Context, activityID int, delta int64) {
+	if l.redis == nil {
+		return
+	}
+
+	err := incrLiveParticipantScript.Run(ctx, l.redis, []string{liveParticipantCountKey(activityID)}, delta).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		l.loggerFrom(ctx).Warn("更新实时参与人数失败", zap.Int("activityID", activityID), zap.Error(err))
+	}
+}
+
+// GetLiveParticipantCount 获取抽奖活动的实时参与人数
+// 优先读取 Redis 计数器，未命中时回源数据库统计并回填；未配置 Redis 时直接查询数据库
+func (l *lotteryDrawDAO) GetLiveParticipantCount(ctx context.Context, activityID int) (int64, error) {
+	if l.redis == nil {
+		return l.CountActiveParticipants(ctx, activityID)
+	}
+
+	key := liveParticipantCountKey(activityID)
+
+	count, err := l.redis.Get(ctx, key).Int64()
+	if err == nil {
+		return count, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		l.loggerFrom(ctx).Warn("读取实时参与人数失败，回源数据库", zap.Int("activityID", activityID), zap.Error(err))
+	}
+
+	count, err = l.CountActiveParticipants(ctx, activityID)
+	if err != nil {
+		return 0, err
+	}
+
+	// 仅在键不存在时回填，避免覆盖并发写入后的更新值
+	if err := l.redis.SetNX(ctx, key, count, liveParticipantCountTTL).Err(); err != nil {
+		l.loggerFrom(ctx).Warn("回填实时参与人数失败", zap.Int("activityID", activityID), zap.Error(err))
+	}
+
+	return count, nil
+}
+
+// ReconcileLiveParticipantCounts 使用数据库统计结果校准所有进行中抽奖活动的实时参与人数，
+// 供定时任务周期调用以纠正计数偏差；未配置 Redis 时不做任何处理
+func (l *lotteryDrawDAO) ReconcileLiveParticipantCounts(ctx context.Context, now int64) error {
+	if l.redis == nil {
+		return nil
+	}
+
+	var ids []int
+
+	if err := l.db.WithContext(ctx).
+		Model(&LotteryDraw{}).
+		Where("status = ? AND start_time <= ? AND end_time >= ?", domain.LotteryStatusActive, now, now).
+		Pluck("id", &ids).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取待校准的抽奖活动失败", zap.Error(err))
+		return err
+	}
+
+	for _, id := range ids {
+		count, err := l.CountActiveParticipants(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := l.redis.Set(ctx, liveParticipantCountKey(id), count, liveParticipantCountTTL).Err(); err != nil {
+			l.loggerFrom(ctx).Error("校准实时参与人数失败", zap.Int("activityID", id), zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListJoinableActivitiesForUser 获取用户满足条件但尚未参与的进行中活动，包含抽奖和秒杀两类，
+// 按结束时间升序排列，即将结束的活动优先，最多返回 limit 条
+// 抽奖活动的筛选条件是 evaluateParticipation 的 SQL 等价形式，两者需同步修改；
+// 用户在候选活动中没有未退出的参与记录，每用户参与次数上限因此总是满足，无需单独筛选
+func (l *lotteryDrawDAO) ListJoinableActivitiesForUser(ctx context.Context, userID int64, userLevel int, now int64, limit int) ([]ActivitySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return []ActivitySummary{}, nil
+	}
+
+	var lotteries []ActivitySummary
+	if err := l.db.WithContext(ctx).
+		Model(&LotteryDraw{}).
+		Select("id, ? AS type, name, start_time, end_time, status", domain.ActivityTypeLottery).
+		Where("status = ? AND participation_locked = ? AND min_user_level <= ?", domain.LotteryStatusActive, false, userLevel).
+		Where("(CASE WHEN entry_start_time = 0 THEN start_time ELSE entry_start_time END) <= ?", now).
+		Where("(CASE WHEN entry_end_time = 0 THEN end_time ELSE entry_end_time END) >= ?", now).
+		Where("max_participants = 0 OR (SELECT COUNT(*) FROM participants c WHERE c.lottery_id = lottery_draws.id AND c.withdrawn = ?) < max_participants", false).
+		Where("entry_cooldown_seconds = 0 OR NOT EXISTS (SELECT 1 FROM participants r WHERE r.lottery_id = lottery_draws.id AND r.user_id = ? AND r.participated_at > 0 AND r.participated_at + entry_cooldown_seconds > ?)", userID, now).
+		Where("NOT EXISTS (SELECT 1 FROM participants p WHERE p.lottery_id = lottery_draws.id AND p.user_id = ? AND p.withdrawn = ?)", userID, false).
+		Order("end_time, id").
+		Limit(limit).
+		Scan(&lotteries).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取用户可参与的抽奖活动失败", zap.Int64("userID", userID), zap.Error(err))
+		return nil, err
+	}
+
+	var secondKills []ActivitySummary
+	if err := l.db.WithContext(ctx).
+		Model(&SecondKillEvent{}).
+		Select("id, ? AS type, name, start_time, end_time, status", domain.ActivityTypeSecondKill).
+		Where("status = ? AND participation_locked = ? AND start_time <= ? AND end_time >= ? AND min_user_level <= ? AND sold_count < stock", domain.SecondKillStatusActive, false, now, now, userLevel).
+		Where("NOT EXISTS (SELECT 1 FROM participants p WHERE p.second_kill_id = second_kill_events.id AND p.user_id = ? AND p.withdrawn = ?)", userID, false).
+		Order("end_time, id").
+		Limit(limit).
+		Scan(&secondKills).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取用户可参与的秒杀活动失败", zap.Int64("userID", userID), zap.Error(err))
+		return nil, err
+	}
+
+	activities := append(lotteries, secondKills...)
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].EndTime < activities[j].EndTime
+	})
+
+	if len(activities) > limit {
+		activities = activities[:limit]
+	}
+
+	return activities, nil
+}
+
+// GetTotalAwardedValue 统计抽奖活动中已分配给中奖者的奖品总价值，没有已发放奖品时返回 0
+func (l *lotteryDrawDAO) GetTotalAwardedValue(ctx context.Context, activityID int) (int64, error) {
+	var total int64
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("COALESCE(SUM(prizes.value), 0)").
+		Joins("JOIN prizes ON prizes.id = participants.prize_id").
+		Where("participants.lottery_id = ? AND participants.is_winner = ?", activityID, true).
+		Scan(&total).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计已发放奖品总价值失败", zap.Int("activityID", activityID), zap.Error(err))
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// ListLotteryDrawsModifiedSince 分页获取 since 之后有更新的抽奖活动，按更新时间升序排列，用于增量同步
+func (l *lotteryDrawDAO) ListLotteryDrawsModifiedSince(ctx context.Context, since int64, pagination domain.Pagination) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var lotteryDraws []LotteryDraw
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDraw{}, nil
+	}
+
+	if err := l.db.WithContext(ctx).
+		Preload("Participants", orderParticipants).
+		Where("updated_at > ?", since).
+		Order("updated_at, id").
+		Limit(limit).
+		Offset(offset).
+		Find(&lotteryDraws).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取增量更新的抽奖活动失败", zap.Int64("since", since), zap.Error(err))
+		return nil, err
+	}
+
+	return lotteryDraws, nil
+}
+
+// SwapWinner 将抽奖活动的中奖者手动替换为指定参与者，并转移其奖品
+// 被替换者必须是该活动的中奖者，替补者必须是该活动中未中奖且未退出的参与者，操作人从上下文中获取并写入审计记录
+func (l *lotteryDrawDAO) SwapWinner(ctx context.Context, activityID int, oldParticipantID, newParticipantID string) error {
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var oldWinner Participant
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND lottery_id = ? AND is_winner = ?", oldParticipantID, activityID, true).
+			First(&oldWinner).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrParticipantNotWinner
+			}
+			return err
+		}
+
+		var replacement Participant
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND lottery_id = ? AND is_winner = ? AND withdrawn = ?", newParticipantID, activityID, false, false).
+			First(&replacement).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidReplacementWinner
+			}
+			return err
+		}
+
+		if err := tx.Model(&Participant{}).
+			Where("id = ?", oldParticipantID).
+			Updates(map[string]interface{}{"is_winner": false, "prize_id": nil}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Participant{}).
+			Where("id = ?", newParticipantID).
+			Updates(map[string]interface{}{"is_winner": true, "prize_id": oldWinner.PrizeID}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&DrawAudit{
+			ActivityID:     activityID,
+			Actor:          actorFrom(ctx),
+			Action:         DrawAuditActionSwapWinner,
+			ParticipantIDs: []string{oldParticipantID, newParticipantID},
+		}).Error
+	})
+	if err != nil {
+		l.loggerFrom(ctx).Error("替换中奖者失败",
+			zap.Int("activityID", activityID),
+			zap.String("oldParticipantID", oldParticipantID),
+			zap.String("newParticipantID", newParticipantID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// TopParticipantsByEntries 获取抽奖活动中有效参与次数最多的前 topN 个用户，次数相同时用户ID小的优先
+func (l *lotteryDrawDAO) TopParticipantsByEntries(ctx context.Context, activityID int, topN int) ([]UserEntryCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if topN <= 0 {
+		return []UserEntryCount{}, nil
+	}
+
+	var counts []UserEntryCount
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("user_id, COUNT(*) AS entries").
+		Where("lottery_id = ? AND withdrawn = ?", activityID, false).
+		Group("user_id").
+		Order("entries DESC, user_id").
+		Limit(topN).
+		Scan(&counts).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取参与次数排行失败", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// GetLotteryDrawsByNames 根据名称批量获取抽奖活动，结果以名称为键，不存在的名称不会出现在结果中
+// 名称重复时保留ID最小的活动
+func (l *lotteryDrawDAO) GetLotteryDrawsByNames(ctx context.Context, names []string) (map[string]LotteryDraw, error) {
+	result := make(map[string]LotteryDraw, len(names))
+	if len(names) == 0 {
+		return result, nil
+	}
+
+	var lotteryDraws []LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Preload("Participants", orderParticipants).
+		Where("name IN ?", names).
+		Order("id").
+		Find(&lotteryDraws).Error; err != nil {
+		l.loggerFrom(ctx).Error("根据名称批量获取抽奖活动失败", zap.Strings("names", names), zap.Error(err))
+		return nil, err
+	}
+
+	for _, draw := range lotteryDraws {
+		if _, ok := result[draw.Name]; !ok {
+			result[draw.Name] = draw
+		}
+	}
+
+	return result, nil
+}
+
+// GetPrizeWinnerCounts 统计抽奖活动中每个奖品已分配的中奖人数，以奖品ID为键，可与 Prize.Quantity 对比核验
+func (l *lotteryDrawDAO) GetPrizeWinnerCounts(ctx context.Context, activityID int) (map[int]int64, error) {
+	var rows []struct {
+		PrizeID int   `gorm:"column:prize_id"`
+		Count   int64 `gorm:"column:count"`
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("prize_id, COUNT(*) AS count").
+		Where("lottery_id = ? AND is_winner = ? AND prize_id IS NOT NULL", activityID, true).
+		Group("prize_id").
+		Scan(&rows).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计奖品中奖人数失败", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.PrizeID] = row.Count
+	}
+
+	return counts, nil
+}
+
+// FilterUserJoinedActivities 从给定的抽奖活动ID中筛选出用户已参与（未退出）的活动ID，按ID升序返回
+func (l *lotteryDrawDAO) FilterUserJoinedActivities(ctx context.Context, userID int64, activityIDs []int) ([]int, error) {
+	if len(activityIDs) == 0 {
+		return []int{}, nil
+	}
+
+	var joined []int
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Distinct("lottery_id").
+		Where("user_id = ? AND lottery_id IN ? AND withdrawn = ?", userID, activityIDs, false).
+		Order("lottery_id").
+		Pluck("lottery_id", &joined).Error; err != nil {
+		l.loggerFrom(ctx).Error("筛选用户已参与的活动失败", zap.Int64("userID", userID), zap.Ints("activityIDs", activityIDs), zap.Error(err))
+		return nil, err
+	}
+
+	return joined, nil
+}
+
+// ListTrendingActivities 获取 sinceTs 以来参与次数最多的前 limit 个进行中活动，包含抽奖和秒杀两类，在 now 之前已结束的活动不参与排序
+func (l *lotteryDrawDAO) ListTrendingActivities(ctx context.Context, sinceTs int64, limit int, now int64) ([]ActivitySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return []ActivitySummary{}, nil
+	}
+
+	type trendingActivity struct {
+		ActivitySummary
+		Entries int64 `gorm:"column:entries"`
+	}
+
+	var lotteries []trendingActivity
+	if err := l.db.WithContext(ctx).
+		Table("lottery_draws AS a").
+		Select("a.id, ? AS type, a.name, a.start_time, a.end_time, a.status, COUNT(p.id) AS entries", domain.ActivityTypeLottery).
+		Joins("JOIN participants p ON p.lottery_id = a.id AND p.participated_at >= ? AND p.withdrawn = ?", sinceTs, false).
+		Where("a.status = ? AND a.end_time >= ?", domain.LotteryStatusActive, now).
+		Group("a.id, a.name, a.start_time, a.end_time, a.status").
+		Order("entries DESC, a.id").
+		Limit(limit).
+		Scan(&lotteries).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取热门抽奖活动失败", zap.Int64("sinceTs", sinceTs), zap.Error(err))
+		return nil, err
+	}
+
+	var secondKills []trendingActivity
+	if err := l.db.WithContext(ctx).
+		Table("second_kill_events AS a").
+		Select("a.id, ? AS type, a.name, a.start_time, a.end_time, a.status, COUNT(p.id) AS entries", domain.ActivityTypeSecondKill).
+		Joins("JOIN participants p ON p.second_kill_id = a.id AND p.participated_at >= ? AND p.withdrawn = ?", sinceTs, false).
+		Where("a.status = ? AND a.end_time >= ?", domain.SecondKillStatusActive, now).
+		Group("a.id, a.name, a.start_time, a.end_time, a.status").
+		Order("entries DESC, a.id").
+		Limit(limit).
+		Scan(&secondKills).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取热门秒杀活动失败", zap.Int64("sinceTs", sinceTs), zap.Error(err))
+		return nil, err
+	}
+
+	trending := append(lotteries, secondKills...)
+	sort.SliceStable(trending, func(i, j int) bool {
+		return trending[i].Entries > trending[j].Entries
+	})
+
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+
+	activities := make([]ActivitySummary, 0, len(trending))
+	for _, t := range trending {
+		activities = append(activities, t.ActivitySummary)
+	}
+
+	return activities, nil
+}
+
+// GetParticipantRank 获取参与记录在抽奖活动中的参与名次，参与时间相同时按ID排序，名次从 1 开始
+// 已退出的参与记录不计入名次；参与记录不属于该活动或已退出时返回 gorm.ErrRecordNotFound
+func (l *lotteryDrawDAO) GetParticipantRank(ctx context.Context, activityID int, participantID string) (int64, error) {
+	var participant Participant
+
+	if err := l.db.WithContext(ctx).
+		Select("id", "participated_at").
+		Where("id = ? AND lottery_id = ? AND withdrawn = ?", participantID, activityID, false).
+		First(&participant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到活动中的参与记录", zap.Int("activityID", activityID), zap.String("participantID", participantID))
+		} else {
+			l.loggerFrom(ctx).Error("获取参与记录失败", zap.Int("activityID", activityID), zap.String("participantID", participantID), zap.Error(err))
+		}
+		return 0, err
+	}
+
+	var before int64
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("lottery_id = ? AND withdrawn = ?", activityID, false).
+		Where("participated_at < ? OR (participated_at = ? AND id < ?)", participant.ParticipatedAt, participant.ParticipatedAt, participant.ID).
+		Count(&before).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计参与名次失败", zap.Int("activityID", activityID), zap.String("participantID", participantID), zap.Error(err))
+		return 0, err
+	}
+
+	return before + 1, nil
+}
+
+// CountDistinctParticipatingUsers 统计时间范围内参与过任意活动的去重用户数
+func (l *lotteryDrawDAO) CountDistinctParticipatingUsers(ctx context.Context, fromTs, toTs int64) (int64, error) {
+	var count int64
+
+	// 时间范围条件走 idx_participated_at 索引
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("COUNT(DISTINCT user_id)").
+		Where("participated_at >= ? AND participated_at <= ?", fromTs, toTs).
+		Scan(&count).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计参与用户数失败", zap.Int64("fromTs", fromTs), zap.Int64("toTs", toTs), zap.Error(err))
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// SetPrizeRemaining 手动调整奖品剩余数量，用于实物奖品数量与计划不符时的库存修正
+// 剩余数量必须在 [0, Quantity] 范围内，调整前后的数量会记录日志用于审计
+func (l *lotteryDrawDAO) SetPrizeRemaining(ctx context.Context, prizeID int, remaining int) error {
+	if remaining < 0 {
+		return ErrInvalidPrizeRemaining
+	}
+
+	var previous int
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var prize Prize
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", prizeID).
+			First(&prize).Error; err != nil {
+			return err
+		}
+
+		if remaining > prize.Quantity {
+			return ErrInvalidPrizeRemaining
+		}
+
+		previous = prize.Remaining
+
+		return tx.Model(&Prize{}).
+			Where("id = ?", prizeID).
+			Update("remaining", remaining).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			l.warnNotFound(ctx, "未找到指定ID的奖品", zap.Int("prizeID", prizeID))
+		case errors.Is(err, ErrInvalidPrizeRemaining):
+		default:
+			l.loggerFrom(ctx).Error("调整奖品剩余数量失败", zap.Int("prizeID", prizeID), zap.Int("remaining", remaining), zap.Error(err))
+		}
+		return err
+	}
+
+	l.loggerFrom(ctx).Info("奖品剩余数量已手动调整",
+		zap.Int("prizeID", prizeID),
+		zap.Int("previous", previous),
+		zap.Int("remaining", remaining),
+		zap.Int64("actor", actorFrom(ctx)))
+
+	return nil
+}
+
+// ListActivitiesNeedingDraw 获取已结束但尚未完成或取消的抽奖活动，作为运营人员的待开奖队列
+// 结果按结束时间升序排列，逾期最久的活动排在最前面
+func (l *lotteryDrawDAO) ListActivitiesNeedingDraw(ctx context.Context, now int64, pagination domain.Pagination) ([]LotteryDrawSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDrawSummary{}, nil
+	}
+
+	var summaries []LotteryDrawSummary
+
+	if err := l.db.WithContext(ctx).
+		Table("lottery_draws AS a").
+		Select("a.id, a.name, a.start_time, a.end_time, a.status, "+
+			"COUNT(p.id) AS participant_count, "+
+			"MAX(CASE WHEN p.is_winner = ? THEN 1 ELSE 0 END) AS has_winners", true).
+		Joins("LEFT JOIN participants p ON p.lottery_id = a.id AND p.withdrawn = ?", false).
+		Where("a.end_time < ? AND a.status NOT IN ?", now, []string{domain.LotteryStatusCompleted, domain.LotteryStatusCancelled}).
+		Group("a.id, a.name, a.start_time, a.end_time, a.status").
+		Order("a.end_time, a.id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&summaries).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取待开奖抽奖活动失败", zap.Int64("now", now), zap.Error(err))
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// ensureDrawSeed 为尚未设置种子的抽奖活动生成随机开奖种子及其摘要
+func ensureDrawSeed(model *LotteryDraw) error {
+	if model.Seed != "" {
+		return nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := crand.Read(buf); err != nil {
+		return err
+	}
+
+	model.Seed = hex.EncodeToString(buf)
+	model.SeedHash = hashDrawSeed(model.Seed)
+
+	return nil
+}
+
+// hashDrawSeed 计算开奖种子的 SHA-256 摘要（十六进制）
+func hashDrawSeed(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// selectWinnerIDs 使用开奖种子对候选参与记录进行确定性洗牌，返回前 winnerCount 个作为中奖者
+// candidateIDs 需按 orderParticipants 排序，相同的种子和候选列表总是得到相同的结果
+func selectWinnerIDs(candidateIDs []string, seed string, winnerCount int) []string {
+	sum := sha256.Sum256([]byte(seed))
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+
+	rng.Shuffle(len(candidateIDs), func(i, j int) {
+		candidateIDs[i], candidateIDs[j] = candidateIDs[j], candidateIDs[i]
+	})
+
+	if winnerCount < len(candidateIDs) {
+		candidateIDs = candidateIDs[:winnerCount]
+	}
+
+	return candidateIDs
+}
+
+// drawCandidateIDs 获取参与开奖的候选参与记录ID，按 orderParticipants 排序，即洗牌的输入顺序
+func drawCandidateIDs(db *gorm.DB, activityID int) ([]string, error) {
+	var candidateIDs []string
+
+	err := db.Model(&Participant{}).
+		Where("lottery_id = ? AND withdrawn = ?", activityID, false).
+		Scopes(orderParticipants).
+		Pluck("id", &candidateIDs).Error
+
+	return candidateIDs, err
+}
+
+// FairnessProof 抽奖活动的公平性证明，包含复现开奖结果所需的全部输入
+type FairnessProof struct {
+	ActivityID     int      `json:"activity_id"`     // 抽奖活动ID
+	Seed           string   `json:"seed"`            // 开奖种子
+	SeedHash       string   `json:"seed_hash"`       // 开奖前公开的种子 SHA-256 摘要
+	Algorithm      string   `json:"algorithm"`       // 抽选算法说明
+	ParticipantIDs []string `json:"participant_ids"` // 候选参与记录ID，顺序即洗牌的输入顺序
+	WinnerIDs      []string `json:"winner_ids"`      // 中奖参与记录ID，按参与时间和ID排序
+}
+
+// fairnessAlgorithm 描述 selectWinnerIDs 的抽选算法，供审计方独立复现
+const fairnessAlgorithm = "取 SHA-256(seed) 前 8 字节按大端序转为 int64，作为 Go math/rand.NewSource 的种子，" +
+	"对 participant_ids 执行 rand.Shuffle，取前 len(winner_ids) 个作为中奖者"
+
+// loadFairnessProof 加载已开奖抽奖活动的公平性证明，活动未开奖或缺少种子时返回 ErrDrawNotVerifiable
+func (l *lotteryDrawDAO) loadFairnessProof(ctx context.Context, activityID int) (FairnessProof, error) {
+	var lotteryDraw LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Select("id", "drawn_at", "seed", "seed_hash").
+		Where("id = ?", activityID).
+		First(&lotteryDraw).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", activityID))
+		} else {
+			l.loggerFrom(ctx).Error("获取抽奖活动失败", zap.Int("activityID", activityID), zap.Error(err))
+		}
+		return FairnessProof{}, err
+	}
+
+	if lotteryDraw.DrawnAt == 0 || lotteryDraw.Seed == "" {
+		return FairnessProof{}, ErrDrawNotVerifiable
+	}
+
+	candidateIDs, err := drawCandidateIDs(l.db.WithContext(ctx), activityID)
+	if err != nil {
+		l.loggerFrom(ctx).Error("获取抽奖候选参与者失败", zap.Int("activityID", activityID), zap.Error(err))
+		return FairnessProof{}, err
+	}
+
+	var winnerIDs []string
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("lottery_id = ? AND is_winner = ?", activityID, true).
+		Scopes(orderParticipants).
+		Pluck("id", &winnerIDs).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取中奖者失败", zap.Int("activityID", activityID), zap.Error(err))
+		return FairnessProof{}, err
+	}
+
+	return FairnessProof{
+		ActivityID:     activityID,
+		Seed:           lotteryDraw.Seed,
+		SeedHash:       lotteryDraw.SeedHash,
+		Algorithm:      fairnessAlgorithm,
+		ParticipantIDs: append([]string{}, candidateIDs...),
+		WinnerIDs:      append([]string{}, winnerIDs...),
+	}, nil
+}
+
+// VerifyDrawFairness 使用已公开的开奖种子重新执行抽选，校验持久化的中奖者是否与复现结果一致
+// 种子与摘要不匹配或中奖者不一致时返回 false；活动未开奖或缺少种子时返回 ErrDrawNotVerifiable
+// 注意：开奖后退出的参与者或通过 SwapWinner 替换的中奖者都会导致校验不通过
+func (l *lotteryDrawDAO) VerifyDrawFairness(ctx context.Context, activityID int) (bool, error) {
+	proof, err := l.loadFairnessProof(ctx, activityID)
+	if err != nil {
+		return false, err
+	}
+
+	if !verifyFairnessProof(proof) {
+		l.loggerFrom(ctx).Warn("抽奖活动公平性校验未通过", zap.Int("activityID", activityID))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// verifyFairnessProof 校验种子与摘要一致，且按种子复现的中奖者与证明中的中奖者相同
+func verifyFairnessProof(proof FairnessProof) bool {
+	if hashDrawSeed(proof.Seed) != proof.SeedHash {
+		return false
+	}
+
+	candidateIDs := append([]string{}, proof.ParticipantIDs...)
+
+	return sameWinnerIDs(selectWinnerIDs(candidateIDs, proof.Seed, len(proof.WinnerIDs)), proof.WinnerIDs)
+}
+
+// ExportFairnessProof 将已开奖抽奖活动的公平性证明以 JSON 格式写入 w，供审计方独立复现开奖结果
+// 候选参与者的顺序与开奖时洗牌的输入顺序完全一致；活动未开奖或缺少种子时返回 ErrDrawNotVerifiable
+func (l *lotteryDrawDAO) ExportFairnessProof(ctx context.Context, activityID int, w io.Writer) error {
+	proof, err := l.loadFairnessProof(ctx, activityID)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(proof); err != nil {
+		l.loggerFrom(ctx).Error("导出公平性证明失败", zap.Int("activityID", activityID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// sameWinnerIDs 判断两组中奖参与记录ID是否相同，不考虑顺序
+func sameWinnerIDs(expected, actual []string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+
+	set := make(map[string]struct{}, len(expected))
+	for _, id := range expected {
+		set[id] = struct{}{}
+	}
+
+	for _, id := range actual {
+		if _, ok := set[id]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ListUserSecondKillClaims 获取用户成功抢购的秒杀参与记录，按抢购时间倒序排列，用于用户的购买历史
+// 只有直接抢购成功或预留确认后才会生成参与记录，过期的预留和已退款的记录不会出现在结果中
+func (l *lotteryDrawDAO) ListUserSecondKillClaims(ctx context.Context, userID int64, pagination domain.Pagination) ([]Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []Participant{}, nil
+	}
+
+	var claims []Participant
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Joins("JOIN second_kill_events ON second_kill_events.id = participants.second_kill_id").
+		Where("participants.user_id = ? AND participants.withdrawn = ?", userID, false).
+		Order("participants.participated_at DESC, participants.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&claims).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取用户秒杀记录失败", zap.Int64("userID", userID), zap.Error(err))
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// GetLotteryDrawWithParticipantPage 获取抽奖活动及其一页参与者，并填充参与记录总数 ParticipantTotal
+// 与 GetLotteryDrawByID 不同，参与者通过带分页条件的 Preload 加载，适用于参与人数较多的活动详情页；
+// 分页和总数均不包含已退出的参与记录
+func (l *lotteryDrawDAO) GetLotteryDrawWithParticipantPage(ctx context.Context, id int, pagination domain.Pagination) (LotteryDraw, error) {
+	var lotteryDraw LotteryDraw
+
+	limit, offset, ok := pageBounds(pagination)
+
+	query := l.db.WithContext(ctx)
+	if ok {
+		query = query.Preload("Participants", func(db *gorm.DB) *gorm.DB {
+			return orderParticipants(db.Where("withdrawn = ?", false)).Limit(limit).Offset(offset)
+		})
+	}
+
+	if err := query.
+		Where("id = ?", id).
+		First(&lotteryDraw).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", id))
+			return LotteryDraw{}, err
+		}
+
+		l.loggerFrom(ctx).Error("获取抽奖活动失败", zap.Int("ID", id), zap.Error(err))
+
+		return LotteryDraw{}, err
+	}
+
+	if !ok {
+		lotteryDraw.Participants = []Participant{}
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("lottery_id = ? AND withdrawn = ?", id, false).
+		Count(&lotteryDraw.ParticipantTotal).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计抽奖活动参与人数失败", zap.Int("ID", id), zap.Error(err))
+		return LotteryDraw{}, err
+	}
+
+	return lotteryDraw, nil
+}
+
+// SetParticipationLock 锁定或解锁活动的参与，用于合规冻结等场景，活动类型由 ResolveActivityType 确定
+// 锁定不改变活动状态，在状态变更后依然有效；活动不存在时返回 ErrActivityNotFound，操作人从上下文中获取并记录日志
+func (l *lotteryDrawDAO) SetParticipationLock(ctx context.Context, id int, locked bool) error {
+	activityType, err := l.ResolveActivityType(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	model, err := activityModel(activityType)
+	if err != nil {
+		return err
+	}
+
+	result := l.db.WithContext(ctx).
+		Model(model).
+		Where("id = ?", id).
+		Update("participation_locked", locked)
+	if result.Error != nil {
+		l.loggerFrom(ctx).Error("设置活动参与锁定失败", zap.String("activityType", activityType), zap.Int("ID", id), zap.Bool("locked", locked), zap.Error(result.Error))
+		return result.Error
+	}
+
+	l.loggerFrom(ctx).Info("活动参与锁定状态已变更",
+		zap.String("activityType", activityType),
+		zap.Int("ID", id),
+		zap.Bool("locked", locked),
+		zap.Int64("actor", actorFrom(ctx)))
+
+	return nil
+}
+
+// ListParticipationLockedActivities 获取所有被锁定参与的抽奖和秒杀活动，按活动类型和ID排序，用于运营视图
+func (l *lotteryDrawDAO) ListParticipationLockedActivities(ctx context.Context) ([]ActivitySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var lotteries []ActivitySummary
+	if err := l.db.WithContext(ctx).
+		Model(&LotteryDraw{}).
+		Select("id, ? AS type, name, start_time, end_time, status", domain.ActivityTypeLottery).
+		Where("participation_locked = ?", true).
+		Order("id").
+		Scan(&lotteries).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取锁定参与的抽奖活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	var secondKills []ActivitySummary
+	if err := l.db.WithContext(ctx).
+		Model(&SecondKillEvent{}).
+		Select("id, ? AS type, name, start_time, end_time, status", domain.ActivityTypeSecondKill).
+		Where("participation_locked = ?", true).
+		Order("id").
+		Scan(&secondKills).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取锁定参与的秒杀活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	return append(lotteries, secondKills...), nil
+}
+
+// feedIDChunkSize 信息流批量查询时每条 IN 查询包含的活动ID数量上限
+const feedIDChunkSize = 500
+
+// FilterJoinedForFeed 批量查询用户是否参与了信息流中的各个抽奖活动，未参与的活动ID在结果中为 false
+// 与 FilterUserJoinedActivities 相同只统计未退出的参与记录，活动ID较多时分批查询
+func (l *lotteryDrawDAO) FilterJoinedForFeed(ctx context.Context, userID int64, activityIDs []int) (map[int]bool, error) {
+	joined := make(map[int]bool, len(activityIDs))
+	for _, id := range activityIDs {
+		joined[id] = false
+	}
+
+	for start := 0; start < len(activityIDs); start += feedIDChunkSize {
+		end := start + feedIDChunkSize
+		if end > len(activityIDs) {
+			end = len(activityIDs)
+		}
+
+		var ids []int
+		if err := l.db.WithContext(ctx).
+			Model(&Participant{}).
+			Distinct("lottery_id").
+			Where("user_id = ? AND lottery_id IN ? AND withdrawn = ?", userID, activityIDs[start:end], false).
+			Pluck("lottery_id", &ids).Error; err != nil {
+			l.loggerFrom(ctx).Error("批量查询用户参与状态失败", zap.Int64("userID", userID), zap.Int("count", len(activityIDs)), zap.Error(err))
+			return nil, err
+		}
+
+		for _, id := range ids {
+			joined[id] = true
+		}
+	}
+
+	return joined, nil
+}
+
+// secondKillWarnings 检查秒杀活动配置中的异常，返回供运营人员复核的警告列表
+// 秒杀活动没有独立的报名时间窗口（可抢购时间即 StartTime 至 EndTime 加宽限期），也不关联奖品（售卖对象由库存表示），
+// 因此不检查报名窗口颠倒和未配置奖品，对应的异常分别由时间范围、宽限期和库存检查覆盖
+func secondKillWarnings(event SecondKillEvent, now int64) []string {
+	warnings := []string{}
+
+	if event.Stock <= 0 {
+		warnings = append(warnings, "库存为 0")
+	}
+
+	if event.SoldCount > event.Stock {
+		warnings = append(warnings, fmt.Sprintf("已售数量 %d 超过库存 %d", event.SoldCount, event.Stock))
+	}
+
+	if event.StartTime >= event.EndTime {
+		warnings = append(warnings, "结束时间不晚于开始时间")
+	}
+
+	if event.Status == domain.SecondKillStatusPending && event.StartTime < now {
+		warnings = append(warnings, "开始时间已过但活动仍未开始")
+	}
+
+	if event.EndTime < now && event.Status != domain.SecondKillStatusCompleted {
+		warnings = append(warnings, "结束时间已过但活动尚未完成")
+	}
+
+	if event.GracePeriodSeconds < 0 {
+		warnings = append(warnings, "宽限期为负数")
+	}
+
+	if event.ParticipationLocked {
+		warnings = append(warnings, "活动参与已被锁定")
+	}
+
+	if err := validateImageURL(event.ImageURL); err != nil {
+		warnings = append(warnings, "活动图片地址不合法")
+	}
+
+	return warnings
+}
+
+// ValidateSecondKillEvent 在秒杀活动上线前检查配置异常，如库存为 0、时间范围颠倒等
+// 该方法只读且不会阻止上线，仅返回警告列表供运营人员复核；没有异常时返回空列表
+// now 为检查所依据的当前时间（UNIX 时间戳），用于判断开始时间是否已过
+func (l *lotteryDrawDAO) ValidateSecondKillEvent(ctx context.Context, eventID int, now int64) ([]string, error) {
+	var event SecondKillEvent
+
+	if err := l.db.WithContext(ctx).
+		Where("id = ?", eventID).
+		First(&event).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的秒杀活动", zap.Int("ID", eventID))
+		} else {
+			l.loggerFrom(ctx).Error("获取秒杀活动失败", zap.Int("eventID", eventID), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return secondKillWarnings(event, now), nil
+}
+
+// GetLotteryDrawsByIDsOrdered 根据ID批量获取抽奖活动，结果按输入ID的顺序排列，用于保持编辑精选列表的展示顺序
+// 不存在的ID会被忽略，重复的ID只保留第一次出现的位置；排序在内存中完成，不依赖 MySQL 的 FIELD 函数
+func (l *lotteryDrawDAO) GetLotteryDrawsByIDsOrdered(ctx context.Context, ids []int) ([]LotteryDraw, error) {
+	if len(ids) == 0 {
+		return []LotteryDraw{}, nil
+	}
+
+	var lotteryDraws []LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Preload("Participants", orderParticipants).
+		Where("id IN ?", ids).
+		Find(&lotteryDraws).Error; err != nil {
+		l.loggerFrom(ctx).Error("根据ID批量获取抽奖活动失败", zap.Ints("ids", ids), zap.Error(err))
+		return nil, err
+	}
+
+	byID := make(map[int]LotteryDraw, len(lotteryDraws))
+	for _, draw := range lotteryDraws {
+		byID[draw.ID] = draw
+	}
+
+	return orderLotteryDrawsByIDs(ids, byID), nil
+}
+
+// orderLotteryDrawsByIDs 按 ids 的顺序从 byID 中取出抽奖活动，跳过不存在和重复的ID
+func orderLotteryDrawsByIDs(ids []int, byID map[int]LotteryDraw) []LotteryDraw {
+	ordered := make([]LotteryDraw, 0, len(byID))
+	seen := make(map[int]struct{}, len(ids))
+
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		if draw, ok := byID[id]; ok {
+			ordered = append(ordered, draw)
+		}
+	}
+
+	return ordered
+}
+
+// CountLateJoiners 统计在抽奖活动结束前 windowSeconds 秒内参与的有效参与记录数，用于分析截止前的集中参与
+// 活动不存在时返回 gorm.ErrRecordNotFound，活动没有结束时间时返回 ErrInvalidTimeWindow
+func (l *lotteryDrawDAO) CountLateJoiners(ctx context.Context, activityID int, windowSeconds int) (int64, error) {
+	if windowSeconds <= 0 {
+		return 0, nil
+	}
+
+	var lotteryDraw LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Select("id", "end_time").
+		Where("id = ?", activityID).
+		First(&lotteryDraw).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", activityID))
+		} else {
+			l.loggerFrom(ctx).Error("获取抽奖活动失败", zap.Int("activityID", activityID), zap.Error(err))
+		}
+		return 0, err
+	}
+
+	if lotteryDraw.EndTime <= 0 {
+		return 0, ErrInvalidTimeWindow
+	}
+
+	var count int64
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("lottery_id = ? AND withdrawn = ?", activityID, false).
+		Where("participated_at >= ? AND participated_at <= ?", lotteryDraw.EndTime-int64(windowSeconds), lotteryDraw.EndTime).
+		Count(&count).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计截止前参与人数失败", zap.Int("activityID", activityID), zap.Int("windowSeconds", windowSeconds), zap.Error(err))
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// IterateLotteryDraws 按 id 键集分页分批遍历指定状态的抽奖活动并逐条调用 fn，status 为空时遍历全部活动
+// 不预加载参与者，内存占用与批大小相关；fn 返回错误或上下文取消时停止遍历并返回该错误
+func (l *lotteryDrawDAO) IterateLotteryDraws(ctx context.Context, status string, batchSize int, fn func(LotteryDraw) error) error {
+	status, err := normalizeStatus(status, lotteryStatuses)
+	if err != nil {
+		return err
+	}
+
+	if batchSize <= 0 {
+		batchSize = defaultIterateBatchSize
+	}
+
+	lastID := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var batch []LotteryDraw
+
+		query := l.db.WithContext(ctx).Where("id > ?", lastID)
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		if err := query.Order("id").
+			Limit(batchSize).
+			Find(&batch).Error; err != nil {
+			l.loggerFrom(ctx).Error("分批获取抽奖活动失败", zap.String("status", status), zap.Int("lastID", lastID), zap.Error(err))
+			return err
+		}
+
+		for _, draw := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := fn(draw); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// MergeActivities 将源抽奖活动的参与记录合并到目标活动，并将源活动置为已取消，返回迁移的参与记录数
+// 目标活动中已参与的用户和已存在的外部参与编号会被跳过，同一用户在源活动中的多条记录只迁移最早的一条；
+// 目标活动设置了参与人数上限时，未退出的参与记录按参与时间迁移至上限为止。跳过的记录保留在源活动中；
+// 已完成或已取消的活动不能参与合并，迁移的参与记录ID写入目标活动的审计记录
+func (l *lotteryDrawDAO) MergeActivities(ctx context.Context, sourceID, targetID int) (int64, error) {
+	if sourceID == targetID {
+		return 0, ErrMergeSameActivity
+	}
+
+	var moved []Participant
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var draws []LotteryDraw
+
+		// 按ID顺序锁定两个活动，避免并发合并时死锁
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status", "max_participants").
+			Where("id IN ?", []int{sourceID, targetID}).
+			Order("id").
+			Find(&draws).Error; err != nil {
+			return err
+		}
+
+		if len(draws) < 2 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var maxParticipants int
+		for _, draw := range draws {
+			if draw.Status == domain.LotteryStatusCompleted || draw.Status == domain.LotteryStatusCancelled {
+				return ErrInvalidStatusTransition
+			}
+			if draw.ID == targetID {
+				maxParticipants = draw.MaxParticipants
+			}
+		}
+
+		var targetParticipants []Participant
+		if err := tx.Select("user_id", "external_ref", "withdrawn").
+			Where("lottery_id = ?", targetID).
+			Find(&targetParticipants).Error; err != nil {
+			return err
+		}
+
+		var active int
+		users := make(map[int64]struct{}, len(targetParticipants))
+		refs := make(map[string]struct{})
+		for _, p := range targetParticipants {
+			users[p.UserID] = struct{}{}
+			if p.ExternalRef != nil {
+				refs[*p.ExternalRef] = struct{}{}
+			}
+			if !p.Withdrawn {
+				active++
+			}
+		}
+
+		var sourceParticipants []Participant
+		if err := tx.Where("lottery_id = ?", sourceID).
+			Scopes(orderParticipants).
+			Find(&sourceParticipants).Error; err != nil {
+			return err
+		}
+
+		var ids []string
+		for _, p := range sourceParticipants {
+			if _, ok := users[p.UserID]; ok {
+				continue
+			}
+			if p.ExternalRef != nil {
+				if _, ok := refs[*p.ExternalRef]; ok {
+					continue
+				}
+			}
+			if !p.Withdrawn {
+				if maxParticipants > 0 && active >= maxParticipants {
+					continue
+				}
+				active++
+			}
+
+			users[p.UserID] = struct{}{}
+			if p.ExternalRef != nil {
+				refs[*p.ExternalRef] = struct{}{}
+			}
+			ids = append(ids, p.ID)
+			moved = append(moved, p)
+		}
+
+		if len(ids) > 0 {
+			if err := tx.Model(&Participant{}).
+				Where("id IN ?", ids).
+				Update("lottery_id", targetID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&LotteryDraw{}).
+			Where("id = ?", sourceID).
+			Updates(map[string]interface{}{"status": domain.LotteryStatusCancelled, "cancel_reason": CancelReasonMerged}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&DrawAudit{
+			ActivityID:     targetID,
+			Actor:          actorFrom(ctx),
+			Action:         DrawAuditActionMerge,
+			ParticipantIDs: ids,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到待合并的抽奖活动", zap.Int("sourceID", sourceID), zap.Int("targetID", targetID))
+			return 0, err
+		}
+		l.loggerFrom(ctx).Error("合并抽奖活动失败", zap.Int("sourceID", sourceID), zap.Int("targetID", targetID), zap.Error(err))
+		return 0, err
+	}
+
+	var active int64
+	for _, p := range moved {
+		if !p.Withdrawn {
+			active++
+		}
+	}
+	l.incrLiveParticipantCount(ctx, sourceID, -active)
+	l.incrLiveParticipantCount(ctx, targetID, active)
+
+	return int64(len(moved)), nil
+}
+
+// percentileOffset 计算百分位对应的有序行偏移量，即前 ceil(p*total) 条记录中的最后一条
+func percentileOffset(p float64, total int64) int64 {
+	offset := int64(math.Ceil(p*float64(total))) - 1
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total {
+		offset = total - 1
+	}
+	return offset
+}
+
+// GetParticipationPercentiles 获取抽奖活动参与进度的百分位，如 0.5 对应一半有效参与记录已参与时的参与时间
+// percentiles 取值范围为 (0, 1]，每个百分位按 (participated_at, id) 排序后的行偏移量查询；活动没有有效参与记录时返回空结果
+func (l *lotteryDrawDAO) GetParticipationPercentiles(ctx context.Context, activityID int, percentiles []float64) (map[float64]int64, error) {
+	for _, p := range percentiles {
+		if !(p > 0 && p <= 1) {
+			return nil, ErrInvalidPercentile
+		}
+	}
+
+	result := make(map[float64]int64, len(percentiles))
+	if len(percentiles) == 0 {
+		return result, nil
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		return db.Model(&Participant{}).Where("lottery_id = ? AND withdrawn = ?", activityID, false)
+	}
+
+	var total int64
+	if err := l.db.WithContext(ctx).
+		Scopes(scope).
+		Count(&total).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计抽奖活动参与人数失败", zap.Int("activityID", activityID), zap.Error(err))
+		return nil, err
+	}
+
+	if total == 0 {
+		return result, nil
+	}
+
+	for _, p := range percentiles {
+		if _, ok := result[p]; ok {
+			continue
+		}
+
+		var participatedAt []int64
+		if err := l.db.WithContext(ctx).
+			Scopes(scope, orderParticipants).
+			Offset(int(percentileOffset(p, total))).
+			Limit(1).
+			Pluck("participated_at", &participatedAt).Error; err != nil {
+			l.loggerFrom(ctx).Error("获取参与进度百分位失败", zap.Int("activityID", activityID), zap.Float64("percentile", p), zap.Error(err))
+			return nil, err
+		}
+
+		if len(participatedAt) > 0 {
+			result[p] = participatedAt[0]
+		}
+	}
+
+	return result, nil
+}
+
+// RefundSecondKillClaim 退款秒杀抢购记录并释放库存：在同一事务中将参与记录标记为已退出并记录退款标记、
+// 扣减已售数量后执行 refund 回调，回调返回错误时整体回滚并返回该错误
+// 仅允许对未退出的秒杀参与记录退款，否则返回 ErrClaimNotRefundable
+func (l *lotteryDrawDAO) RefundSecondKillClaim(ctx context.Context, participantID string, refund func(userID int64) error) error {
+	var participant Participant
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁定参与记录，避免重复退款
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", participantID).
+			First(&participant).Error; err != nil {
+			return err
+		}
+
+		if participant.SecondKillID == nil || participant.Withdrawn {
+			return ErrClaimNotRefundable
+		}
+
+		metadata := make(map[string]string, len(participant.Metadata)+1)
+		for k, v := range participant.Metadata {
+			metadata[k] = v
+		}
+		metadata["refunded"] = "true"
+
+		if err := tx.Model(&Participant{}).
+			Where("id = ?", participantID).
+			Updates(Participant{Withdrawn: true, Metadata: metadata}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&SecondKillEvent{}).
+			Where("id = ? AND sold_count > 0", *participant.SecondKillID).
+			Update("sold_count", gorm.Expr("sold_count - 1")).Error; err != nil {
+			return err
+		}
+
+		return refund(participant.UserID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			l.warnNotFound(ctx, "未找到指定ID的参与记录", zap.String("participantID", participantID))
+		case errors.Is(err, ErrClaimNotRefundable):
+		default:
+			l.loggerFrom(ctx).Error("秒杀抢购退款失败", zap.String("participantID", participantID), zap.Error(err))
+		}
+		return err
+	}
+
+	l.loggerFrom(ctx).Info("秒杀抢购已退款",
+		zap.String("participantID", participantID),
+		zap.Int("eventID", *participant.SecondKillID),
+		zap.Int64("userID", participant.UserID),
+		zap.Int64("actor", actorFrom(ctx)))
+
+	return nil
+}
+
+// ListCancelledForLowParticipation 获取因参与人数未达到 MinParticipants 而被自动取消的抽奖活动，按更新时间倒序排列
+// 用于运营人员筛选可重新发起的活动，手动取消或因合并取消的活动不会出现在结果中
+func (l *lotteryDrawDAO) ListCancelledForLowParticipation(ctx context.Context, pagination domain.Pagination) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDraw{}, nil
+	}
+
+	var lotteryDraws []LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Preload("Participants", orderParticipants).
+		Where("status = ? AND cancel_reason = ?", domain.LotteryStatusCancelled, CancelReasonBelowMinParticipants).
+		Order("updated_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&lotteryDraws).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取人数不足取消的抽奖活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	return lotteryDraws, nil
+}
+
+// GetAverageEntriesPerUser 计算抽奖活动中每个参与用户的平均有效参与次数，即 COUNT(*) / COUNT(DISTINCT user_id)
+// 没有有效参与记录时返回 0
+func (l *lotteryDrawDAO) GetAverageEntriesPerUser(ctx context.Context, activityID int) (float64, error) {
+	var stats struct {
+		Entries int64 `gorm:"column:entries"`
+		Users   int64 `gorm:"column:users"`
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("COUNT(*) AS entries, COUNT(DISTINCT user_id) AS users").
+		Where("lottery_id = ? AND withdrawn = ?", activityID, false).
+		Scan(&stats).Error; err != nil {
+		l.loggerFrom(ctx).Error("计算人均参与次数失败", zap.Int("activityID", activityID), zap.Error(err))
+		return 0, err
+	}
+
+	if stats.Users == 0 {
+		return 0, nil
+	}
+
+	return float64(stats.Entries) / float64(stats.Users), nil
+}
+
+// secondKillWinnersKeyPrefix Redis 秒杀抢购结果的键前缀
+// 该键为 Hash 结构，字段为抢购成功的用户ID，值为抢购时间（UNIX 时间戳），由 ClaimSecondKillCached 写入
+const secondKillWinnersKeyPrefix = "linkme:lottery_draw:second_kill_winners:"
+
+// secondKillWinnersTTL Redis 抢购结果的过期时间，需覆盖活动持续时间和停机前的持久化窗口
+const secondKillWinnersTTL = 24 * time.Hour
+
+func secondKillWinnersKey(eventID int) string {
+	return fmt.Sprintf("%s%d", secondKillWinnersKeyPrefix, eventID)
+}
+
+// secondKillClaimedUsersKeyPrefix Redis 秒杀已抢购用户集合的键前缀
+// 该键为 Set 结构，记录通过 ClaimSecondKillCached 抢购过的用户ID，持久化后不删除，用于拒绝同一用户再次抢购
+const secondKillClaimedUsersKeyPrefix = "linkme:lottery_draw:second_kill_claimed_users:"
+
+func secondKillClaimedUsersKey(eventID int) string {
+	return fmt.Sprintf("%s%d", secondKillClaimedUsersKeyPrefix, eventID)
+}
+
+// claimSecondKillCachedScript 在 Redis 中登记抢购结果，登记人数不超过剩余库存
+// KEYS[1] 为抢购结果，KEYS[2] 为已抢购用户集合
+// 返回 1 表示登记成功，0 表示用户已抢购过，-1 表示剩余库存已被登记完
+var claimSecondKillCachedScript = redis.NewScript(`
+if redis.call("SISMEMBER", KEYS[2], ARGV[1]) == 1 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	return 0
+end
+if redis.call("HLEN", KEYS[1]) >= tonumber(ARGV[3]) then
+	return -1
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("SADD", KEYS[2], ARGV[1])
+redis.call("EXPIRE", KEYS[1], ARGV[4])
+redis.call("EXPIRE", KEYS[2], ARGV[4])
+return 1
+`)
+
+// ClaimSecondKillCached Redis 加速的秒杀抢购路径：与 ClaimSecondKill 执行相同的参与规则和宽限期校验，
+// 但不锁定活动行、不写参与记录，只在 Redis 中登记抢购结果，由 FlushSecondKillCacheToDB 统一持久化
+// Redis 中登记的人数不超过剩余库存（stock - sold_count），超出时返回 ErrSoldOut；
+// 用户已在数据库中有未退出的参与记录或已在 Redis 中抢购过时返回 ErrAlreadyClaimed
+// 未配置 Redis 时退化为 ClaimSecondKill 直接写入数据库
+func (l *lotteryDrawDAO) ClaimSecondKillCached(ctx context.Context, eventID int, userID int64, now int64) error {
+	if l.redis == nil {
+		_, err := l.ClaimSecondKill(ctx, eventID, userID, now)
+		return err
+	}
+
+	var event SecondKillEvent
+
+	if err := l.db.WithContext(ctx).
+		Select("id", "status", "end_time", "grace_period_seconds", "participation_locked", "min_user_level", "stock", "sold_count").
+		Where("id = ?", eventID).
+		First(&event).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的秒杀活动", zap.Int("ID", eventID))
+		} else {
+			l.loggerFrom(ctx).Error("获取秒杀活动失败", zap.Int("eventID", eventID), zap.Error(err))
+		}
+		return err
+	}
+
+	userLevel, err := resolveUserLevel(ctx, l.userLevel, userID, event.MinUserLevel)
+	if err != nil {
+		return err
+	}
+
+	if _, err := checkClaimAllowed(event, userLevel, now); err != nil {
+		return err
+	}
+
+	// 已通过数据库路径抢购的用户不在 Redis 集合中，需单独校验
+	var claimed int64
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("second_kill_id = ? AND user_id = ? AND withdrawn = ?", eventID, userID, false).
+		Count(&claimed).Error; err != nil {
+		l.loggerFrom(ctx).Error("查询用户秒杀参与记录失败", zap.Int("eventID", eventID), zap.Int64("userID", userID), zap.Error(err))
+		return err
+	}
+
+	if claimed > 0 {
+		return ErrAlreadyClaimed
+	}
+
+	remaining := event.Stock - event.SoldCount
+	if remaining <= 0 {
+		return ErrSoldOut
+	}
+
+	res, err := claimSecondKillCachedScript.Run(ctx, l.redis, []string{secondKillWinnersKey(eventID), secondKillClaimedUsersKey(eventID)},
+		userID, now, remaining, int64(secondKillWinnersTTL/time.Second)).Int()
+	if err != nil {
+		l.loggerFrom(ctx).Error("登记秒杀抢购缓存失败", zap.Int("eventID", eventID), zap.Int64("userID", userID), zap.Error(err))
+		return err
+	}
+
+	switch res {
+	case 0:
+		return ErrAlreadyClaimed
+	case -1:
+		return ErrSoldOut
+	default:
+		return nil
+	}
+}
+
+// cachedClaim Redis 中登记的一条抢购结果
+type cachedClaim struct {
+	field     string
+	userID    int64
+	claimedAt int64
+}
+
+// FlushSecondKillCacheToDB 将 ClaimSecondKillCached 登记在 Redis 中的抢购结果写入数据库，用于优雅停机前持久化缓存中的抢购，返回写入的记录数
+// 已在数据库中存在该活动未退出参与记录的用户以及重复登记的用户会被跳过并记录警告日志；写入数量不超过活动的剩余库存，按抢购时间先后保留，超出部分记录警告日志后丢弃
+// 写入时按新增记录数增加 sold_count，事务提交后从 Redis 中删除本次处理过的登记，因此可以重复调用
+// 提交与删除之间的短暂窗口内剩余库存会被重复计算，ClaimSecondKillCached 只会多拒绝而不会超卖
+// 未配置 Redis 时直接返回 0
+func (l *lotteryDrawDAO) FlushSecondKillCacheToDB(ctx context.Context, eventID int) (int, error) {
+	if l.redis == nil {
+		return 0, nil
+	}
+
+	key := secondKillWinnersKey(eventID)
+
+	cached, err := l.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		l.loggerFrom(ctx).Error("读取秒杀抢购缓存失败", zap.Int("eventID", eventID), zap.Error(err))
+		return 0, err
+	}
+
+	if len(cached) == 0 {
+		return 0, nil
+	}
+
+	processed := make([]string, 0, len(cached))
+	claims := make([]cachedClaim, 0, len(cached))
+
+	for field, value := range cached {
+		processed = append(processed, field)
+
+		userID, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			l.loggerFrom(ctx).Warn("忽略无效的秒杀抢购缓存字段", zap.Int("eventID", eventID), zap.String("field", field))
+			continue
+		}
+
+		claimedAt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			claimedAt = time.Now().Unix()
+		}
+
+		claims = append(claims, cachedClaim{field: field, userID: userID, claimedAt: claimedAt})
+	}
+
+	// 按抢购时间先后排序，库存不足时保留先抢购的用户
+	sort.Slice(claims, func(i, j int) bool {
+		if claims[i].claimedAt != claims[j].claimedAt {
+			return claims[i].claimedAt < claims[j].claimedAt
+		}
+		return claims[i].userID < claims[j].userID
+	})
+
+	var flushed []Participant
+	var dropped, duplicates []int64
+
+	err = l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var event SecondKillEvent
+
+		// 锁定活动行，避免并发刷新重复写入或超出库存
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "end_time", "stock", "sold_count").
+			Where("id = ?", eventID).
+			First(&event).Error; err != nil {
+			return err
+		}
+
+		var existing []int64
+		if err := tx.Model(&Participant{}).
+			Distinct("user_id").
+			Where("second_kill_id = ? AND withdrawn = ?", eventID, false).
+			Pluck("user_id", &existing).Error; err != nil {
+			return err
+		}
+
+		skip := make(map[int64]struct{}, len(existing))
+		for _, userID := range existing {
+			skip[userID] = struct{}{}
+		}
+
+		remaining := event.Stock - event.SoldCount
+
+		for _, claim := range claims {
+			if _, ok := skip[claim.userID]; ok {
+				duplicates = append(duplicates, claim.userID)
+				continue
+			}
+			// 同一用户可能以不同的字段形式（如前导零）重复登记，只保留最早的一条
+			skip[claim.userID] = struct{}{}
+
+			if len(flushed) >= remaining {
+				dropped = append(dropped, claim.userID)
+				continue
+			}
+
+			metadata := map[string]string{"source": "redis"}
+			if claim.claimedAt > event.EndTime {
+				metadata["grace_claim"] = "true"
+			}
+
+			flushed = append(flushed, Participant{
+				ID:             uuid.New().String(),
+				SecondKillID:   &eventID,
+				UserID:         claim.userID,
+				ParticipatedAt: claim.claimedAt,
+				Metadata:       metadata,
+			})
+		}
+
+		if len(flushed) == 0 {
+			return nil
+		}
+
+		if err := tx.CreateInBatches(&flushed, bulkInsertBatchSize).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&SecondKillEvent{}).
+			Where("id = ?", eventID).
+			Update("sold_count", gorm.Expr("sold_count + ?", len(flushed))).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的秒杀活动", zap.Int("ID", eventID))
+			return 0, err
+		}
+		l.loggerFrom(ctx).Error("持久化秒杀抢购缓存失败", zap.Int("eventID", eventID), zap.Error(err))
+		return 0, err
+	}
+
+	if len(duplicates) > 0 {
+		l.loggerFrom(ctx).Warn("秒杀抢购缓存中的用户已抢购过，重复部分未写入", zap.Int("eventID", eventID), zap.Int64s("userIDs", duplicates))
+	}
+
+	if len(dropped) > 0 {
+		l.loggerFrom(ctx).Warn("秒杀抢购缓存超出剩余库存，超出部分未写入", zap.Int("eventID", eventID), zap.Int64s("userIDs", dropped))
+	}
+
+	// 仅删除本次读取的字段，刷新期间新登记的抢购保留到下次刷新
+	if err := l.redis.HDel(ctx, key, processed...).Err(); err != nil {
+		l.loggerFrom(ctx).Warn("清理已持久化的秒杀抢购缓存失败", zap.Int("eventID", eventID), zap.Error(err))
+	}
+
+	if len(flushed) > 0 {
+		l.loggerFrom(ctx).Info("秒杀抢购缓存已持久化", zap.Int("eventID", eventID), zap.Int("flushed", len(flushed)))
+	}
+
+	return len(flushed), nil
+}
+
+// entryRejectionReason 将参与判定返回的错误转换为 CanUserEnter 的原因码，无法识别的错误返回 false
+func entryRejectionReason(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrParticipationLocked):
+		return EntryReasonParticipationLocked, true
+	case errors.Is(err, ErrActivityPaused):
+		return EntryReasonPaused, true
+	case errors.Is(err, ErrEntryWindowClosed):
+		return EntryReasonEntryWindowClosed, true
+	case errors.Is(err, ErrLotteryDrawNotActive), errors.Is(err, ErrEventNotActive):
+		return EntryReasonNotActive, true
+	case errors.Is(err, ErrUserLevelTooLow):
+		return EntryReasonUserLevelTooLow, true
+	case errors.Is(err, ErrActivityFull):
+		return EntryReasonActivityFull, true
+	case errors.Is(err, ErrUserEntryLimitReached):
+		return EntryReasonEntryLimitReached, true
+	case errors.Is(err, ErrEntryCooldown):
+		return EntryReasonCooldown, true
+	default:
+		return "", false
+	}
+}
+
+// CanUserEnter 只读地判断用户在 now 时刻能否参与抽奖活动，返回是否允许及原因码
+// 与 AddParticipant 使用相同的 loadParticipation 和 evaluateParticipation，判定结果与以相同参数调用 AddParticipant 完全一致
+func (l *lotteryDrawDAO) CanUserEnter(ctx context.Context, activityID int, userID int64, userLevel int, now int64) (bool, string, error) {
+	rules, state, err := loadParticipation(l.db.WithContext(ctx), Participant{LotteryID: &activityID, UserID: userID}, false)
+	if err != nil {
+		if errors.Is(err, ErrActivityNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", activityID))
+		} else {
+			l.loggerFrom(ctx).Error("查询抽奖活动参与规则失败", zap.Int("activityID", activityID), zap.Int64("userID", userID), zap.Error(err))
+		}
+		return false, "", err
+	}
+
+	return entryDecision(evaluateParticipation(rules, state, true, userLevel, now))
+}
+
+// entryDecision 将 evaluateParticipation 的判定结果转换为 CanUserEnter 的返回值
+func entryDecision(err error) (bool, string, error) {
+	if err == nil {
+		return true, EntryReasonAllowed, nil
+	}
+
+	reason, ok := entryRejectionReason(err)
+	if !ok {
+		return false, "", err
+	}
+
+	return false, reason, nil
+}
+
+// ListWinnersForActivities 分页获取多个抽奖活动的中奖者，按活动ID和参与记录ID升序排列，便于履约任务断点续传
+// 活动ID较多时按 feedIDChunkSize 分批查询，分页在所有批次的结果上整体生效
+func (l *lotteryDrawDAO) ListWinnersForActivities(ctx context.Context, activityIDs []int, pagination domain.Pagination) ([]WinnerRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok || len(activityIDs) == 0 {
+		return []WinnerRecord{}, nil
+	}
+
+	// 去重并排序，保证各批次结果拼接后整体按活动ID有序
+	ids := make([]int, 0, len(activityIDs))
+	seen := make(map[int]struct{}, len(activityIDs))
+	for _, id := range activityIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	records := []WinnerRecord{}
+
+	for start := 0; start < len(ids) && len(records) < limit; start += feedIDChunkSize {
+		end := start + feedIDChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunk := ids[start:end]
+
+		winners := func() *gorm.DB {
+			return l.db.WithContext(ctx).
+				Table("participants AS p").
+				Joins("JOIN lottery_draws AS d ON d.id = p.lottery_id").
+				Where("p.lottery_id IN ? AND p.is_winner = ?", chunk, true)
+		}
+
+		// 偏移量落在后续批次时跳过当前批次
+		if offset > 0 {
+			var count int64
+			if err := winners().Count(&count).Error; err != nil {
+				l.loggerFrom(ctx).Error("统计活动中奖者数量失败", zap.Int("count", len(chunk)), zap.Error(err))
+				return nil, err
+			}
+
+			if int64(offset) >= count {
+				offset -= int(count)
+				continue
+			}
+		}
+
+		var page []WinnerRecord
+		if err := winners().
+			Select("p.id AS participant_id, p.lottery_id AS activity_id, d.name AS activity_name, p.user_id AS user_id, " +
+				"p.prize_id AS prize_id, COALESCE(pr.name, '') AS prize_name, COALESCE(pr.value, 0) AS prize_value, " +
+				"p.participated_at AS participated_at").
+			Joins("LEFT JOIN prizes AS pr ON pr.id = p.prize_id").
+			Order("p.lottery_id ASC, p.id ASC").
+			Limit(limit - len(records)).
+			Offset(offset).
+			Scan(&page).Error; err != nil {
+			l.loggerFrom(ctx).Error("批量获取活动中奖者失败", zap.Int("count", len(chunk)), zap.Error(err))
+			return nil, err
+		}
+
+		records = append(records, page...)
+		offset = 0
+	}
+
+	return records, nil
+}
+
+// GetUserLastParticipation 获取用户在所有活动中最近一次参与的时间，用于跨活动的参与冷却，从未参与时返回 0
+// 已退出的参与记录同样计入，退出不会重置冷却时间
+func (l *lotteryDrawDAO) GetUserLastParticipation(ctx context.Context, userID int64) (int64, error) {
+	var last int64
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("COALESCE(MAX(participated_at), 0)").
+		Where("user_id = ?", userID).
+		Scan(&last).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取用户最近参与时间失败", zap.Int64("userID", userID), zap.Error(err))
+		return 0, err
+	}
+
+	return last, nil
+}
+
+// orphanParticipantLimit FindOrphanParticipants 单次返回的孤立参与记录数量上限
+const orphanParticipantLimit = 1000
+
+// FindOrphanParticipants 查找所属活动不存在的参与记录，用于排查数据损坏，最多返回 orphanParticipantLimit 条
+// 参与记录按 lottery_id 或 second_kill_id 分别关联抽奖和秒杀活动，两者均为空的记录同样视为孤立记录
+func (l *lotteryDrawDAO) FindOrphanParticipants(ctx context.Context) ([]Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var orphans []Participant
+
+	if err := l.db.WithContext(ctx).
+		Table("participants AS p").
+		Select("p.*").
+		Joins("LEFT JOIN lottery_draws AS d ON d.id = p.lottery_id").
+		Joins("LEFT JOIN second_kill_events AS e ON e.id = p.second_kill_id").
+		Where("(p.lottery_id IS NOT NULL AND d.id IS NULL) OR " +
+			"(p.second_kill_id IS NOT NULL AND e.id IS NULL) OR " +
+			"(p.lottery_id IS NULL AND p.second_kill_id IS NULL)").
+		Order("p.participated_at ASC, p.id ASC").
+		Limit(orphanParticipantLimit).
+		Find(&orphans).Error; err != nil {
+		l.loggerFrom(ctx).Error("查找孤立参与记录失败", zap.Error(err))
+		return nil, err
+	}
+
+	if len(orphans) > 0 {
+		l.loggerFrom(ctx).Warn("发现孤立参与记录", zap.Int("count", len(orphans)), zap.Bool("truncated", len(orphans) == orphanParticipantLimit))
+	}
+
+	return orphans, nil
+}
+
+// projectSellout 根据最近窗口内的抢购数计算售出速率，并预估剩余库存售罄的时间，速率为 0 时预估时间为 0
+func projectSellout(remaining int, claims int64, windowSeconds int, now int64) (float64, int64) {
+	rate := float64(claims) / float64(windowSeconds)
+	if rate == 0 {
+		return 0, 0
+	}
+
+	return rate, now + int64(math.Ceil(float64(remaining)/rate))
+}
+
+// GetSecondKillBurnRate 统计秒杀活动截至 now 的最近 windowSeconds 秒内的抢购数，返回每秒售出数量和按该速率预估的售罄时间（UNIX 时间戳）
+// 最近窗口内没有抢购时预估时间为 0；库存已售罄时返回 ErrSoldOut，已退款的抢购记录不计入
+func (l *lotteryDrawDAO) GetSecondKillBurnRate(ctx context.Context, eventID int, windowSeconds int, now int64) (float64, int64, error) {
+	if windowSeconds <= 0 {
+		return 0, 0, ErrInvalidTimeWindow
+	}
+
+	var event SecondKillEvent
+
+	if err := l.db.WithContext(ctx).
+		Select("id", "stock", "sold_count").
+		Where("id = ?", eventID).
+		First(&event).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的秒杀活动", zap.Int("ID", eventID))
+		} else {
+			l.loggerFrom(ctx).Error("获取秒杀活动失败", zap.Int("eventID", eventID), zap.Error(err))
+		}
+		return 0, 0, err
+	}
+
+	remaining := event.Stock - event.SoldCount
+	if remaining <= 0 {
+		return 0, 0, ErrSoldOut
+	}
+
+	var claims int64
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("second_kill_id = ? AND withdrawn = ? AND participated_at > ? AND participated_at <= ?",
+			eventID, false, now-int64(windowSeconds), now).
+		Count(&claims).Error; err != nil {
+		l.loggerFrom(ctx).Error("统计秒杀活动近期抢购数失败", zap.Int("eventID", eventID), zap.Error(err))
+		return 0, 0, err
+	}
+
+	rate, selloutTs := projectSellout(remaining, claims, windowSeconds, now)
+
+	return rate, selloutTs, nil
+}
+
+// AnonymizeUserParticipations 在同一事务中将用户的参与记录和秒杀预留记录的用户ID替换为 AnonymizedUserID，并清空参与元数据，返回匿名化的参与记录数
+// 参与记录本身、中奖标记和奖品分配保持不变，活动的参与人次和中奖人数不受影响；按用户去重的统计会将已匿名化的用户合并计为一人
+func (l *lotteryDrawDAO) AnonymizeUserParticipations(ctx context.Context, userID int64) (int64, error) {
+	if userID == AnonymizedUserID {
+		return 0, nil
+	}
+
+	var anonymized int64
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Participant{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"user_id": AnonymizedUserID, "metadata": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		anonymized = result.RowsAffected
+
+		return tx.Model(&SecondKillReservation{}).
+			Where("user_id = ?", userID).
+			Update("user_id", AnonymizedUserID).Error
+	})
+	if err != nil {
+		l.loggerFrom(ctx).Error("匿名化用户参与记录失败", zap.Int64("userID", userID), zap.Error(err))
+		return 0, err
+	}
+
+	l.loggerFrom(ctx).Info("用户参与记录已匿名化",
+		zap.Int64("userID", userID),
+		zap.Int64("count", anonymized),
+		zap.Int64("actor", actorFrom(ctx)))
+
+	return anonymized, nil
+}
+
+// GetTimeToFill 获取抽奖活动从开始到参与人数达到上限所用的秒数，用于复盘有上限活动的需求热度
+// 未达到上限时 filled 为 false，seconds 为活动开始到结束的时长；已退出的参与记录不计入；活动未设置上限时返回 ErrNoParticipantCap
+func (l *lotteryDrawDAO) GetTimeToFill(ctx context.Context, activityID int) (int64, bool, error) {
+	var draw LotteryDraw
+
+	if err := l.db.WithContext(ctx).
+		Select("id", "start_time", "end_time", "max_participants").
+		Where("id = ?", activityID).
+		First(&draw).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.warnNotFound(ctx, "未找到指定ID的抽奖活动", zap.Int("ID", activityID))
+		} else {
+			l.loggerFrom(ctx).Error("获取抽奖活动失败", zap.Int("activityID", activityID), zap.Error(err))
+		}
+		return 0, false, err
+	}
+
+	if draw.MaxParticipants <= 0 {
+		return 0, false, ErrNoParticipantCap
+	}
+
+	// 第 MaxParticipants 名有效参与者的参与时间
+	var filledAt []int64
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Where("lottery_id = ? AND withdrawn = ?", activityID, false).
+		Order("participated_at ASC, id ASC").
+		Offset(draw.MaxParticipants-1).
+		Limit(1).
+		Pluck("participated_at", &filledAt).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取抽奖活动满员时间失败", zap.Int("activityID", activityID), zap.Error(err))
+		return 0, false, err
+	}
+
+	if len(filledAt) == 0 {
+		return draw.EndTime - draw.StartTime, false, nil
+	}
+
+	return timeToFill(draw.StartTime, filledAt[0]), true, nil
+}
+
+// timeToFill 计算从活动开始到满员的秒数，报名早于活动开始时记为 0
+func timeToFill(startTime, filledAt int64) int64 {
+	if filledAt < startTime {
+		return 0
+	}
+
+	return filledAt - startTime
+}
+
+// RefreshStatusesForIDs 按 domain.ScheduledLotteryStatus 的调度规则刷新指定抽奖活动的状态，返回状态发生变化的活动数
+// 供运维修复个别活动使用，不扫描全表；ids 为空时返回 ErrEmptyIDs，不存在的ID会被忽略
+func (l *lotteryDrawDAO) RefreshStatusesForIDs(ctx context.Context, ids []int, now int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, ErrEmptyIDs
+	}
+
+	var changed int64
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var draws []LotteryDraw
+		if err := tx.Model(&LotteryDraw{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status", "start_time", "end_time").
+			Where("id IN ? AND status IN ?", ids, []string{domain.LotteryStatusPending, domain.LotteryStatusActive}).
+			Find(&draws).Error; err != nil {
+			return err
+		}
+
+		// 按目标状态分组，每组一次更新
+		targets := make(map[string][]int)
+		for _, draw := range draws {
+			if status := domain.ScheduledLotteryStatus(draw.Status, draw.StartTime, draw.EndTime, now); status != draw.Status {
+				targets[status] = append(targets[status], draw.ID)
+			}
+		}
+
+		for status, targetIDs := range targets {
+			result := tx.Model(&LotteryDraw{}).Where("id IN ?", targetIDs).Update("status", status)
+			if result.Error != nil {
+				return result.Error
+			}
+			changed += result.RowsAffected
+		}
+
+		return nil
+	})
+	if err != nil {
+		l.loggerFrom(ctx).Error("刷新指定抽奖活动状态失败", zap.Ints("ids", ids), zap.Error(err))
+		return 0, err
+	}
+
+	l.loggerFrom(ctx).Info("指定抽奖活动状态已刷新",
+		zap.Ints("ids", ids),
+		zap.Int64("changed", changed),
+		zap.Int64("actor", actorFrom(ctx)))
+
+	return changed, nil
+}
+
+// FindOversoldEvents 查找已售数量超过库存的秒杀活动，按超卖数量降序排列并填充 OversoldBy，用于超卖告警
+// 正常情况下库存扣减是原子的，该方法作为正确性监控，发现异常时记录告警日志
+func (l *lotteryDrawDAO) FindOversoldEvents(ctx context.Context) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []SecondKillEvent
+
+	if err := l.db.WithContext(ctx).
+		Where("sold_count > stock").
+		Order("sold_count - stock DESC, id ASC").
+		Find(&events).Error; err != nil {
+		l.loggerFrom(ctx).Error("查找超卖秒杀活动失败", zap.Error(err))
+		return nil, err
+	}
+
+	for i := range events {
+		events[i].OversoldBy = events[i].SoldCount - events[i].Stock
+		l.loggerFrom(ctx).Warn("秒杀活动已售数量超过库存",
+			zap.Int("eventID", events[i].ID),
+			zap.Int("stock", events[i].Stock),
+			zap.Int("soldCount", events[i].SoldCount),
+			zap.Int("oversoldBy", events[i].OversoldBy))
+	}
+
+	return events, nil
+}
+
+// GetUserWinRate 获取用户在所有活动中的中奖次数和参与次数，由调用方计算中奖率，未参与过活动时均返回 0
+// 已退出的参与记录不计入
+func (l *lotteryDrawDAO) GetUserWinRate(ctx context.Context, userID int64) (int64, int64, error) {
+	var stats struct {
+		Wins    int64 `gorm:"column:wins"`
+		Entries int64 `gorm:"column:entries"`
+	}
+
+	if err := l.db.WithContext(ctx).
+		Model(&Participant{}).
+		Select("COALESCE(SUM(CASE WHEN is_winner THEN 1 ELSE 0 END), 0) AS wins, COUNT(*) AS entries").
+		Where("user_id = ? AND withdrawn = ?", userID, false).
+		Scan(&stats).Error; err != nil {
+		l.loggerFrom(ctx).Error("获取用户中奖率失败", zap.Int64("userID", userID), zap.Error(err))
+		return 0, 0, err
+	}
+
+	return stats.Wins, stats.Entries, nil
+}
+
+// participantActivityColumn 返回参与记录中关联 activityType 类型活动的列名
+func participantActivityColumn(activityType string) (string, error) {
+	switch activityType {
+	case domain.ActivityTypeLottery:
+		return "lottery_id", nil
+	case domain.ActivityTypeSecondKill:
+		return "second_kill_id", nil
+	default:
+		return "", fmt.Errorf("未知的活动类型 %q", activityType)
+	}
+}
+
+// RemoveUsersFromActivities 在同一事务中删除指定用户在指定活动中的参与记录，用于批量处置作弊用户，返回删除的记录数
+// 各活动的类型按 ResolveActivityType 的规则确定，任一活动不存在或类型不明确时不做任何删除；
+// 被删除的未退款秒杀抢购会归还库存，已退出或已退款的记录不重复归还；被删除的抽奖中奖记录归还奖品剩余数量，
+// 并为每个受影响的抽奖活动写入审计记录。ID 列表较多时按 feedIDChunkSize 分批删除
+func (l *lotteryDrawDAO) RemoveUsersFromActivities(ctx context.Context, activityIDs []int, userIDs []int64) (int64, error) {
+	if len(activityIDs) == 0 || len(userIDs) == 0 {
+		return 0, ErrEmptyIDs
+	}
+
+	var removed []Participant
+
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		byType, err := resolveActivityTypes(tx, activityIDs)
+		if err != nil {
+			return err
+		}
+
+		for _, activityType := range []string{domain.ActivityTypeLottery, domain.ActivityTypeSecondKill} {
+			ids := byType[activityType]
+			if len(ids) == 0 {
+				continue
+			}
+
+			column, err := participantActivityColumn(activityType)
+			if err != nil {
+				return err
+			}
+
+			for aStart := 0; aStart < len(ids); aStart += feedIDChunkSize {
+				aEnd := aStart + feedIDChunkSize
+				if aEnd > len(ids) {
+					aEnd = len(ids)
+				}
+				activities := ids[aStart:aEnd]
+
+				for uStart := 0; uStart < len(userIDs); uStart += feedIDChunkSize {
+					uEnd := uStart + feedIDChunkSize
+					if uEnd > len(userIDs) {
+						uEnd = len(userIDs)
+					}
+					users := userIDs[uStart:uEnd]
+
+					// 删除前读取将被删除的记录，用于归还秒杀库存、奖品数量和修正实时参与人数
+					var rows []Participant
+					if err := tx.Select("id", "lottery_id", "second_kill_id", "prize_id", "is_winner", "withdrawn").
+						Where(column+" IN ? AND user_id IN ?", activities, users).
+						Find(&rows).Error; err != nil {
+						return err
+					}
+
+					if len(rows) == 0 {
+						continue
+					}
+
+					if err := tx.Where(column+" IN ? AND user_id IN ?", activities, users).Delete(&Participant{}).Error; err != nil {
+						return err
+					}
+					removed = append(removed, rows...)
+				}
+			}
+		}
+
+		soldCounts := make(map[int]int64)
+		prizeCounts := make(map[int]int64)
+		auditIDs := make(map[int][]string)
+
+		for _, p := range removed {
+			switch {
+			case p.SecondKillID != nil:
+				if !p.Withdrawn {
+					soldCounts[*p.SecondKillID]++
+				}
+			case p.LotteryID != nil:
+				auditIDs[*p.LotteryID] = append(auditIDs[*p.LotteryID], p.ID)
+				if p.IsWinner && p.PrizeID != nil {
+					prizeCounts[*p.PrizeID]++
+				}
+			}
+		}
+
+		for eventID, count := range soldCounts {
+			if err := tx.Model(&SecondKillEvent{}).
+				Where("id = ?", eventID).
+				Update("sold_count", gorm.Expr("CASE WHEN sold_count > ? THEN sold_count - ? ELSE 0 END", count, count)).Error; err != nil {
+				return err
+			}
+		}
+
+		for prizeID, count := range prizeCounts {
+			if err := tx.Model(&Prize{}).
+				Where("id = ?", prizeID).
+				Update("remaining", gorm.Expr("CASE WHEN remaining + ? > quantity THEN quantity ELSE remaining + ? END", count, count)).Error; err != nil {
+				return err
+			}
+		}
+
+		for lotteryID, participantIDs := range auditIDs {
+			if err := tx.Create(&DrawAudit{
+				ActivityID:     lotteryID,
+				Actor:          actorFrom(ctx),
+				Action:         DrawAuditActionRemoveUsers,
+				ParticipantIDs: participantIDs,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrActivityNotFound) && !errors.Is(err, ErrAmbiguousActivityType) {
+			l.loggerFrom(ctx).Error("批量移除活动参与者失败",
+				zap.Int("activities", len(activityIDs)),
+				zap.Int("users", len(userIDs)),
+				zap.Error(err))
+		}
+		return 0, err
+	}
+
+	active := make(map[int]int64)
+	for _, p := range removed {
+		if p.LotteryID != nil && !p.Withdrawn {
+			active[*p.LotteryID]++
+		}
+	}
+	for lotteryID, count := range active {
+		l.incrLiveParticipantCount(ctx, lotteryID, -count)
+	}
+
+	l.loggerFrom(ctx).Info("已批量移除活动参与者",
+		zap.Int("activities", len(activityIDs)),
+		zap.Int("users", len(userIDs)),
+		zap.Int("removed", len(removed)),
+		zap.Int64("actor", actorFrom(ctx)))
+
+	return int64(len(removed)), nil
+}
+
+// resolveActivityTypes 按 ResolveActivityType 的规则批量确定活动类型，返回按类型分组的活动ID
+// 任一活动不存在时返回 ErrActivityNotFound，同时存在于两张表中时返回 ErrAmbiguousActivityType
+func resolveActivityTypes(db *gorm.DB, activityIDs []int) (map[string][]int, error) {
+	lotteries := make(map[int]struct{})
+	secondKills := make(map[int]struct{})
+
+	for start := 0; start < len(activityIDs); start += feedIDChunkSize {
+		end := start + feedIDChunkSize
+		if end > len(activityIDs) {
+			end = len(activityIDs)
+		}
+		chunk := activityIDs[start:end]
+
+		var ids []int
+		if err := db.Model(&LotteryDraw{}).Where("id IN ?", chunk).Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			lotteries[id] = struct{}{}
+		}
+
+		ids = nil
+		if err := db.Model(&SecondKillEvent{}).Where("id IN ?", chunk).Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			secondKills[id] = struct{}{}
+		}
+	}
+
+	byType := make(map[string][]int)
+	seen := make(map[int]struct{}, len(activityIDs))
+
+	for _, id := range activityIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		_, isLottery := lotteries[id]
+		_, isSecondKill := secondKills[id]
+
+		switch {
+		case isLottery && isSecondKill:
+			return nil, fmt.Errorf("活动 %d: %w", id, ErrAmbiguousActivityType)
+		case isLottery:
+			byType[domain.ActivityTypeLottery] = append(byType[domain.ActivityTypeLottery], id)
+		case isSecondKill:
+			byType[domain.ActivityTypeSecondKill] = append(byType[domain.ActivityTypeSecondKill], id)
+		default:
+			return nil, fmt.Errorf("活动 %d: %w", id, ErrActivityNotFound)
+		}
+	}
+
+	return byType, nil
+}
+
+// SnapshotActivity 在一个只读事务中读取活动的状态和各项统计，返回数值一致的快照，活动类型由 ResolveActivityType 确定，活动不存在时返回 ErrActivityNotFound
+// 事务使用 REPEATABLE READ 隔离级别：MySQL 驱动先设置隔离级别再以 START TRANSACTION READ ONLY 开启事务，
+// InnoDB 下事务内的所有读取基于同一个一致性快照，不会读到快照之后提交的参与或库存变化；
+// SQLite 驱动忽略这两项选项，以普通的 BEGIN 开启事务，其读事务本身即可看到一致的数据库状态
+func (l *lotteryDrawDAO) SnapshotActivity(ctx context.Context, activityID int) (ActivitySnapshot, error) {
+	activityType, err := l.ResolveActivityType(ctx, activityID)
+	if err != nil {
+		return ActivitySnapshot{}, err
+	}
+
+	column, err := participantActivityColumn(activityType)
+	if err != nil {
+		return ActivitySnapshot{}, err
+	}
+
+	snapshot := ActivitySnapshot{ActivityID: activityID, ActivityType: activityType}
+
+	err = l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		snapshot.SnapshotAt = time.Now().Unix()
+
+		if activityType == domain.ActivityTypeSecondKill {
+			var event SecondKillEvent
+			if err := tx.Select("name", "status", "stock", "sold_count").
+				Where("id = ?", activityID).
+				First(&event).Error; err != nil {
+				return err
+			}
+			snapshot.Name, snapshot.Status = event.Name, event.Status
+			snapshot.Stock, snapshot.SoldCount = event.Stock, event.SoldCount
+		} else {
+			var draw LotteryDraw
+			if err := tx.Select("name", "status").
+				Where("id = ?", activityID).
+				First(&draw).Error; err != nil {
+				return err
+			}
+			snapshot.Name, snapshot.Status = draw.Name, draw.Status
+
+			var prizes struct {
+				Quantity  int `gorm:"column:quantity"`
+				Remaining int `gorm:"column:remaining"`
+			}
+			if err := tx.Model(&Prize{}).
+				Select("COALESCE(SUM(quantity), 0) AS quantity, COALESCE(SUM(remaining), 0) AS remaining").
+				Where("lottery_id = ?", activityID).
+				Scan(&prizes).Error; err != nil {
+				return err
+			}
+			snapshot.PrizeQuantity, snapshot.PrizeRemaining = prizes.Quantity, prizes.Remaining
+		}
+
+		var counts struct {
+			Active      int64 `gorm:"column:active"`
+			Withdrawn   int64 `gorm:"column:withdrawn"`
+			UniqueUsers int64 `gorm:"column:unique_users"`
+			Winners     int64 `gorm:"column:winners"`
+		}
+		if err := tx.Model(&Participant{}).
+			Select("COALESCE(SUM(CASE WHEN withdrawn THEN 0 ELSE 1 END), 0) AS active, "+
+				"COALESCE(SUM(CASE WHEN withdrawn THEN 1 ELSE 0 END), 0) AS withdrawn, "+
+				"COUNT(DISTINCT CASE WHEN withdrawn THEN NULL ELSE user_id END) AS unique_users, "+
+				"COALESCE(SUM(CASE WHEN is_winner THEN 1 ELSE 0 END), 0) AS winners").
+			Where(column+" = ?", activityID).
+			Scan(&counts).Error; err != nil {
+			return err
+		}
+		snapshot.ParticipantCount, snapshot.WithdrawnCount = counts.Active, counts.Withdrawn
+		snapshot.UniqueUsers, snapshot.WinnerCount = counts.UniqueUsers, counts.Winners
+
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ActivitySnapshot{}, ErrActivityNotFound
+	}
+	if err != nil {
+		l.loggerFrom(ctx).Error("获取活动快照失败", zap.Int("activityID", activityID), zap.String("activityType", activityType), zap.Error(err))
+		return ActivitySnapshot{}, err
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,266 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoSimplicity/LinkMe/internal/domain"
+	"gorm.io/gorm"
+)
+
+// lotteryDrawDAOFactories 需要保持行为一致的 LotteryDrawDAO 实现，覆盖两种实现的测试遍历该表
+var lotteryDrawDAOFactories = map[string]func(t *testing.T) LotteryDrawDAO{
+	"gorm":     func(t *testing.T) LotteryDrawDAO { d, _ := newTestLotteryDrawDAO(t); return d },
+	"inMemory": func(*testing.T) LotteryDrawDAO { return NewInMemoryLotteryDrawDAO() },
+}
+
+// levelledLotteryDrawDAOFactories 与 lotteryDrawDAOFactories 相同，创建的实现按 resolve 查询用户等级
+var levelledLotteryDrawDAOFactories = map[string]func(t *testing.T, resolve UserLevelResolver) LotteryDrawDAO{
+	"gorm": func(t *testing.T, resolve UserLevelResolver) LotteryDrawDAO {
+		d, _ := newTestLotteryDrawDAO(t, WithUserLevelResolver(resolve))
+		return d
+	},
+	"inMemory": func(_ *testing.T, resolve UserLevelResolver) LotteryDrawDAO {
+		return NewInMemoryLotteryDrawDAO(WithInMemoryUserLevelResolver(resolve))
+	},
+}
+
+// fixedUserLevel 返回所有用户等级均为 level 的 UserLevelResolver
+func fixedUserLevel(level int) UserLevelResolver {
+	return func(context.Context, int64) (int, error) { return level, nil }
+}
+
+// setStoredImageURL 绕过写入校验直接修改已存储活动的图片地址，模拟校验上线前遗留的数据
+func setStoredImageURL(t *testing.T, d LotteryDrawDAO, id int, imageURL string) {
+	t.Helper()
+
+	switch impl := d.(type) {
+	case *lotteryDrawDAO:
+		if err := impl.db.Model(&LotteryDraw{}).Where("id = ?", id).Update("image_url", imageURL).Error; err != nil {
+			t.Fatalf("update image_url: %v", err)
+		}
+	case *inMemoryLotteryDrawDAO:
+		impl.mu.Lock()
+		defer impl.mu.Unlock()
+		draw := impl.lotteryDraws[id]
+		draw.ImageURL = imageURL
+		impl.lotteryDraws[id] = draw
+	default:
+		t.Fatalf("unsupported LotteryDrawDAO implementation %T", d)
+	}
+}
+
+// insertStoredParticipant 绕过 DAO 的校验直接写入参与记录，用于构造孤立记录等异常数据
+func insertStoredParticipant(t *testing.T, d LotteryDrawDAO, p Participant) {
+	t.Helper()
+
+	switch impl := d.(type) {
+	case *lotteryDrawDAO:
+		if err := impl.db.Create(&p).Error; err != nil {
+			t.Fatalf("create participant: %v", err)
+		}
+	case *inMemoryLotteryDrawDAO:
+		impl.mu.Lock()
+		defer impl.mu.Unlock()
+		impl.participants[p.ID] = p
+	default:
+		t.Fatalf("unsupported LotteryDrawDAO implementation %T", d)
+	}
+}
+
+func TestConformanceLotteryDrawRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	want := LotteryDraw{
+		Name:                 "draw",
+		Description:          "description",
+		ImageURL:             "https://example.com/draw.png",
+		StartTime:            100,
+		EndTime:              200,
+		EntryStartTime:       90,
+		EntryEndTime:         150,
+		Status:               domain.LotteryStatusPending,
+		MinUserLevel:         2,
+		MinParticipants:      3,
+		MaxParticipants:      10,
+		MaxEntriesPerUser:    1,
+		EntryCooldownSeconds: 30,
+	}
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, want); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			got, err := d.GetLotteryDrawByID(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+
+			if got.Name != want.Name || got.Description != want.Description || got.ImageURL != want.ImageURL ||
+				got.StartTime != want.StartTime || got.EndTime != want.EndTime ||
+				got.EntryStartTime != want.EntryStartTime || got.EntryEndTime != want.EntryEndTime ||
+				got.Status != want.Status || got.MinUserLevel != want.MinUserLevel ||
+				got.MinParticipants != want.MinParticipants || got.MaxParticipants != want.MaxParticipants ||
+				got.MaxEntriesPerUser != want.MaxEntriesPerUser || got.EntryCooldownSeconds != want.EntryCooldownSeconds {
+				t.Errorf("GetLotteryDrawByID = %+v, want config of %+v", got, want)
+			}
+
+			// 种子在开奖前只公开摘要
+			if got.SeedHash == "" || got.Seed != "" || got.DrawnAt != 0 {
+				t.Errorf("seed hash = %q, seed = %q, drawn at = %d, want hash only", got.SeedHash, got.Seed, got.DrawnAt)
+			}
+
+			if _, err := d.GetLotteryDrawByID(ctx, 2); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("missing draw err = %v, want gorm.ErrRecordNotFound", err)
+			}
+			if _, err := d.GetSecondKillEventByID(ctx, 1); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("missing event err = %v, want gorm.ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestConformanceCreateRejectsInvalidImageURL(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: 100, EndTime: 200, ImageURL: "ftp://example.com/a.png"}); !errors.Is(err, ErrInvalidImageURL) {
+				t.Errorf("CreateLotteryDraw err = %v, want ErrInvalidImageURL", err)
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: 100, EndTime: 200, Stock: 1, ImageURL: "/relative.png"}); !errors.Is(err, ErrInvalidImageURL) {
+				t.Errorf("CreateSecondKillEvent err = %v, want ErrInvalidImageURL", err)
+			}
+		})
+	}
+}
+
+func TestConformanceCloneLotteryDraw(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	newSource := func() LotteryDraw {
+		return LotteryDraw{
+			Name:                 "source",
+			Description:          "description",
+			ImageURL:             "https://example.com/draw.png",
+			StartTime:            now - 60,
+			EndTime:              now + 3600,
+			Status:               domain.LotteryStatusActive,
+			MinUserLevel:         2,
+			MinParticipants:      1,
+			MaxParticipants:      10,
+			MaxEntriesPerUser:    1,
+			EntryCooldownSeconds: 30,
+			Prizes:               []Prize{{Name: "prize", Quantity: 3, Remaining: 1, Value: 50}},
+		}
+	}
+	source := newSource()
+
+	for name, newDAO := range levelledLotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t, fixedUserLevel(2))
+
+			if err := d.CreateLotteryDraw(ctx, newSource()); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+			sourceID := 1
+			if err := d.AddParticipant(ctx, Participant{ID: "entry", LotteryID: &sourceID, UserID: 1, ParticipatedAt: now}); err != nil {
+				t.Fatalf("AddParticipant: %v", err)
+			}
+
+			id, err := d.CloneLotteryDraw(ctx, sourceID, "clone", now+7200, now+10800)
+			if err != nil {
+				t.Fatalf("CloneLotteryDraw: %v", err)
+			}
+
+			clone, err := d.GetLotteryDrawByID(ctx, id)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			if clone.Name != "clone" || clone.Description != source.Description || clone.ImageURL != source.ImageURL ||
+				clone.StartTime != now+7200 || clone.EndTime != now+10800 || clone.Status != domain.LotteryStatusPending ||
+				clone.MinUserLevel != source.MinUserLevel || clone.MinParticipants != source.MinParticipants ||
+				clone.MaxParticipants != source.MaxParticipants || clone.MaxEntriesPerUser != source.MaxEntriesPerUser ||
+				clone.EntryCooldownSeconds != source.EntryCooldownSeconds {
+				t.Errorf("clone = %+v, want configuration copied from %+v", clone, source)
+			}
+			if len(clone.Participants) != 0 || clone.SeedHash == "" {
+				t.Errorf("clone participants = %d, seed hash = %q, want no participants and a fresh seed", len(clone.Participants), clone.SeedHash)
+			}
+
+			snapshot, err := d.SnapshotActivity(ctx, id)
+			if err != nil {
+				t.Fatalf("SnapshotActivity: %v", err)
+			}
+			if snapshot.PrizeQuantity != 3 || snapshot.PrizeRemaining != 3 {
+				t.Errorf("clone prizes = %d/%d remaining, want 3/3", snapshot.PrizeRemaining, snapshot.PrizeQuantity)
+			}
+
+			if _, err := d.CloneLotteryDraw(ctx, sourceID, "clone", now+7200, now+10800); !errors.Is(err, ErrDuplicateLotteryDrawName) {
+				t.Errorf("duplicate name err = %v, want ErrDuplicateLotteryDrawName", err)
+			}
+			if _, err := d.CloneLotteryDraw(ctx, 99, "missing", now+7200, now+10800); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("missing source err = %v, want gorm.ErrRecordNotFound", err)
+			}
+			if _, err := d.CloneLotteryDraw(ctx, sourceID, "window", now+10800, now+7200); !errors.Is(err, ErrInvalidTimeWindow) {
+				t.Errorf("invalid window err = %v, want ErrInvalidTimeWindow", err)
+			}
+
+			// 模板中遗留的不合法图片地址不能被复制到新活动
+			setStoredImageURL(t, d, sourceID, "javascript:alert(1)")
+			if _, err := d.CloneLotteryDraw(ctx, sourceID, "legacy", now+7200, now+10800); !errors.Is(err, ErrInvalidImageURL) {
+				t.Errorf("invalid source image err = %v, want ErrInvalidImageURL", err)
+			}
+			if exists, err := d.ExistsLotteryDrawByName(ctx, "legacy"); err != nil || exists {
+				t.Errorf("ExistsLotteryDrawByName(legacy) = %v, %v, want false", exists, err)
+			}
+		})
+	}
+}
+
+func TestConformanceWithdrawalCounts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, id := range []string{"a", "b"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+
+			if err := d.WithdrawParticipation(ctx, "a"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+			// 重复退出不报错
+			if err := d.WithdrawParticipation(ctx, "a"); err != nil {
+				t.Errorf("repeated WithdrawParticipation: %v", err)
+			}
+			if err := d.WithdrawParticipation(ctx, "missing"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("missing participant err = %v, want gorm.ErrRecordNotFound", err)
+			}
+
+			count, err := d.CountActiveParticipants(ctx, activityID)
+			if err != nil || count != 1 {
+				t.Errorf("CountActiveParticipants = %d, %v, want 1", count, err)
+			}
+		})
+	}
+}
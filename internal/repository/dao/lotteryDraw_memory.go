@@ -0,0 +1,2952 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoSimplicity/LinkMe/internal/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// inMemoryLotteryDrawDAO 基于内存的 LotteryDrawDAO 实现，适用于测试和单节点演示
+//
+// 一致性说明：
+//   - 数据仅保存在当前进程内存中，进程重启后丢失，多实例之间不共享
+//   - 所有读写由同一把读写锁保护，单个方法内的校验和修改是原子的，
+//     但多个方法调用之间没有事务语义
+//   - 返回的模型均为副本，修改返回值不会影响已保存的数据
+//   - WithRedis、WithPoolConfig、WithClaimIsolationLevel、WithMaxConcurrentDraws、WithNameExistsCache 等数据库相关选项不适用
+type inMemoryLotteryDrawDAO struct {
+	mu sync.RWMutex
+
+	lotteryDraws     map[int]LotteryDraw
+	secondKillEvents map[int]SecondKillEvent
+	participants     map[string]Participant
+	prizes           map[int]Prize
+	audits           []DrawAudit
+	reservations     map[string]SecondKillReservation
+	// drawSeeds 尚未开奖的抽奖活动的开奖种子，开奖前不保存在活动模型中，避免随查询结果返回
+	drawSeeds map[int]string
+	// refunding 正在执行退款回调的参与记录，防止回调执行期间重复退款
+	refunding map[string]struct{}
+
+	nextLotteryID    int
+	nextSecondKillID int
+	nextPrizeID      int
+	nextAuditID      int64
+
+	// userLevel 查询用户等级，为空时所有用户按等级 0 处理
+	userLevel UserLevelResolver
+}
+
+// InMemoryLotteryDrawDAOOption 内存抽奖 DAO 的可选配置
+type InMemoryLotteryDrawDAOOption func(*inMemoryLotteryDrawDAO)
+
+// WithInMemoryUserLevelResolver 与 WithUserLevelResolver 相同，设置用户等级的查询方式
+func WithInMemoryUserLevelResolver(resolve UserLevelResolver) InMemoryLotteryDrawDAOOption {
+	return func(m *inMemoryLotteryDrawDAO) {
+		m.userLevel = resolve
+	}
+}
+
+// NewInMemoryLotteryDrawDAO 创建基于内存的抽奖 DAO
+func NewInMemoryLotteryDrawDAO(opts ...InMemoryLotteryDrawDAOOption) LotteryDrawDAO {
+	m := &inMemoryLotteryDrawDAO{
+		lotteryDraws:     make(map[int]LotteryDraw),
+		secondKillEvents: make(map[int]SecondKillEvent),
+		participants:     make(map[string]Participant),
+		prizes:           make(map[int]Prize),
+		reservations:     make(map[string]SecondKillReservation),
+		drawSeeds:        make(map[int]string),
+		refunding:        make(map[string]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// cloneParticipant 复制参与记录，避免元数据 map 在调用方和存储之间共享
+func cloneParticipant(p Participant) Participant {
+	if p.Metadata != nil {
+		metadata := make(map[string]string, len(p.Metadata))
+		for k, v := range p.Metadata {
+			metadata[k] = v
+		}
+		p.Metadata = metadata
+	}
+
+	if p.ExternalRef != nil {
+		ref := *p.ExternalRef
+		p.ExternalRef = &ref
+	}
+
+	return p
+}
+
+// sortParticipants 与 orderParticipants 保持一致，按参与时间和ID排序
+func sortParticipants(participants []Participant) {
+	sort.Slice(participants, func(i, j int) bool {
+		if participants[i].ParticipatedAt != participants[j].ParticipatedAt {
+			return participants[i].ParticipatedAt < participants[j].ParticipatedAt
+		}
+		return participants[i].ID < participants[j].ID
+	})
+}
+
+// pageSlice 根据 limit 和 offset 计算切片范围
+func pageSlice(n, limit, offset int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+
+	return offset, end
+}
+
+// filterParticipants 返回满足条件的参与记录副本，按参与时间和ID排序，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) filterParticipants(match func(Participant) bool) []Participant {
+	var result []Participant
+
+	for _, p := range m.participants {
+		if match(p) {
+			result = append(result, cloneParticipant(p))
+		}
+	}
+
+	sortParticipants(result)
+
+	return result
+}
+
+func inLottery(activityID int) func(Participant) bool {
+	return func(p Participant) bool {
+		return p.LotteryID != nil && *p.LotteryID == activityID
+	}
+}
+
+func inSecondKill(eventID int) func(Participant) bool {
+	return func(p Participant) bool {
+		return p.SecondKillID != nil && *p.SecondKillID == eventID
+	}
+}
+
+// lotteryDrawWithParticipants 返回附带参与者列表的抽奖活动副本，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) lotteryDrawWithParticipants(draw LotteryDraw) LotteryDraw {
+	draw.Participants = m.filterParticipants(inLottery(draw.ID))
+	return draw
+}
+
+// secondKillEventWithParticipants 返回附带参与者列表的秒杀活动副本，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) secondKillEventWithParticipants(event SecondKillEvent) SecondKillEvent {
+	event.Participants = m.filterParticipants(inSecondKill(event.ID))
+	return event
+}
+
+// sortedLotteryDraws 返回满足条件的抽奖活动，按ID排序，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) sortedLotteryDraws(match func(LotteryDraw) bool) []LotteryDraw {
+	var result []LotteryDraw
+
+	for _, draw := range m.lotteryDraws {
+		if match(draw) {
+			result = append(result, draw)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+// sortedSecondKillEvents 返回满足条件的秒杀活动，按ID排序，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) sortedSecondKillEvents(match func(SecondKillEvent) bool) []SecondKillEvent {
+	var result []SecondKillEvent
+
+	for _, event := range m.secondKillEvents {
+		if match(event) {
+			result = append(result, event)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+// storeLotteryDraw 保存抽奖活动及其关联的奖品和参与者，未设置开奖种子时自动生成，调用方需持有写锁
+func (m *inMemoryLotteryDrawDAO) storeLotteryDraw(model LotteryDraw) (int, error) {
+	if err := ensureDrawSeed(&model); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+
+	m.nextLotteryID++
+	model.ID = m.nextLotteryID
+	model.CreatedAt = now
+	model.UpdatedAt = now
+
+	for _, prize := range model.Prizes {
+		m.nextPrizeID++
+		prize.ID = m.nextPrizeID
+		prize.LotteryID = model.ID
+		prize.CreatedAt = now
+		prize.UpdatedAt = now
+		m.prizes[prize.ID] = prize
+	}
+
+	for _, p := range model.Participants {
+		p.LotteryID = &model.ID
+		m.participants[p.ID] = cloneParticipant(p)
+	}
+
+	m.drawSeeds[model.ID] = model.Seed
+
+	model.Seed = ""
+	model.Prizes = nil
+	model.Participants = nil
+	m.lotteryDraws[model.ID] = model
+
+	return model.ID, nil
+}
+
+// CreateLotteryDraw 创建一个新的抽奖活动
+func (m *inMemoryLotteryDrawDAO) CreateLotteryDraw(ctx context.Context, model LotteryDraw) error {
+	if err := validateImageURL(model.ImageURL); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.storeLotteryDraw(model)
+
+	return err
+}
+
+// GetLotteryDrawByID 根据ID获取指定的抽奖活动
+func (m *inMemoryLotteryDrawDAO) GetLotteryDrawByID(ctx context.Context, id int) (LotteryDraw, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draw, ok := m.lotteryDraws[id]
+	if !ok {
+		return LotteryDraw{}, gorm.ErrRecordNotFound
+	}
+
+	return m.lotteryDrawWithParticipants(draw), nil
+}
+
+// ListLotteryDraws 获取所有抽奖活动，支持状态过滤和分页
+func (m *inMemoryLotteryDrawDAO) ListLotteryDraws(ctx context.Context, status string, pagination domain.Pagination) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	status, err := normalizeStatus(status, lotteryStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDraw{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return status == "" || d.Status == status
+	})
+
+	start, end := pageSlice(len(draws), limit, offset)
+
+	result := make([]LotteryDraw, 0, end-start)
+	for _, draw := range draws[start:end] {
+		result = append(result, m.lotteryDrawWithParticipants(draw))
+	}
+
+	return result, nil
+}
+
+// ExistsLotteryDrawByName 检查抽奖活动名称是否存在
+func (m *inMemoryLotteryDrawDAO) ExistsLotteryDrawByName(ctx context.Context, name string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, draw := range m.lotteryDraws {
+		if draw.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ExtendLotteryDraw 延长进行中抽奖活动的结束时间，只允许向后延长
+func (m *inMemoryLotteryDrawDAO) ExtendLotteryDraw(ctx context.Context, id int, newEndTime int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	draw, ok := m.lotteryDraws[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	if draw.Status != domain.LotteryStatusActive {
+		return ErrLotteryDrawNotActive
+	}
+
+	if newEndTime <= draw.EndTime {
+		return ErrInvalidEndTime
+	}
+
+	draw.EndTime = newEndTime
+	draw.UpdatedAt = time.Now().Unix()
+	m.lotteryDraws[id] = draw
+
+	return nil
+}
+
+// HasUserParticipatedInLottery 检查用户是否已参与某个抽奖活动
+func (m *inMemoryLotteryDrawDAO) HasUserParticipatedInLottery(ctx context.Context, id int, userID int64) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.participants {
+		if p.LotteryID != nil && *p.LotteryID == id && p.UserID == userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CreateSecondKillEvent 创建一个新的秒杀活动
+func (m *inMemoryLotteryDrawDAO) CreateSecondKillEvent(ctx context.Context, model SecondKillEvent) error {
+	if err := validateImageURL(model.ImageURL); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	m.nextSecondKillID++
+	model.ID = m.nextSecondKillID
+	model.CreatedAt = now
+	model.UpdatedAt = now
+
+	for _, p := range model.Participants {
+		p.SecondKillID = &model.ID
+		m.participants[p.ID] = cloneParticipant(p)
+	}
+
+	model.Participants = nil
+	m.secondKillEvents[model.ID] = model
+
+	return nil
+}
+
+// GetSecondKillEventByID 根据ID获取指定的秒杀活动
+func (m *inMemoryLotteryDrawDAO) GetSecondKillEventByID(ctx context.Context, id int) (SecondKillEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	event, ok := m.secondKillEvents[id]
+	if !ok {
+		return SecondKillEvent{}, gorm.ErrRecordNotFound
+	}
+
+	return m.secondKillEventWithParticipants(event), nil
+}
+
+// ListSecondKillEvents 获取所有秒杀活动，支持状态过滤和分页
+func (m *inMemoryLotteryDrawDAO) ListSecondKillEvents(ctx context.Context, status string, pagination domain.Pagination) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	status, err := normalizeStatus(status, secondKillStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []SecondKillEvent{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := m.sortedSecondKillEvents(func(e SecondKillEvent) bool {
+		return status == "" || e.Status == status
+	})
+
+	start, end := pageSlice(len(events), limit, offset)
+
+	result := make([]SecondKillEvent, 0, end-start)
+	for _, event := range events[start:end] {
+		result = append(result, m.secondKillEventWithParticipants(event))
+	}
+
+	return result, nil
+}
+
+// ExistsSecondKillEventByName 检查秒杀活动名称是否存在
+func (m *inMemoryLotteryDrawDAO) ExistsSecondKillEventByName(ctx context.Context, name string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, event := range m.secondKillEvents {
+		if event.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// HasUserParticipatedInSecondKill 检查用户是否已参与某个秒杀活动
+func (m *inMemoryLotteryDrawDAO) HasUserParticipatedInSecondKill(ctx context.Context, id int, userID int64) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.participants {
+		if p.SecondKillID != nil && *p.SecondKillID == id && p.UserID == userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// checkParticipationAllowed 与数据库实现相同，校验用户能否以 model 参与其所属的活动，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) checkParticipationAllowed(ctx context.Context, model Participant) error {
+	rules, state, err := m.loadParticipation(model)
+	if err != nil {
+		return err
+	}
+
+	userLevel, err := resolveUserLevel(ctx, m.userLevel, model.UserID, rules.MinUserLevel)
+	if err != nil {
+		return err
+	}
+
+	enteredAt := model.ParticipatedAt
+	if enteredAt == 0 {
+		enteredAt = time.Now().Unix()
+	}
+
+	return evaluateParticipation(rules, state, model.LotteryID != nil, userLevel, enteredAt)
+}
+
+// loadParticipation 与数据库实现相同，返回 model 所属活动的参与规则及判定所需的计数，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) loadParticipation(model Participant) (participationRules, participationState, error) {
+	var state participationState
+
+	switch {
+	case model.LotteryID != nil:
+		draw, ok := m.lotteryDraws[*model.LotteryID]
+		if !ok {
+			return participationRules{}, state, ErrActivityNotFound
+		}
+
+		for _, p := range m.participants {
+			if p.LotteryID == nil || *p.LotteryID != draw.ID {
+				continue
+			}
+
+			if !p.Withdrawn {
+				state.Participants++
+				if p.UserID == model.UserID {
+					state.UserEntries++
+				}
+			}
+
+			if p.UserID == model.UserID && p.ParticipatedAt > state.UserLastEntry {
+				state.UserLastEntry = p.ParticipatedAt
+			}
+		}
+
+		return lotteryParticipationRules(draw), state, nil
+	case model.SecondKillID != nil:
+		event, ok := m.secondKillEvents[*model.SecondKillID]
+		if !ok {
+			return participationRules{}, state, ErrActivityNotFound
+		}
+
+		return participationRules{Status: event.Status, Locked: event.ParticipationLocked, MinUserLevel: event.MinUserLevel}, state, nil
+	default:
+		return participationRules{}, state, ErrActivityNotFound
+	}
+}
+
+// AddParticipant 添加参与者，参与规则与数据库实现共用 evaluateParticipation，外部参与编号非空时校验其在同一活动内唯一
+func (m *inMemoryLotteryDrawDAO) AddParticipant(ctx context.Context, model Participant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkParticipationAllowed(ctx, model); err != nil {
+		return err
+	}
+
+	var sameActivity func(Participant) bool
+	if model.LotteryID != nil {
+		sameActivity = inLottery(*model.LotteryID)
+	} else {
+		sameActivity = inSecondKill(*model.SecondKillID)
+	}
+
+	if model.ExternalRef != nil {
+		for _, p := range m.participants {
+			if sameActivity(p) && p.ExternalRef != nil && *p.ExternalRef == *model.ExternalRef {
+				return ErrDuplicateExternalRef
+			}
+		}
+	}
+
+	if _, ok := m.participants[model.ID]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+
+	m.participants[model.ID] = cloneParticipant(model)
+
+	return nil
+}
+
+// ListPendingLotteryDraws 获取所有待激活的抽奖活动
+func (m *inMemoryLotteryDrawDAO) ListPendingLotteryDraws(ctx context.Context, currentTime int64) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return d.Status == domain.LotteryStatusPending && d.StartTime <= currentTime
+	})
+
+	for i := range draws {
+		draws[i] = m.lotteryDrawWithParticipants(draws[i])
+	}
+
+	return draws, nil
+}
+
+// UpdateLotteryDrawStatus 更新抽奖活动的状态
+func (m *inMemoryLotteryDrawDAO) UpdateLotteryDrawStatus(ctx context.Context, id int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if draw, ok := m.lotteryDraws[id]; ok {
+		draw.Status = status
+		draw.UpdatedAt = time.Now().Unix()
+		m.lotteryDraws[id] = draw
+	}
+
+	return nil
+}
+
+// ListPendingSecondKillEvents 获取所有待激活的秒杀活动
+func (m *inMemoryLotteryDrawDAO) ListPendingSecondKillEvents(ctx context.Context, currentTime int64) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := m.sortedSecondKillEvents(func(e SecondKillEvent) bool {
+		return e.Status == domain.SecondKillStatusPending && e.StartTime <= currentTime
+	})
+
+	for i := range events {
+		events[i] = m.secondKillEventWithParticipants(events[i])
+	}
+
+	return events, nil
+}
+
+// UpdateSecondKillEventStatus 更新秒杀活动的状态
+func (m *inMemoryLotteryDrawDAO) UpdateSecondKillEventStatus(ctx context.Context, id int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if event, ok := m.secondKillEvents[id]; ok {
+		event.Status = status
+		event.UpdatedAt = time.Now().Unix()
+		m.secondKillEvents[id] = event
+	}
+
+	return nil
+}
+
+// ListActiveLotteryDraws 获取所有进行中的抽奖活动
+func (m *inMemoryLotteryDrawDAO) ListActiveLotteryDraws(ctx context.Context, currentTime int64) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return d.Status == domain.LotteryStatusActive && d.StartTime <= currentTime && d.EndTime >= currentTime
+	})
+
+	for i := range draws {
+		draws[i] = m.lotteryDrawWithParticipants(draws[i])
+	}
+
+	return draws, nil
+}
+
+// ListActiveSecondKillEvents 获取所有进行中的秒杀活动
+func (m *inMemoryLotteryDrawDAO) ListActiveSecondKillEvents(ctx context.Context, currentTime int64) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := m.sortedSecondKillEvents(func(e SecondKillEvent) bool {
+		return e.Status == domain.SecondKillStatusActive && e.StartTime <= currentTime && e.EndTime >= currentTime
+	})
+
+	for i := range events {
+		events[i] = m.secondKillEventWithParticipants(events[i])
+	}
+
+	return events, nil
+}
+
+// GlobalParticipationByDay 统计时间范围内全平台每天的参与次数，缺失的日期补零
+func (m *inMemoryLotteryDrawDAO) GlobalParticipationByDay(ctx context.Context, fromTs, toTs int64) ([]DayCount, error) {
+	if fromTs > toTs {
+		return []DayCount{}, nil
+	}
+
+	m.mu.RLock()
+	counts := make(map[int64]int64)
+	for _, p := range m.participants {
+		if p.ParticipatedAt >= fromTs && p.ParticipatedAt <= toTs {
+			counts[p.ParticipatedAt-p.ParticipatedAt%secondsPerDay]++
+		}
+	}
+	m.mu.RUnlock()
+
+	firstDay := fromTs - fromTs%secondsPerDay
+	lastDay := toTs - toTs%secondsPerDay
+
+	result := make([]DayCount, 0, (lastDay-firstDay)/secondsPerDay+1)
+	for day := firstDay; day <= lastDay; day += secondsPerDay {
+		result = append(result, DayCount{Day: day, Count: counts[day]})
+	}
+
+	return result, nil
+}
+
+// ListStuckActiveDraws 获取已过结束时间但仍处于进行中的抽奖活动
+func (m *inMemoryLotteryDrawDAO) ListStuckActiveDraws(ctx context.Context, now int64) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return d.Status == domain.LotteryStatusActive && d.EndTime < now
+	})
+
+	sort.SliceStable(draws, func(i, j int) bool { return draws[i].EndTime < draws[j].EndTime })
+
+	return draws, nil
+}
+
+// ListStuckActiveSecondKillEvents 获取已过结束时间但仍处于进行中的秒杀活动
+func (m *inMemoryLotteryDrawDAO) ListStuckActiveSecondKillEvents(ctx context.Context, now int64) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := m.sortedSecondKillEvents(func(e SecondKillEvent) bool {
+		return e.Status == domain.SecondKillStatusActive && e.EndTime < now
+	})
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].EndTime < events[j].EndTime })
+
+	return events, nil
+}
+
+// ResolveActivityType 根据活动ID判断其属于抽奖还是秒杀活动
+func (m *inMemoryLotteryDrawDAO) ResolveActivityType(ctx context.Context, activityID int) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, isLottery := m.lotteryDraws[activityID]
+	_, isSecondKill := m.secondKillEvents[activityID]
+
+	switch {
+	case isLottery && isSecondKill:
+		return "", ErrAmbiguousActivityType
+	case isLottery:
+		return domain.ActivityTypeLottery, nil
+	case isSecondKill:
+		return domain.ActivityTypeSecondKill, nil
+	default:
+		return "", ErrActivityNotFound
+	}
+}
+
+// WithdrawParticipation 将参与记录标记为已退出，保留记录用于审计
+// 抽奖活动结束或已开奖后退出返回 ErrWithdrawalClosed；已退出的记录重复退出直接返回成功
+func (m *inMemoryLotteryDrawDAO) WithdrawParticipation(ctx context.Context, participantID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.participants[participantID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	if p.Withdrawn {
+		return nil
+	}
+
+	if p.LotteryID != nil {
+		if draw, ok := m.lotteryDraws[*p.LotteryID]; ok && withdrawalClosed(draw.EndTime, draw.DrawnAt, time.Now().Unix()) {
+			return ErrWithdrawalClosed
+		}
+	}
+
+	p.Withdrawn = true
+	m.participants[participantID] = p
+
+	return nil
+}
+
+// CountActiveParticipants 统计抽奖活动中未退出的参与人数
+func (m *inMemoryLotteryDrawDAO) CountActiveParticipants(ctx context.Context, activityID int) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, p := range m.participants {
+		if p.LotteryID != nil && *p.LotteryID == activityID && !p.Withdrawn {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// ListDrawAudits 分页获取抽奖活动的开奖审计记录，按时间倒序排列
+func (m *inMemoryLotteryDrawDAO) ListDrawAudits(ctx context.Context, activityID int, pagination domain.Pagination) ([]DrawAudit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []DrawAudit{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var audits []DrawAudit
+	for _, audit := range m.audits {
+		if audit.ActivityID == activityID {
+			audit.ParticipantIDs = append([]string(nil), audit.ParticipantIDs...)
+			audits = append(audits, audit)
+		}
+	}
+
+	sort.Slice(audits, func(i, j int) bool {
+		if audits[i].CreatedAt != audits[j].CreatedAt {
+			return audits[i].CreatedAt > audits[j].CreatedAt
+		}
+		return audits[i].ID > audits[j].ID
+	})
+
+	start, end := pageSlice(len(audits), limit, offset)
+
+	return audits[start:end], nil
+}
+
+// InstantDraw 即开型抽奖（刮刮卡），用户参与时按中奖概率立即开奖，奖品不足时判定为未中奖
+func (m *inMemoryLotteryDrawDAO) InstantDraw(ctx context.Context, activityID int, userID int64, winProbability float64) (bool, Participant, error) {
+	if winProbability < 0 || winProbability > 1 {
+		return false, Participant{}, ErrInvalidWinProbability
+	}
+
+	participant := Participant{
+		ID:             uuid.New().String(),
+		LotteryID:      &activityID,
+		UserID:         userID,
+		ParticipatedAt: time.Now().Unix(),
+	}
+
+	hit := rand.Float64() < winProbability
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkParticipationAllowed(ctx, participant); err != nil {
+		return false, Participant{}, err
+	}
+
+	if hit {
+		prizeID := 0
+		for id, prize := range m.prizes {
+			if prize.LotteryID == activityID && prize.Remaining > 0 && (prizeID == 0 || id < prizeID) {
+				prizeID = id
+			}
+		}
+
+		if prizeID != 0 {
+			prize := m.prizes[prizeID]
+			prize.Remaining--
+			prize.UpdatedAt = time.Now().Unix()
+			m.prizes[prizeID] = prize
+
+			participant.IsWinner = true
+			participant.PrizeID = &prize.ID
+		}
+	}
+
+	m.participants[participant.ID] = participant
+
+	return participant.IsWinner, participant, nil
+}
+
+// BulkCreateLotteryDraws 批量创建抽奖活动，任一条目校验失败或重名时整批不创建
+func (m *inMemoryLotteryDrawDAO) BulkCreateLotteryDraws(ctx context.Context, models []LotteryDraw) (BatchResult, error) {
+	return m.bulkCreateLotteryDraws(models, true)
+}
+
+// BulkCreateLotteryDrawsBestEffort 批量创建抽奖活动并逐条报告结果，不合法或重名的条目不影响其余条目
+func (m *inMemoryLotteryDrawDAO) BulkCreateLotteryDrawsBestEffort(ctx context.Context, models []LotteryDraw) (BatchResult, error) {
+	return m.bulkCreateLotteryDraws(models, false)
+}
+
+// bulkCreateLotteryDraws 批量创建抽奖活动，校验失败的条目记为失败，重名的条目记为跳过；
+// atomic 为 true 时任一条目失败或跳过则整批不创建
+func (m *inMemoryLotteryDrawDAO) bulkCreateLotteryDraws(models []LotteryDraw, atomic bool) (BatchResult, error) {
+	var result BatchResult
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	taken := make(map[string]struct{}, len(m.lotteryDraws)+len(models))
+	for _, draw := range m.lotteryDraws {
+		taken[draw.Name] = struct{}{}
+	}
+
+	candidates := make([]int, 0, len(models))
+	for i, model := range models {
+		if model.StartTime >= model.EndTime {
+			result.fail(i, ErrInvalidTimeWindow)
+			if atomic {
+				return result, bulkItemError(i, ErrInvalidTimeWindow)
+			}
+			continue
+		}
+
+		if err := validateImageURL(model.ImageURL); err != nil {
+			result.fail(i, err)
+			if atomic {
+				return result, bulkItemError(i, err)
+			}
+			continue
+		}
+
+		if _, ok := taken[model.Name]; ok {
+			result.skip(i, ErrDuplicateLotteryDrawName.Error())
+			if atomic {
+				return result, bulkItemError(i, ErrDuplicateLotteryDrawName)
+			}
+			continue
+		}
+
+		taken[model.Name] = struct{}{}
+		candidates = append(candidates, i)
+	}
+
+	for _, i := range candidates {
+		if _, err := m.storeLotteryDraw(models[i]); err != nil {
+			return result, err
+		}
+		result.Succeeded = append(result.Succeeded, i)
+	}
+
+	return result, nil
+}
+
+// ListUserWins 分页获取用户在各抽奖活动中的中奖记录，按参与时间倒序排列
+func (m *inMemoryLotteryDrawDAO) ListUserWins(ctx context.Context, userID int64, pagination domain.Pagination) ([]WinRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []WinRecord{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wins := m.filterParticipants(func(p Participant) bool {
+		if p.UserID != userID || !p.IsWinner || p.LotteryID == nil {
+			return false
+		}
+		_, ok := m.lotteryDraws[*p.LotteryID]
+		return ok
+	})
+
+	sort.Slice(wins, func(i, j int) bool {
+		if wins[i].ParticipatedAt != wins[j].ParticipatedAt {
+			return wins[i].ParticipatedAt > wins[j].ParticipatedAt
+		}
+		return wins[i].ID > wins[j].ID
+	})
+
+	start, end := pageSlice(len(wins), limit, offset)
+
+	records := make([]WinRecord, 0, end-start)
+	for _, p := range wins[start:end] {
+		record := WinRecord{
+			ParticipantID:  p.ID,
+			ActivityID:     *p.LotteryID,
+			ActivityName:   m.lotteryDraws[*p.LotteryID].Name,
+			PrizeID:        p.PrizeID,
+			ParticipatedAt: p.ParticipatedAt,
+		}
+		if p.PrizeID != nil {
+			record.PrizeName = m.prizes[*p.PrizeID].Name
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// CloneLotteryDraw 以已有抽奖活动为模板复制出新的待开始活动，复制活动配置和奖品，不复制参与者和中奖结果
+func (m *inMemoryLotteryDrawDAO) CloneLotteryDraw(ctx context.Context, sourceID int, newName string, newStart, newEnd int64) (int, error) {
+	if newStart >= newEnd {
+		return 0, ErrInvalidTimeWindow
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	source, ok := m.lotteryDraws[sourceID]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	for _, draw := range m.lotteryDraws {
+		if draw.Name == newName {
+			return 0, ErrDuplicateLotteryDrawName
+		}
+	}
+
+	if err := validateImageURL(source.ImageURL); err != nil {
+		return 0, err
+	}
+
+	clone := LotteryDraw{
+		Name:                 newName,
+		Description:          source.Description,
+		ImageURL:             source.ImageURL,
+		StartTime:            newStart,
+		EndTime:              newEnd,
+		Status:               domain.LotteryStatusPending,
+		Category:             source.Category,
+		MinUserLevel:         source.MinUserLevel,
+		MinParticipants:      source.MinParticipants,
+		MaxParticipants:      source.MaxParticipants,
+		MaxEntriesPerUser:    source.MaxEntriesPerUser,
+		EntryCooldownSeconds: source.EntryCooldownSeconds,
+	}
+
+	var prizeIDs []int
+	for id, prize := range m.prizes {
+		if prize.LotteryID == sourceID {
+			prizeIDs = append(prizeIDs, id)
+		}
+	}
+	sort.Ints(prizeIDs)
+
+	for _, id := range prizeIDs {
+		prize := m.prizes[id]
+		clone.Prizes = append(clone.Prizes, Prize{
+			Name:      prize.Name,
+			Quantity:  prize.Quantity,
+			Remaining: prize.Quantity,
+			Value:     prize.Value,
+		})
+	}
+
+	return m.storeLotteryDraw(clone)
+}
+
+// GroupParticipantsByMetaField 按元数据字段对抽奖活动的参与者分组
+func (m *inMemoryLotteryDrawDAO) GroupParticipantsByMetaField(ctx context.Context, activityID int, field string) (map[string][]Participant, error) {
+	if _, ok := participantMetaFields[field]; !ok {
+		return nil, ErrInvalidMetaField
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := make(map[string][]Participant)
+	for _, p := range m.filterParticipants(inLottery(activityID)) {
+		if value, ok := p.Metadata[field]; ok {
+			groups[value] = append(groups[value], p)
+		}
+	}
+
+	return groups, nil
+}
+
+// MarkWinners 将外部系统决定的中奖用户标记为中奖，未参与活动的用户记为跳过
+func (m *inMemoryLotteryDrawDAO) MarkWinners(ctx context.Context, activityID int, userIDs []int64) (BatchResult, error) {
+	var result BatchResult
+
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	wanted := make(map[int64]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = struct{}{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := make(map[int64]struct{})
+
+	for id, p := range m.participants {
+		if p.LotteryID == nil || *p.LotteryID != activityID || p.Withdrawn {
+			continue
+		}
+		if _, ok := wanted[p.UserID]; !ok {
+			continue
+		}
+
+		found[p.UserID] = struct{}{}
+		if !p.IsWinner {
+			p.IsWinner = true
+			m.participants[id] = p
+		}
+	}
+
+	for i, id := range userIDs {
+		if _, ok := found[id]; ok {
+			result.Succeeded = append(result.Succeeded, i)
+		} else {
+			result.skip(i, "用户未参与该活动")
+		}
+	}
+
+	return result, nil
+}
+
+// joinedBy 判断用户是否参与过该活动，includeWithdrawn 为 false 时忽略已退出的记录，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) joinedBy(match func(Participant) bool, userID int64, includeWithdrawn bool) bool {
+	for _, p := range m.participants {
+		if p.UserID == userID && match(p) && (includeWithdrawn || !p.Withdrawn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lotterySummary(d LotteryDraw) ActivitySummary {
+	return ActivitySummary{ID: d.ID, Type: domain.ActivityTypeLottery, Name: d.Name, StartTime: d.StartTime, EndTime: d.EndTime, Status: d.Status}
+}
+
+func secondKillSummary(e SecondKillEvent) ActivitySummary {
+	return ActivitySummary{ID: e.ID, Type: domain.ActivityTypeSecondKill, Name: e.Name, StartTime: e.StartTime, EndTime: e.EndTime, Status: e.Status}
+}
+
+// GetNextEligibleActivity 获取用户满足参与条件且尚未参与的、最近即将开始的活动
+func (m *inMemoryLotteryDrawDAO) GetNextEligibleActivity(ctx context.Context, userID int64, userLevel int, now int64) (ActivitySummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var next *ActivitySummary
+	consider := func(s ActivitySummary) {
+		if next == nil || s.StartTime < next.StartTime || (s.StartTime == next.StartTime && s.Type == next.Type && s.ID < next.ID) {
+			next = &s
+		}
+	}
+
+	for _, d := range m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return d.Status == domain.LotteryStatusPending && d.StartTime > now && d.MinUserLevel <= userLevel &&
+			!m.joinedBy(inLottery(d.ID), userID, true)
+	}) {
+		consider(lotterySummary(d))
+	}
+
+	for _, e := range m.sortedSecondKillEvents(func(e SecondKillEvent) bool {
+		return e.Status == domain.SecondKillStatusPending && e.StartTime > now && e.MinUserLevel <= userLevel &&
+			!m.joinedBy(inSecondKill(e.ID), userID, true)
+	}) {
+		consider(secondKillSummary(e))
+	}
+
+	if next == nil {
+		return ActivitySummary{}, ErrNoUpcomingActivity
+	}
+
+	return *next, nil
+}
+
+// CountSecondKillOutcomes 统计结束时间在范围内的已完成秒杀活动中，售罄与未售罄的数量
+func (m *inMemoryLotteryDrawDAO) CountSecondKillOutcomes(ctx context.Context, fromTs, toTs int64) (int64, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var soldOut, expiredWithStock int64
+	for _, e := range m.secondKillEvents {
+		if e.Status != domain.SecondKillStatusCompleted || e.EndTime < fromTs || e.EndTime > toTs {
+			continue
+		}
+		if e.SoldCount >= e.Stock {
+			soldOut++
+		} else {
+			expiredWithStock++
+		}
+	}
+
+	return soldOut, expiredWithStock, nil
+}
+
+// DrawWinners 对抽奖活动开奖，从未退出的参与者中随机抽取中奖者并按奖品顺序分配奖品
+func (m *inMemoryLotteryDrawDAO) DrawWinners(ctx context.Context, activityID int, winnerCount int) ([]Participant, error) {
+	if winnerCount <= 0 {
+		return nil, ErrInvalidWinnerCount
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	draw, ok := m.lotteryDraws[activityID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if err := checkDrawStatus(draw.Status); err != nil {
+		return nil, err
+	}
+
+	for _, p := range m.participants {
+		if p.LotteryID != nil && *p.LotteryID == activityID && p.IsWinner {
+			return nil, ErrAlreadyDrawn
+		}
+	}
+
+	candidates := m.filterParticipants(func(p Participant) bool {
+		return p.LotteryID != nil && *p.LotteryID == activityID && !p.Withdrawn
+	})
+
+	if draw.MinParticipants > 0 && len(candidates) < draw.MinParticipants {
+		// 内存实现不持有 cancelBelowMin 配置，人数不足时始终拒绝开奖
+		return nil, ErrBelowMinParticipants
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoParticipants
+	}
+
+	if draw.DrawnAt > 0 {
+		return nil, ErrAlreadyDrawn
+	}
+
+	draw.Seed = m.drawSeeds[activityID]
+	if err := ensureDrawSeed(&draw); err != nil {
+		return nil, err
+	}
+
+	candidateIDs := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		candidateIDs = append(candidateIDs, c.ID)
+	}
+	candidateIDs = selectWinnerIDs(candidateIDs, draw.Seed, winnerCount)
+
+	var prizeIDs []int
+	for id, prize := range m.prizes {
+		if prize.LotteryID == activityID && prize.Remaining > 0 {
+			prizeIDs = append(prizeIDs, id)
+		}
+	}
+	sort.Ints(prizeIDs)
+
+	now := time.Now().Unix()
+	prizeIdx := 0
+	winners := make([]Participant, 0, len(candidateIDs))
+
+	for _, id := range candidateIDs {
+		p := m.participants[id]
+		p.IsWinner = true
+
+		for prizeIdx < len(prizeIDs) && m.prizes[prizeIDs[prizeIdx]].Remaining == 0 {
+			prizeIdx++
+		}
+
+		if prizeIdx < len(prizeIDs) {
+			prize := m.prizes[prizeIDs[prizeIdx]]
+			prize.Remaining--
+			prize.UpdatedAt = now
+			m.prizes[prize.ID] = prize
+			p.PrizeID = &prize.ID
+		}
+
+		m.participants[p.ID] = p
+		winners = append(winners, cloneParticipant(p))
+	}
+
+	draw.Status = domain.LotteryStatusCompleted
+	draw.DrawnAt = now
+	draw.UpdatedAt = now
+	m.lotteryDraws[activityID] = draw
+	delete(m.drawSeeds, activityID)
+
+	sortParticipants(winners)
+
+	return winners, nil
+}
+
+// ListNonWinners 分页获取抽奖活动中未中奖且未退出的参与者
+func (m *inMemoryLotteryDrawDAO) ListNonWinners(ctx context.Context, activityID int, pagination domain.Pagination) ([]Participant, error) {
+	return m.pageParticipants(ctx, pagination, func(p Participant) bool {
+		return p.LotteryID != nil && *p.LotteryID == activityID && !p.IsWinner && !p.Withdrawn
+	})
+}
+
+// ListWinners 分页获取抽奖活动的中奖者，按参与时间和ID排序
+func (m *inMemoryLotteryDrawDAO) ListWinners(ctx context.Context, activityID int, pagination domain.Pagination) ([]Participant, error) {
+	return m.pageParticipants(ctx, pagination, func(p Participant) bool {
+		return p.LotteryID != nil && *p.LotteryID == activityID && p.IsWinner
+	})
+}
+
+// pageParticipants 按参与时间和ID排序后分页返回满足条件的参与记录
+func (m *inMemoryLotteryDrawDAO) pageParticipants(ctx context.Context, pagination domain.Pagination, match func(Participant) bool) ([]Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []Participant{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	participants := m.filterParticipants(match)
+	start, end := pageSlice(len(participants), limit, offset)
+
+	return participants[start:end], nil
+}
+
+// ReserveSecondKill 为用户预留一份秒杀库存，预留在 expiresAt 前确认才会生成参与记录
+func (m *inMemoryLotteryDrawDAO) ReserveSecondKill(ctx context.Context, eventID int, userID int64, expiresAt int64) (SecondKillReservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkParticipationAllowed(ctx, Participant{SecondKillID: &eventID, UserID: userID}); err != nil {
+		return SecondKillReservation{}, err
+	}
+
+	event := m.secondKillEvents[eventID]
+	if event.SoldCount >= event.Stock {
+		return SecondKillReservation{}, ErrSoldOut
+	}
+
+	now := time.Now().Unix()
+
+	event.SoldCount++
+	event.UpdatedAt = now
+	m.secondKillEvents[eventID] = event
+
+	reservation := SecondKillReservation{
+		ID:           uuid.New().String(),
+		SecondKillID: eventID,
+		UserID:       userID,
+		Status:       domain.ReservationStatusReserved,
+		ExpiresAt:    expiresAt,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	m.reservations[reservation.ID] = reservation
+
+	return reservation, nil
+}
+
+// ConfirmSecondKillReservation 确认未过期的预留并生成秒杀参与记录
+func (m *inMemoryLotteryDrawDAO) ConfirmSecondKillReservation(ctx context.Context, reservationID string, now int64) (Participant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reservation, ok := m.reservations[reservationID]
+	if !ok || reservation.Status != domain.ReservationStatusReserved || reservation.ExpiresAt < now {
+		return Participant{}, ErrReservationUnavailable
+	}
+
+	reservation.Status = domain.ReservationStatusConfirmed
+	reservation.UpdatedAt = time.Now().Unix()
+	m.reservations[reservationID] = reservation
+
+	eventID := reservation.SecondKillID
+	participant := Participant{
+		ID:             uuid.New().String(),
+		SecondKillID:   &eventID,
+		UserID:         reservation.UserID,
+		ParticipatedAt: now,
+		Metadata:       map[string]string{"reservation_id": reservation.ID},
+	}
+	m.participants[participant.ID] = cloneParticipant(participant)
+
+	return participant, nil
+}
+
+// ExpireStaleReservations 将过期的预留标记为已过期并归还库存，返回回收的库存总数
+func (m *inMemoryLotteryDrawDAO) ExpireStaleReservations(ctx context.Context, now int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total int64
+	updatedAt := time.Now().Unix()
+
+	for id, reservation := range m.reservations {
+		if reservation.Status != domain.ReservationStatusReserved || reservation.ExpiresAt >= now {
+			continue
+		}
+
+		reservation.Status = domain.ReservationStatusExpired
+		reservation.UpdatedAt = updatedAt
+		m.reservations[id] = reservation
+
+		if event, ok := m.secondKillEvents[reservation.SecondKillID]; ok {
+			event.SoldCount--
+			event.UpdatedAt = updatedAt
+			m.secondKillEvents[event.ID] = event
+		}
+
+		total++
+	}
+
+	return total, nil
+}
+
+// GetLotteryDrawForUser 获取抽奖活动（不包含参与者）以及当前用户是否已参与，已退出的参与记录不算作已参与
+func (m *inMemoryLotteryDrawDAO) GetLotteryDrawForUser(ctx context.Context, id int, userID int64) (LotteryDraw, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draw, ok := m.lotteryDraws[id]
+	if !ok {
+		return LotteryDraw{}, false, gorm.ErrRecordNotFound
+	}
+
+	return draw, m.joinedBy(inLottery(id), userID, false), nil
+}
+
+// GetSecondKillFunnel 统计秒杀活动的转化漏斗：浏览 → 预留 → 确认 → 完成购买
+func (m *inMemoryLotteryDrawDAO) GetSecondKillFunnel(ctx context.Context, eventID int, views int64) (FunnelStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := FunnelStats{Views: views}
+
+	for _, r := range m.reservations {
+		if r.SecondKillID != eventID {
+			continue
+		}
+		stats.Reservations++
+		if r.Status == domain.ReservationStatusConfirmed {
+			stats.Confirmations++
+		}
+	}
+
+	for _, p := range m.participants {
+		if p.SecondKillID != nil && *p.SecondKillID == eventID {
+			stats.Purchases++
+		}
+	}
+
+	if stats.Reservations > 0 {
+		stats.ReservationToConfirmation = float64(stats.Confirmations) / float64(stats.Reservations)
+	}
+
+	return stats, nil
+}
+
+// IterateParticipants 分批遍历抽奖活动的参与者，遍历基于调用时的快照，fn 执行期间不持有锁
+func (m *inMemoryLotteryDrawDAO) IterateParticipants(ctx context.Context, activityID int, batchSize int, fn func([]Participant) error) error {
+	if batchSize <= 0 {
+		batchSize = defaultIterateBatchSize
+	}
+
+	m.mu.RLock()
+	participants := m.filterParticipants(inLottery(activityID))
+	m.mu.RUnlock()
+
+	for start := 0; start < len(participants); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := start + batchSize
+		if end > len(participants) {
+			end = len(participants)
+		}
+
+		if err := fn(participants[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParticipationByHourOfDay 按参与时间的小时（UTC）统计抽奖活动的参与次数
+func (m *inMemoryLotteryDrawDAO) ParticipationByHourOfDay(ctx context.Context, activityID int) ([24]int64, error) {
+	var hours [24]int64
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.participants {
+		if p.LotteryID == nil || *p.LotteryID != activityID {
+			continue
+		}
+
+		hour := (p.ParticipatedAt % secondsPerDay) / 3600
+		if hour >= 0 && hour < int64(len(hours)) {
+			hours[hour]++
+		}
+	}
+
+	return hours, nil
+}
+
+// PauseActivity 暂停进行中的活动，暂停期间不接受新的参与，活动类型由 ResolveActivityType 确定
+func (m *inMemoryLotteryDrawDAO) PauseActivity(ctx context.Context, id int) error {
+	return m.transitionActivityStatus(ctx, id, domain.LotteryStatusActive, domain.LotteryStatusPaused)
+}
+
+// ResumeActivity 恢复已暂停的活动，活动类型由 ResolveActivityType 确定
+func (m *inMemoryLotteryDrawDAO) ResumeActivity(ctx context.Context, id int) error {
+	return m.transitionActivityStatus(ctx, id, domain.LotteryStatusPaused, domain.LotteryStatusActive)
+}
+
+// transitionActivityStatus 仅当活动处于 from 状态时将其更新为 to 状态
+func (m *inMemoryLotteryDrawDAO) transitionActivityStatus(ctx context.Context, id int, from, to string) error {
+	activityType, err := m.ResolveActivityType(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	switch activityType {
+	case domain.ActivityTypeLottery:
+		draw, ok := m.lotteryDraws[id]
+		if !ok || draw.Status != from {
+			return ErrInvalidStatusTransition
+		}
+		draw.Status = to
+		draw.UpdatedAt = now
+		m.lotteryDraws[id] = draw
+	case domain.ActivityTypeSecondKill:
+		event, ok := m.secondKillEvents[id]
+		if !ok || event.Status != from {
+			return ErrInvalidStatusTransition
+		}
+		event.Status = to
+		event.UpdatedAt = now
+		m.secondKillEvents[id] = event
+	default:
+		return fmt.Errorf("未知的活动类型 %q", activityType)
+	}
+
+	return nil
+}
+
+// ClaimSecondKill 用户直接抢购秒杀活动，校验参与规则和宽限期后扣减库存并生成参与记录，每个用户在同一活动中只能抢购一次
+func (m *inMemoryLotteryDrawDAO) ClaimSecondKill(ctx context.Context, eventID int, userID int64, now int64) (Participant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, ok := m.secondKillEvents[eventID]
+	if !ok {
+		return Participant{}, gorm.ErrRecordNotFound
+	}
+
+	userLevel, err := resolveUserLevel(ctx, m.userLevel, userID, event.MinUserLevel)
+	if err != nil {
+		return Participant{}, err
+	}
+
+	inGrace, err := checkClaimAllowed(event, userLevel, now)
+	if err != nil {
+		return Participant{}, err
+	}
+
+	if m.joinedBy(inSecondKill(eventID), userID, false) {
+		return Participant{}, ErrAlreadyClaimed
+	}
+
+	if event.SoldCount >= event.Stock {
+		return Participant{}, ErrSoldOut
+	}
+
+	event.SoldCount++
+	event.UpdatedAt = time.Now().Unix()
+	m.secondKillEvents[eventID] = event
+
+	participant := Participant{
+		ID:             uuid.New().String(),
+		SecondKillID:   &eventID,
+		UserID:         userID,
+		ParticipatedAt: now,
+	}
+	if inGrace {
+		participant.Metadata = map[string]string{"grace_claim": "true"}
+	}
+	m.participants[participant.ID] = cloneParticipant(participant)
+
+	return participant, nil
+}
+
+// GetLiveParticipantCount 获取抽奖活动的实时参与人数，内存实现直接统计
+func (m *inMemoryLotteryDrawDAO) GetLiveParticipantCount(ctx context.Context, activityID int) (int64, error) {
+	return m.CountActiveParticipants(ctx, activityID)
+}
+
+// ReconcileLiveParticipantCounts 内存实现没有独立的计数器，无需校准
+func (m *inMemoryLotteryDrawDAO) ReconcileLiveParticipantCounts(ctx context.Context, now int64) error {
+	return nil
+}
+
+// ListJoinableActivitiesForUser 获取用户满足条件但尚未参与的进行中活动，按结束时间升序排列，
+// 抽奖活动的参与规则与 AddParticipant 共用 evaluateParticipation
+func (m *inMemoryLotteryDrawDAO) ListJoinableActivitiesForUser(ctx context.Context, userID int64, userLevel int, now int64, limit int) ([]ActivitySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return []ActivitySummary{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var activities []ActivitySummary
+
+	for _, d := range m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		if m.joinedBy(inLottery(d.ID), userID, false) {
+			return false
+		}
+
+		rules, state, err := m.loadParticipation(Participant{LotteryID: &d.ID, UserID: userID})
+		return err == nil && evaluateParticipation(rules, state, true, userLevel, now) == nil
+	}) {
+		activities = append(activities, lotterySummary(d))
+	}
+
+	for _, e := range m.sortedSecondKillEvents(func(e SecondKillEvent) bool {
+		return e.Status == domain.SecondKillStatusActive && !e.ParticipationLocked && e.StartTime <= now && e.EndTime >= now &&
+			e.MinUserLevel <= userLevel && e.SoldCount < e.Stock && !m.joinedBy(inSecondKill(e.ID), userID, false)
+	}) {
+		activities = append(activities, secondKillSummary(e))
+	}
+
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].EndTime < activities[j].EndTime
+	})
+
+	if len(activities) > limit {
+		activities = activities[:limit]
+	}
+
+	return activities, nil
+}
+
+// GetTotalAwardedValue 统计抽奖活动中已分配给中奖者的奖品总价值
+func (m *inMemoryLotteryDrawDAO) GetTotalAwardedValue(ctx context.Context, activityID int) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total int64
+	for _, p := range m.participants {
+		if p.LotteryID == nil || *p.LotteryID != activityID || !p.IsWinner || p.PrizeID == nil {
+			continue
+		}
+		if prize, ok := m.prizes[*p.PrizeID]; ok {
+			total += int64(prize.Value)
+		}
+	}
+
+	return total, nil
+}
+
+// ListLotteryDrawsModifiedSince 分页获取 since 之后有更新的抽奖活动，按更新时间升序排列
+func (m *inMemoryLotteryDrawDAO) ListLotteryDrawsModifiedSince(ctx context.Context, since int64, pagination domain.Pagination) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDraw{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool { return d.UpdatedAt > since })
+	sort.SliceStable(draws, func(i, j int) bool { return draws[i].UpdatedAt < draws[j].UpdatedAt })
+
+	start, end := pageSlice(len(draws), limit, offset)
+
+	result := make([]LotteryDraw, 0, end-start)
+	for _, draw := range draws[start:end] {
+		result = append(result, m.lotteryDrawWithParticipants(draw))
+	}
+
+	return result, nil
+}
+
+// SwapWinner 将抽奖活动的中奖者手动替换为指定参与者，并转移其奖品
+func (m *inMemoryLotteryDrawDAO) SwapWinner(ctx context.Context, activityID int, oldParticipantID, newParticipantID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldWinner, ok := m.participants[oldParticipantID]
+	if !ok || oldWinner.LotteryID == nil || *oldWinner.LotteryID != activityID || !oldWinner.IsWinner {
+		return ErrParticipantNotWinner
+	}
+
+	replacement, ok := m.participants[newParticipantID]
+	if !ok || replacement.LotteryID == nil || *replacement.LotteryID != activityID || replacement.IsWinner || replacement.Withdrawn {
+		return ErrInvalidReplacementWinner
+	}
+
+	replacement.IsWinner = true
+	replacement.PrizeID = oldWinner.PrizeID
+	oldWinner.IsWinner = false
+	oldWinner.PrizeID = nil
+
+	m.participants[oldParticipantID] = oldWinner
+	m.participants[newParticipantID] = replacement
+
+	m.nextAuditID++
+	m.audits = append(m.audits, DrawAudit{
+		ID:             m.nextAuditID,
+		ActivityID:     activityID,
+		Actor:          actorFrom(ctx),
+		Action:         DrawAuditActionSwapWinner,
+		ParticipantIDs: []string{oldParticipantID, newParticipantID},
+		CreatedAt:      time.Now().Unix(),
+	})
+
+	return nil
+}
+
+// TopParticipantsByEntries 获取抽奖活动中有效参与次数最多的前 topN 个用户，次数相同时用户ID小的优先
+func (m *inMemoryLotteryDrawDAO) TopParticipantsByEntries(ctx context.Context, activityID int, topN int) ([]UserEntryCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if topN <= 0 {
+		return []UserEntryCount{}, nil
+	}
+
+	m.mu.RLock()
+	entries := make(map[int64]int64)
+	for _, p := range m.participants {
+		if p.LotteryID != nil && *p.LotteryID == activityID && !p.Withdrawn {
+			entries[p.UserID]++
+		}
+	}
+	m.mu.RUnlock()
+
+	counts := make([]UserEntryCount, 0, len(entries))
+	for userID, n := range entries {
+		counts = append(counts, UserEntryCount{UserID: userID, Entries: n})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Entries != counts[j].Entries {
+			return counts[i].Entries > counts[j].Entries
+		}
+		return counts[i].UserID < counts[j].UserID
+	})
+
+	if len(counts) > topN {
+		counts = counts[:topN]
+	}
+
+	return counts, nil
+}
+
+// GetLotteryDrawsByNames 根据名称批量获取抽奖活动，名称重复时保留ID最小的活动
+func (m *inMemoryLotteryDrawDAO) GetLotteryDrawsByNames(ctx context.Context, names []string) (map[string]LotteryDraw, error) {
+	result := make(map[string]LotteryDraw, len(names))
+	if len(names) == 0 {
+		return result, nil
+	}
+
+	wanted := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		wanted[name] = struct{}{}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, draw := range m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		_, ok := wanted[d.Name]
+		return ok
+	}) {
+		if _, ok := result[draw.Name]; !ok {
+			result[draw.Name] = m.lotteryDrawWithParticipants(draw)
+		}
+	}
+
+	return result, nil
+}
+
+// GetPrizeWinnerCounts 统计抽奖活动中每个奖品已分配的中奖人数
+func (m *inMemoryLotteryDrawDAO) GetPrizeWinnerCounts(ctx context.Context, activityID int) (map[int]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[int]int64)
+	for _, p := range m.participants {
+		if p.LotteryID != nil && *p.LotteryID == activityID && p.IsWinner && p.PrizeID != nil {
+			counts[*p.PrizeID]++
+		}
+	}
+
+	return counts, nil
+}
+
+// FilterUserJoinedActivities 从给定的抽奖活动ID中筛选出用户已参与（未退出）的活动ID，按ID升序返回
+func (m *inMemoryLotteryDrawDAO) FilterUserJoinedActivities(ctx context.Context, userID int64, activityIDs []int) ([]int, error) {
+	if len(activityIDs) == 0 {
+		return []int{}, nil
+	}
+
+	wanted := make(map[int]struct{}, len(activityIDs))
+	for _, id := range activityIDs {
+		wanted[id] = struct{}{}
+	}
+
+	m.mu.RLock()
+	joined := make(map[int]struct{})
+	for _, p := range m.participants {
+		if p.UserID != userID || p.LotteryID == nil || p.Withdrawn {
+			continue
+		}
+		if _, ok := wanted[*p.LotteryID]; ok {
+			joined[*p.LotteryID] = struct{}{}
+		}
+	}
+	m.mu.RUnlock()
+
+	result := make([]int, 0, len(joined))
+	for id := range joined {
+		result = append(result, id)
+	}
+	sort.Ints(result)
+
+	return result, nil
+}
+
+// ListTrendingActivities 获取 sinceTs 以来参与次数最多的前 limit 个进行中活动
+func (m *inMemoryLotteryDrawDAO) ListTrendingActivities(ctx context.Context, sinceTs int64, limit int, now int64) ([]ActivitySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return []ActivitySummary{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lotteryEntries := make(map[int]int64)
+	secondKillEntries := make(map[int]int64)
+	for _, p := range m.participants {
+		if p.ParticipatedAt < sinceTs || p.Withdrawn {
+			continue
+		}
+		if p.LotteryID != nil {
+			lotteryEntries[*p.LotteryID]++
+		} else if p.SecondKillID != nil {
+			secondKillEntries[*p.SecondKillID]++
+		}
+	}
+
+	type trendingActivity struct {
+		summary ActivitySummary
+		entries int64
+	}
+
+	var trending []trendingActivity
+
+	for _, d := range m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return d.Status == domain.LotteryStatusActive && d.EndTime >= now && lotteryEntries[d.ID] > 0
+	}) {
+		trending = append(trending, trendingActivity{summary: lotterySummary(d), entries: lotteryEntries[d.ID]})
+	}
+
+	for _, e := range m.sortedSecondKillEvents(func(e SecondKillEvent) bool {
+		return e.Status == domain.SecondKillStatusActive && e.EndTime >= now && secondKillEntries[e.ID] > 0
+	}) {
+		trending = append(trending, trendingActivity{summary: secondKillSummary(e), entries: secondKillEntries[e.ID]})
+	}
+
+	sort.SliceStable(trending, func(i, j int) bool {
+		return trending[i].entries > trending[j].entries
+	})
+
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+
+	activities := make([]ActivitySummary, 0, len(trending))
+	for _, t := range trending {
+		activities = append(activities, t.summary)
+	}
+
+	return activities, nil
+}
+
+// GetParticipantRank 获取参与记录在抽奖活动中的参与名次，名次从 1 开始，已退出的参与记录不计入
+func (m *inMemoryLotteryDrawDAO) GetParticipantRank(ctx context.Context, activityID int, participantID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	target, ok := m.participants[participantID]
+	if !ok || target.LotteryID == nil || *target.LotteryID != activityID || target.Withdrawn {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var before int64
+	for _, p := range m.participants {
+		if p.LotteryID == nil || *p.LotteryID != activityID || p.Withdrawn {
+			continue
+		}
+		if p.ParticipatedAt < target.ParticipatedAt || (p.ParticipatedAt == target.ParticipatedAt && p.ID < target.ID) {
+			before++
+		}
+	}
+
+	return before + 1, nil
+}
+
+// CountDistinctParticipatingUsers 统计时间范围内参与过任意活动的去重用户数
+func (m *inMemoryLotteryDrawDAO) CountDistinctParticipatingUsers(ctx context.Context, fromTs, toTs int64) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make(map[int64]struct{})
+	for _, p := range m.participants {
+		if p.ParticipatedAt >= fromTs && p.ParticipatedAt <= toTs {
+			users[p.UserID] = struct{}{}
+		}
+	}
+
+	return int64(len(users)), nil
+}
+
+// SetPrizeRemaining 手动调整奖品剩余数量，剩余数量必须在 [0, Quantity] 范围内
+func (m *inMemoryLotteryDrawDAO) SetPrizeRemaining(ctx context.Context, prizeID int, remaining int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prize, ok := m.prizes[prizeID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	if remaining < 0 || remaining > prize.Quantity {
+		return ErrInvalidPrizeRemaining
+	}
+
+	prize.Remaining = remaining
+	prize.UpdatedAt = time.Now().Unix()
+	m.prizes[prizeID] = prize
+
+	return nil
+}
+
+// ListActivitiesNeedingDraw 获取已结束但尚未完成或取消的抽奖活动，按结束时间升序排列
+func (m *inMemoryLotteryDrawDAO) ListActivitiesNeedingDraw(ctx context.Context, now int64, pagination domain.Pagination) ([]LotteryDrawSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDrawSummary{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return d.EndTime < now && d.Status != domain.LotteryStatusCompleted && d.Status != domain.LotteryStatusCancelled
+	})
+	sort.SliceStable(draws, func(i, j int) bool { return draws[i].EndTime < draws[j].EndTime })
+
+	start, end := pageSlice(len(draws), limit, offset)
+
+	summaries := make([]LotteryDrawSummary, 0, end-start)
+	for _, d := range draws[start:end] {
+		summary := LotteryDrawSummary{ID: d.ID, Name: d.Name, StartTime: d.StartTime, EndTime: d.EndTime, Status: d.Status}
+		for _, p := range m.participants {
+			if !inLottery(d.ID)(p) || p.Withdrawn {
+				continue
+			}
+			summary.ParticipantCount++
+			if p.IsWinner {
+				summary.HasWinners = true
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// AddParticipants 逐条添加参与者，外部参与编号重复的条目记为跳过，其余被拒绝的条目记为失败
+func (m *inMemoryLotteryDrawDAO) AddParticipants(ctx context.Context, models []Participant) (BatchResult, error) {
+	var result BatchResult
+
+	for i, model := range models {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		err := m.AddParticipant(ctx, model)
+		switch {
+		case err == nil:
+			result.Succeeded = append(result.Succeeded, i)
+		case errors.Is(err, ErrDuplicateExternalRef):
+			result.skip(i, err.Error())
+		default:
+			result.fail(i, err)
+		}
+	}
+
+	return result, nil
+}
+
+// fairnessProof 构造已开奖抽奖活动的公平性证明，调用方需持有锁
+func (m *inMemoryLotteryDrawDAO) fairnessProof(activityID int) (FairnessProof, error) {
+	draw, ok := m.lotteryDraws[activityID]
+	if !ok {
+		return FairnessProof{}, gorm.ErrRecordNotFound
+	}
+
+	if draw.DrawnAt == 0 || draw.Seed == "" {
+		return FairnessProof{}, ErrDrawNotVerifiable
+	}
+
+	proof := FairnessProof{
+		ActivityID:     activityID,
+		Seed:           draw.Seed,
+		SeedHash:       draw.SeedHash,
+		Algorithm:      fairnessAlgorithm,
+		ParticipantIDs: []string{},
+		WinnerIDs:      []string{},
+	}
+
+	for _, p := range m.filterParticipants(inLottery(activityID)) {
+		if !p.Withdrawn {
+			proof.ParticipantIDs = append(proof.ParticipantIDs, p.ID)
+		}
+		if p.IsWinner {
+			proof.WinnerIDs = append(proof.WinnerIDs, p.ID)
+		}
+	}
+
+	return proof, nil
+}
+
+// VerifyDrawFairness 使用已公开的开奖种子重新执行抽选，校验中奖者是否与复现结果一致
+func (m *inMemoryLotteryDrawDAO) VerifyDrawFairness(ctx context.Context, activityID int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proof, err := m.fairnessProof(activityID)
+	if err != nil {
+		return false, err
+	}
+
+	return verifyFairnessProof(proof), nil
+}
+
+// ExportFairnessProof 将已开奖抽奖活动的公平性证明以 JSON 格式写入 w
+func (m *inMemoryLotteryDrawDAO) ExportFairnessProof(ctx context.Context, activityID int, w io.Writer) error {
+	m.mu.RLock()
+	proof, err := m.fairnessProof(activityID)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(proof)
+}
+
+// ListUserSecondKillClaims 获取用户成功抢购的秒杀参与记录，按抢购时间倒序排列
+func (m *inMemoryLotteryDrawDAO) ListUserSecondKillClaims(ctx context.Context, userID int64, pagination domain.Pagination) ([]Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []Participant{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var claims []Participant
+	for _, p := range m.participants {
+		if p.SecondKillID == nil || p.UserID != userID || p.Withdrawn {
+			continue
+		}
+
+		if _, ok := m.secondKillEvents[*p.SecondKillID]; !ok {
+			continue
+		}
+
+		claims = append(claims, cloneParticipant(p))
+	}
+
+	sort.Slice(claims, func(i, j int) bool {
+		if claims[i].ParticipatedAt != claims[j].ParticipatedAt {
+			return claims[i].ParticipatedAt > claims[j].ParticipatedAt
+		}
+		return claims[i].ID > claims[j].ID
+	})
+
+	start, end := pageSlice(len(claims), limit, offset)
+
+	return append([]Participant{}, claims[start:end]...), nil
+}
+
+// GetLotteryDrawWithParticipantPage 获取抽奖活动及其一页参与者，并填充参与记录总数，均不包含已退出的参与记录
+func (m *inMemoryLotteryDrawDAO) GetLotteryDrawWithParticipantPage(ctx context.Context, id int, pagination domain.Pagination) (LotteryDraw, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draw, ok := m.lotteryDraws[id]
+	if !ok {
+		return LotteryDraw{}, gorm.ErrRecordNotFound
+	}
+
+	participants := m.filterParticipants(func(p Participant) bool {
+		return inLottery(id)(p) && !p.Withdrawn
+	})
+	draw.ParticipantTotal = int64(len(participants))
+	draw.Participants = []Participant{}
+
+	if limit, offset, ok := pageBounds(pagination); ok {
+		start, end := pageSlice(len(participants), limit, offset)
+		draw.Participants = participants[start:end]
+	}
+
+	return draw, nil
+}
+
+// SetParticipationLock 锁定或解锁活动的参与，不改变活动状态，活动类型由 ResolveActivityType 确定
+func (m *inMemoryLotteryDrawDAO) SetParticipationLock(ctx context.Context, id int, locked bool) error {
+	activityType, err := m.ResolveActivityType(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	switch activityType {
+	case domain.ActivityTypeLottery:
+		draw, ok := m.lotteryDraws[id]
+		if !ok {
+			return ErrActivityNotFound
+		}
+		draw.ParticipationLocked = locked
+		draw.UpdatedAt = now
+		m.lotteryDraws[id] = draw
+	case domain.ActivityTypeSecondKill:
+		event, ok := m.secondKillEvents[id]
+		if !ok {
+			return ErrActivityNotFound
+		}
+		event.ParticipationLocked = locked
+		event.UpdatedAt = now
+		m.secondKillEvents[id] = event
+	default:
+		return fmt.Errorf("未知的活动类型 %q", activityType)
+	}
+
+	return nil
+}
+
+// ListParticipationLockedActivities 获取所有被锁定参与的抽奖和秒杀活动，按活动类型和ID排序
+func (m *inMemoryLotteryDrawDAO) ListParticipationLockedActivities(ctx context.Context) ([]ActivitySummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var activities []ActivitySummary
+
+	for _, d := range m.sortedLotteryDraws(func(d LotteryDraw) bool { return d.ParticipationLocked }) {
+		activities = append(activities, lotterySummary(d))
+	}
+
+	for _, e := range m.sortedSecondKillEvents(func(e SecondKillEvent) bool { return e.ParticipationLocked }) {
+		activities = append(activities, secondKillSummary(e))
+	}
+
+	return activities, nil
+}
+
+// FilterJoinedForFeed 批量查询用户是否参与了各个抽奖活动，未参与的活动ID在结果中为 false
+func (m *inMemoryLotteryDrawDAO) FilterJoinedForFeed(ctx context.Context, userID int64, activityIDs []int) (map[int]bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	joined := make(map[int]bool, len(activityIDs))
+	for _, id := range activityIDs {
+		joined[id] = m.joinedBy(inLottery(id), userID, false)
+	}
+
+	return joined, nil
+}
+
+// ValidateSecondKillEvent 在秒杀活动上线前检查配置异常，仅返回警告列表
+func (m *inMemoryLotteryDrawDAO) ValidateSecondKillEvent(ctx context.Context, eventID int, now int64) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	event, ok := m.secondKillEvents[eventID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return secondKillWarnings(event, now), nil
+}
+
+// GetLotteryDrawsByIDsOrdered 根据ID批量获取抽奖活动，结果按输入ID的顺序排列，不存在的ID会被忽略
+func (m *inMemoryLotteryDrawDAO) GetLotteryDrawsByIDsOrdered(ctx context.Context, ids []int) ([]LotteryDraw, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byID := make(map[int]LotteryDraw, len(ids))
+	for _, id := range ids {
+		if draw, ok := m.lotteryDraws[id]; ok {
+			byID[id] = m.lotteryDrawWithParticipants(draw)
+		}
+	}
+
+	return orderLotteryDrawsByIDs(ids, byID), nil
+}
+
+// CountLateJoiners 统计在抽奖活动结束前 windowSeconds 秒内参与的有效参与记录数
+func (m *inMemoryLotteryDrawDAO) CountLateJoiners(ctx context.Context, activityID int, windowSeconds int) (int64, error) {
+	if windowSeconds <= 0 {
+		return 0, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draw, ok := m.lotteryDraws[activityID]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	if draw.EndTime <= 0 {
+		return 0, ErrInvalidTimeWindow
+	}
+
+	from := draw.EndTime - int64(windowSeconds)
+
+	var count int64
+	for _, p := range m.participants {
+		if inLottery(activityID)(p) && !p.Withdrawn && p.ParticipatedAt >= from && p.ParticipatedAt <= draw.EndTime {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// IterateLotteryDraws 按ID顺序逐条遍历指定状态的抽奖活动，遍历基于调用时的快照，fn 执行期间不持有锁
+func (m *inMemoryLotteryDrawDAO) IterateLotteryDraws(ctx context.Context, status string, batchSize int, fn func(LotteryDraw) error) error {
+	status, err := normalizeStatus(status, lotteryStatuses)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool { return status == "" || d.Status == status })
+	m.mu.RUnlock()
+
+	for _, draw := range draws {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(draw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MergeActivities 将源抽奖活动的参与记录合并到目标活动，并将源活动置为已取消，返回迁移的参与记录数
+// 跳过目标活动中已参与的用户，目标活动设置了参与人数上限时未退出的参与记录迁移至上限为止
+func (m *inMemoryLotteryDrawDAO) MergeActivities(ctx context.Context, sourceID, targetID int) (int64, error) {
+	if sourceID == targetID {
+		return 0, ErrMergeSameActivity
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	source, ok := m.lotteryDraws[sourceID]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+	target, ok := m.lotteryDraws[targetID]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	for _, draw := range []LotteryDraw{source, target} {
+		if draw.Status == domain.LotteryStatusCompleted || draw.Status == domain.LotteryStatusCancelled {
+			return 0, ErrInvalidStatusTransition
+		}
+	}
+
+	var active int
+	users := make(map[int64]struct{})
+	refs := make(map[string]struct{})
+	for _, p := range m.filterParticipants(inLottery(targetID)) {
+		users[p.UserID] = struct{}{}
+		if p.ExternalRef != nil {
+			refs[*p.ExternalRef] = struct{}{}
+		}
+		if !p.Withdrawn {
+			active++
+		}
+	}
+
+	var ids []string
+	for _, p := range m.filterParticipants(inLottery(sourceID)) {
+		if _, ok := users[p.UserID]; ok {
+			continue
+		}
+		if p.ExternalRef != nil {
+			if _, ok := refs[*p.ExternalRef]; ok {
+				continue
+			}
+		}
+		if !p.Withdrawn {
+			if target.MaxParticipants > 0 && active >= target.MaxParticipants {
+				continue
+			}
+			active++
+		}
+
+		users[p.UserID] = struct{}{}
+		if p.ExternalRef != nil {
+			refs[*p.ExternalRef] = struct{}{}
+		}
+		p.LotteryID = &target.ID
+		m.participants[p.ID] = p
+		ids = append(ids, p.ID)
+	}
+
+	now := time.Now().Unix()
+
+	source.Status = domain.LotteryStatusCancelled
+	source.CancelReason = CancelReasonMerged
+	source.UpdatedAt = now
+	m.lotteryDraws[sourceID] = source
+
+	m.nextAuditID++
+	m.audits = append(m.audits, DrawAudit{
+		ID:             m.nextAuditID,
+		ActivityID:     targetID,
+		Actor:          actorFrom(ctx),
+		Action:         DrawAuditActionMerge,
+		ParticipantIDs: ids,
+		CreatedAt:      now,
+	})
+
+	return int64(len(ids)), nil
+}
+
+// GetParticipationPercentiles 获取抽奖活动参与进度的百分位，percentiles 取值范围为 (0, 1]
+func (m *inMemoryLotteryDrawDAO) GetParticipationPercentiles(ctx context.Context, activityID int, percentiles []float64) (map[float64]int64, error) {
+	for _, p := range percentiles {
+		if !(p > 0 && p <= 1) {
+			return nil, ErrInvalidPercentile
+		}
+	}
+
+	m.mu.RLock()
+	participants := m.filterParticipants(func(p Participant) bool {
+		return inLottery(activityID)(p) && !p.Withdrawn
+	})
+	m.mu.RUnlock()
+
+	result := make(map[float64]int64, len(percentiles))
+	if len(participants) == 0 {
+		return result, nil
+	}
+
+	for _, p := range percentiles {
+		result[p] = participants[percentileOffset(p, int64(len(participants)))].ParticipatedAt
+	}
+
+	return result, nil
+}
+
+// RefundSecondKillClaim 退款秒杀抢购记录并释放库存，refund 回调返回错误时不修改任何数据
+// refund 回调在释放锁后执行，回调中可以再次调用 DAO；执行期间同一记录的其他退款请求返回 ErrClaimNotRefundable
+func (m *inMemoryLotteryDrawDAO) RefundSecondKillClaim(ctx context.Context, participantID string, refund func(userID int64) error) error {
+	m.mu.Lock()
+
+	participant, ok := m.participants[participantID]
+	if !ok {
+		m.mu.Unlock()
+		return gorm.ErrRecordNotFound
+	}
+
+	if _, inFlight := m.refunding[participantID]; inFlight || participant.SecondKillID == nil || participant.Withdrawn {
+		m.mu.Unlock()
+		return ErrClaimNotRefundable
+	}
+
+	m.refunding[participantID] = struct{}{}
+	m.mu.Unlock()
+
+	err := refund(participant.UserID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.refunding, participantID)
+
+	if err != nil {
+		return err
+	}
+
+	// 回调执行期间记录可能已被其他操作修改，应用前重新校验
+	participant, ok = m.participants[participantID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	if participant.SecondKillID == nil || participant.Withdrawn {
+		return ErrClaimNotRefundable
+	}
+
+	participant = cloneParticipant(participant)
+	participant.Withdrawn = true
+	if participant.Metadata == nil {
+		participant.Metadata = make(map[string]string, 1)
+	}
+	participant.Metadata["refunded"] = "true"
+	m.participants[participantID] = participant
+
+	if event, ok := m.secondKillEvents[*participant.SecondKillID]; ok && event.SoldCount > 0 {
+		event.SoldCount--
+		event.UpdatedAt = time.Now().Unix()
+		m.secondKillEvents[event.ID] = event
+	}
+
+	return nil
+}
+
+// ListCancelledForLowParticipation 获取因参与人数不足而被自动取消的抽奖活动，按更新时间倒序排列
+// 内存实现开奖时不会自动取消活动，仅返回通过其他途径写入该取消原因的活动
+func (m *inMemoryLotteryDrawDAO) ListCancelledForLowParticipation(ctx context.Context, pagination domain.Pagination) ([]LotteryDraw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []LotteryDraw{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draws := m.sortedLotteryDraws(func(d LotteryDraw) bool {
+		return d.Status == domain.LotteryStatusCancelled && d.CancelReason == CancelReasonBelowMinParticipants
+	})
+	sort.SliceStable(draws, func(i, j int) bool {
+		if draws[i].UpdatedAt != draws[j].UpdatedAt {
+			return draws[i].UpdatedAt > draws[j].UpdatedAt
+		}
+		return draws[i].ID > draws[j].ID
+	})
+
+	start, end := pageSlice(len(draws), limit, offset)
+
+	result := make([]LotteryDraw, 0, end-start)
+	for _, draw := range draws[start:end] {
+		result = append(result, m.lotteryDrawWithParticipants(draw))
+	}
+
+	return result, nil
+}
+
+// GetAverageEntriesPerUser 计算抽奖活动中每个参与用户的平均有效参与次数，没有有效参与记录时返回 0
+func (m *inMemoryLotteryDrawDAO) GetAverageEntriesPerUser(ctx context.Context, activityID int) (float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries int64
+	users := make(map[int64]struct{})
+
+	for _, p := range m.participants {
+		if inLottery(activityID)(p) && !p.Withdrawn {
+			entries++
+			users[p.UserID] = struct{}{}
+		}
+	}
+
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	return float64(entries) / float64(len(users)), nil
+}
+
+// ClaimSecondKillCached 内存实现没有 Redis 抢购路径，直接按 ClaimSecondKill 抢购
+func (m *inMemoryLotteryDrawDAO) ClaimSecondKillCached(ctx context.Context, eventID int, userID int64, now int64) error {
+	_, err := m.ClaimSecondKill(ctx, eventID, userID, now)
+	return err
+}
+
+// FlushSecondKillCacheToDB 内存实现不使用 Redis 抢购路径，没有需要持久化的缓存，始终返回 0
+func (m *inMemoryLotteryDrawDAO) FlushSecondKillCacheToDB(ctx context.Context, eventID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.secondKillEvents[eventID]; !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	return 0, nil
+}
+
+// lotteryParticipationRules 提取抽奖活动的参与规则
+func lotteryParticipationRules(draw LotteryDraw) participationRules {
+	return participationRules{
+		Status:               draw.Status,
+		Locked:               draw.ParticipationLocked,
+		StartTime:            draw.StartTime,
+		EndTime:              draw.EndTime,
+		EntryStartTime:       draw.EntryStartTime,
+		EntryEndTime:         draw.EntryEndTime,
+		MinUserLevel:         draw.MinUserLevel,
+		MaxParticipants:      draw.MaxParticipants,
+		MaxEntriesPerUser:    draw.MaxEntriesPerUser,
+		EntryCooldownSeconds: draw.EntryCooldownSeconds,
+	}
+}
+
+// CanUserEnter 只读地判断用户在 now 时刻能否参与抽奖活动，返回是否允许及原因码，判定结果与以相同参数调用 AddParticipant 完全一致
+func (m *inMemoryLotteryDrawDAO) CanUserEnter(ctx context.Context, activityID int, userID int64, userLevel int, now int64) (bool, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules, state, err := m.loadParticipation(Participant{LotteryID: &activityID, UserID: userID})
+	if err != nil {
+		return false, "", err
+	}
+
+	return entryDecision(evaluateParticipation(rules, state, true, userLevel, now))
+}
+
+// ListWinnersForActivities 分页获取多个抽奖活动的中奖者，按活动ID和参与记录ID升序排列
+func (m *inMemoryLotteryDrawDAO) ListWinnersForActivities(ctx context.Context, activityIDs []int, pagination domain.Pagination) ([]WinnerRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset, ok := pageBounds(pagination)
+	if !ok {
+		return []WinnerRecord{}, nil
+	}
+
+	wanted := make(map[int]struct{}, len(activityIDs))
+	for _, id := range activityIDs {
+		wanted[id] = struct{}{}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	winners := m.filterParticipants(func(p Participant) bool {
+		if !p.IsWinner || p.LotteryID == nil {
+			return false
+		}
+		if _, ok := wanted[*p.LotteryID]; !ok {
+			return false
+		}
+		_, ok := m.lotteryDraws[*p.LotteryID]
+		return ok
+	})
+
+	sort.Slice(winners, func(i, j int) bool {
+		if *winners[i].LotteryID != *winners[j].LotteryID {
+			return *winners[i].LotteryID < *winners[j].LotteryID
+		}
+		return winners[i].ID < winners[j].ID
+	})
+
+	start, end := pageSlice(len(winners), limit, offset)
+
+	records := make([]WinnerRecord, 0, end-start)
+	for _, p := range winners[start:end] {
+		record := WinnerRecord{
+			ParticipantID:  p.ID,
+			ActivityID:     *p.LotteryID,
+			ActivityName:   m.lotteryDraws[*p.LotteryID].Name,
+			UserID:         p.UserID,
+			PrizeID:        p.PrizeID,
+			ParticipatedAt: p.ParticipatedAt,
+		}
+		if p.PrizeID != nil {
+			prize := m.prizes[*p.PrizeID]
+			record.PrizeName, record.PrizeValue = prize.Name, prize.Value
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// GetUserLastParticipation 获取用户在所有活动中最近一次参与的时间，从未参与时返回 0
+func (m *inMemoryLotteryDrawDAO) GetUserLastParticipation(ctx context.Context, userID int64) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var last int64
+	for _, p := range m.participants {
+		if p.UserID == userID && p.ParticipatedAt > last {
+			last = p.ParticipatedAt
+		}
+	}
+
+	return last, nil
+}
+
+// FindOrphanParticipants 查找所属活动不存在的参与记录，最多返回 orphanParticipantLimit 条
+func (m *inMemoryLotteryDrawDAO) FindOrphanParticipants(ctx context.Context) ([]Participant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orphans := m.filterParticipants(func(p Participant) bool {
+		switch {
+		case p.LotteryID != nil:
+			_, ok := m.lotteryDraws[*p.LotteryID]
+			return !ok
+		case p.SecondKillID != nil:
+			_, ok := m.secondKillEvents[*p.SecondKillID]
+			return !ok
+		default:
+			return true
+		}
+	})
+
+	if len(orphans) > orphanParticipantLimit {
+		orphans = orphans[:orphanParticipantLimit]
+	}
+
+	return orphans, nil
+}
+
+// GetSecondKillBurnRate 统计秒杀活动截至 now 的最近 windowSeconds 秒内的抢购数，返回每秒售出数量和预估的售罄时间
+func (m *inMemoryLotteryDrawDAO) GetSecondKillBurnRate(ctx context.Context, eventID int, windowSeconds int, now int64) (float64, int64, error) {
+	if windowSeconds <= 0 {
+		return 0, 0, ErrInvalidTimeWindow
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	event, ok := m.secondKillEvents[eventID]
+	if !ok {
+		return 0, 0, gorm.ErrRecordNotFound
+	}
+
+	remaining := event.Stock - event.SoldCount
+	if remaining <= 0 {
+		return 0, 0, ErrSoldOut
+	}
+
+	var claims int64
+	for _, p := range m.participants {
+		if inSecondKill(eventID)(p) && !p.Withdrawn && p.ParticipatedAt > now-int64(windowSeconds) && p.ParticipatedAt <= now {
+			claims++
+		}
+	}
+
+	rate, selloutTs := projectSellout(remaining, claims, windowSeconds, now)
+
+	return rate, selloutTs, nil
+}
+
+// AnonymizeUserParticipations 将用户的参与记录和秒杀预留记录的用户ID替换为 AnonymizedUserID，并清空参与元数据，返回匿名化的参与记录数
+func (m *inMemoryLotteryDrawDAO) AnonymizeUserParticipations(ctx context.Context, userID int64) (int64, error) {
+	if userID == AnonymizedUserID {
+		return 0, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var anonymized int64
+	for id, p := range m.participants {
+		if p.UserID != userID {
+			continue
+		}
+		p.UserID = AnonymizedUserID
+		p.Metadata = nil
+		m.participants[id] = p
+		anonymized++
+	}
+
+	for id, r := range m.reservations {
+		if r.UserID == userID {
+			r.UserID = AnonymizedUserID
+			m.reservations[id] = r
+		}
+	}
+
+	return anonymized, nil
+}
+
+// GetTimeToFill 获取抽奖活动从开始到参与人数达到上限所用的秒数，未达到上限时 filled 为 false
+func (m *inMemoryLotteryDrawDAO) GetTimeToFill(ctx context.Context, activityID int) (int64, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draw, ok := m.lotteryDraws[activityID]
+	if !ok {
+		return 0, false, gorm.ErrRecordNotFound
+	}
+
+	if draw.MaxParticipants <= 0 {
+		return 0, false, ErrNoParticipantCap
+	}
+
+	active := m.filterParticipants(func(p Participant) bool {
+		return inLottery(activityID)(p) && !p.Withdrawn
+	})
+
+	if len(active) < draw.MaxParticipants {
+		return draw.EndTime - draw.StartTime, false, nil
+	}
+
+	return timeToFill(draw.StartTime, active[draw.MaxParticipants-1].ParticipatedAt), true, nil
+}
+
+// RefreshStatusesForIDs 按 domain.ScheduledLotteryStatus 的调度规则刷新指定抽奖活动的状态，返回状态发生变化的活动数
+func (m *inMemoryLotteryDrawDAO) RefreshStatusesForIDs(ctx context.Context, ids []int, now int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, ErrEmptyIDs
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var changed int64
+	seen := make(map[int]struct{}, len(ids))
+
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		draw, ok := m.lotteryDraws[id]
+		if !ok {
+			continue
+		}
+
+		status := domain.ScheduledLotteryStatus(draw.Status, draw.StartTime, draw.EndTime, now)
+		if status == draw.Status {
+			continue
+		}
+
+		draw.Status = status
+		draw.UpdatedAt = time.Now().Unix()
+		m.lotteryDraws[id] = draw
+		changed++
+	}
+
+	return changed, nil
+}
+
+// FindOversoldEvents 查找已售数量超过库存的秒杀活动，按超卖数量降序排列并填充 OversoldBy
+func (m *inMemoryLotteryDrawDAO) FindOversoldEvents(ctx context.Context) ([]SecondKillEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []SecondKillEvent{}
+	for _, e := range m.secondKillEvents {
+		if e.SoldCount > e.Stock {
+			e.Participants = nil
+			e.OversoldBy = e.SoldCount - e.Stock
+			events = append(events, e)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].OversoldBy != events[j].OversoldBy {
+			return events[i].OversoldBy > events[j].OversoldBy
+		}
+		return events[i].ID < events[j].ID
+	})
+
+	return events, nil
+}
+
+// GetUserWinRate 获取用户在所有活动中的中奖次数和参与次数，已退出的参与记录不计入
+func (m *inMemoryLotteryDrawDAO) GetUserWinRate(ctx context.Context, userID int64) (int64, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var wins, entries int64
+	for _, p := range m.participants {
+		if p.UserID != userID || p.Withdrawn {
+			continue
+		}
+		entries++
+		if p.IsWinner {
+			wins++
+		}
+	}
+
+	return wins, entries, nil
+}
+
+// RemoveUsersFromActivities 删除指定用户在指定活动中的参与记录，任一活动不存在或类型不明确时不做任何删除，返回删除的记录数
+// 被删除的未退款秒杀抢购会归还库存，被删除的抽奖中奖记录归还奖品剩余数量，并为每个受影响的抽奖活动写入审计记录
+func (m *inMemoryLotteryDrawDAO) RemoveUsersFromActivities(ctx context.Context, activityIDs []int, userIDs []int64) (int64, error) {
+	if len(activityIDs) == 0 || len(userIDs) == 0 {
+		return 0, ErrEmptyIDs
+	}
+
+	users := make(map[int64]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		users[id] = struct{}{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lotteries := make(map[int]struct{})
+	secondKills := make(map[int]struct{})
+	for _, id := range activityIDs {
+		_, isLottery := m.lotteryDraws[id]
+		_, isSecondKill := m.secondKillEvents[id]
+
+		switch {
+		case isLottery && isSecondKill:
+			return 0, fmt.Errorf("活动 %d: %w", id, ErrAmbiguousActivityType)
+		case isLottery:
+			lotteries[id] = struct{}{}
+		case isSecondKill:
+			secondKills[id] = struct{}{}
+		default:
+			return 0, fmt.Errorf("活动 %d: %w", id, ErrActivityNotFound)
+		}
+	}
+
+	now := time.Now().Unix()
+	auditIDs := make(map[int][]string)
+
+	var removed int64
+	for id, p := range m.participants {
+		if _, ok := users[p.UserID]; !ok {
+			continue
+		}
+
+		switch {
+		case p.SecondKillID != nil:
+			if _, ok := secondKills[*p.SecondKillID]; !ok {
+				continue
+			}
+			if event, ok := m.secondKillEvents[*p.SecondKillID]; ok && !p.Withdrawn && event.SoldCount > 0 {
+				event.SoldCount--
+				m.secondKillEvents[*p.SecondKillID] = event
+			}
+		case p.LotteryID != nil:
+			if _, ok := lotteries[*p.LotteryID]; !ok {
+				continue
+			}
+			if p.IsWinner && p.PrizeID != nil {
+				if prize, ok := m.prizes[*p.PrizeID]; ok && prize.Remaining < prize.Quantity {
+					prize.Remaining++
+					prize.UpdatedAt = now
+					m.prizes[prize.ID] = prize
+				}
+			}
+			auditIDs[*p.LotteryID] = append(auditIDs[*p.LotteryID], id)
+		default:
+			continue
+		}
+
+		delete(m.participants, id)
+		removed++
+	}
+
+	for lotteryID, participantIDs := range auditIDs {
+		sort.Strings(participantIDs)
+		m.nextAuditID++
+		m.audits = append(m.audits, DrawAudit{
+			ID:             m.nextAuditID,
+			ActivityID:     lotteryID,
+			Actor:          actorFrom(ctx),
+			Action:         DrawAuditActionRemoveUsers,
+			ParticipantIDs: participantIDs,
+			CreatedAt:      now,
+		})
+	}
+
+	return removed, nil
+}
+
+// SnapshotActivity 在持有读锁期间读取活动的状态和各项统计，返回数值一致的快照，活动类型由 ResolveActivityType 确定
+func (m *inMemoryLotteryDrawDAO) SnapshotActivity(ctx context.Context, activityID int) (ActivitySnapshot, error) {
+	activityType, err := m.ResolveActivityType(ctx, activityID)
+	if err != nil {
+		return ActivitySnapshot{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := ActivitySnapshot{ActivityID: activityID, ActivityType: activityType, SnapshotAt: time.Now().Unix()}
+
+	match := inLottery(activityID)
+	if activityType == domain.ActivityTypeSecondKill {
+		event, ok := m.secondKillEvents[activityID]
+		if !ok {
+			return ActivitySnapshot{}, ErrActivityNotFound
+		}
+		snapshot.Name, snapshot.Status = event.Name, event.Status
+		snapshot.Stock, snapshot.SoldCount = event.Stock, event.SoldCount
+		match = inSecondKill(activityID)
+	} else {
+		draw, ok := m.lotteryDraws[activityID]
+		if !ok {
+			return ActivitySnapshot{}, ErrActivityNotFound
+		}
+		snapshot.Name, snapshot.Status = draw.Name, draw.Status
+
+		for _, prize := range m.prizes {
+			if prize.LotteryID == activityID {
+				snapshot.PrizeQuantity += prize.Quantity
+				snapshot.PrizeRemaining += prize.Remaining
+			}
+		}
+	}
+
+	users := make(map[int64]struct{})
+	for _, p := range m.participants {
+		if !match(p) {
+			continue
+		}
+		if p.Withdrawn {
+			snapshot.WithdrawnCount++
+		} else {
+			snapshot.ParticipantCount++
+			users[p.UserID] = struct{}{}
+		}
+		if p.IsWinner {
+			snapshot.WinnerCount++
+		}
+	}
+	snapshot.UniqueUsers = int64(len(users))
+
+	return snapshot, nil
+}
@@ -0,0 +1,101 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoSimplicity/LinkMe/internal/domain"
+)
+
+func TestInMemoryClaimSecondKillNeverOversells(t *testing.T) {
+	d := NewInMemoryLotteryDrawDAO()
+	ctx := context.Background()
+
+	const stock, claimers = 5, 50
+
+	now := time.Now().Unix()
+	if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: stock}); err != nil {
+		t.Fatalf("CreateSecondKillEvent: %v", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+	)
+
+	for i := 0; i < claimers; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+
+			_, err := d.ClaimSecondKill(ctx, 1, userID, now)
+			if err != nil && !errors.Is(err, ErrSoldOut) {
+				t.Errorf("ClaimSecondKill: %v", err)
+				return
+			}
+
+			if err == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}(int64(i + 1))
+	}
+	wg.Wait()
+
+	event, err := d.GetSecondKillEventByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetSecondKillEventByID: %v", err)
+	}
+
+	if claimed != stock || event.SoldCount != stock || len(event.Participants) != stock {
+		t.Errorf("claimed = %d, sold_count = %d, participants = %d, want %d", claimed, event.SoldCount, len(event.Participants), stock)
+	}
+}
+
+func TestInMemoryDrawWinnersAssignsPrizes(t *testing.T) {
+	d := NewInMemoryLotteryDrawDAO()
+	ctx := context.Background()
+
+	draw := LotteryDraw{
+		Name:      "draw",
+		StartTime: 1,
+		EndTime:   2,
+		Status:    domain.LotteryStatusActive,
+		Prizes:    []Prize{{Name: "prize", Quantity: 2, Remaining: 2, Value: 10}},
+	}
+	if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+		t.Fatalf("CreateLotteryDraw: %v", err)
+	}
+
+	lotteryID := 1
+	for _, id := range []string{"a", "b", "c"} {
+		if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &lotteryID, UserID: 1, ParticipatedAt: 1}); err != nil {
+			t.Fatalf("AddParticipant: %v", err)
+		}
+	}
+
+	winners, err := d.DrawWinners(ctx, lotteryID, 2)
+	if err != nil {
+		t.Fatalf("DrawWinners: %v", err)
+	}
+	if len(winners) != 2 {
+		t.Fatalf("got %d winners, want 2", len(winners))
+	}
+
+	if _, err := d.DrawWinners(ctx, lotteryID, 2); !errors.Is(err, ErrAlreadyDrawn) {
+		t.Errorf("second DrawWinners err = %v, want ErrAlreadyDrawn", err)
+	}
+
+	total, err := d.GetTotalAwardedValue(ctx, lotteryID)
+	if err != nil {
+		t.Fatalf("GetTotalAwardedValue: %v", err)
+	}
+	if total != 20 {
+		t.Errorf("total awarded value = %d, want 20", total)
+	}
+}
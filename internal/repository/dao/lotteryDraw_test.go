@@ -0,0 +1,4366 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoSimplicity/LinkMe/internal/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestLotteryDrawDAO 基于内存 SQLite 创建测试用的 DAO，opts 通过 NewLotteryDrawDAO 应用
+func newTestLotteryDrawDAO(t *testing.T, opts ...LotteryDrawDAOOption) (*lotteryDrawDAO, *gorm.DB) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+
+	// 内存数据库每个连接独立，限制为单连接保证数据可见
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if err := db.AutoMigrate(&LotteryDraw{}, &SecondKillEvent{}, &Participant{}, &Prize{}, &DrawAudit{}, &SecondKillReservation{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return NewLotteryDrawDAO(db, zap.NewNop(), opts...).(*lotteryDrawDAO), db
+}
+
+func TestListMethodsReturnCanceledWithoutQuery(t *testing.T) {
+	d, db := newTestLotteryDrawDAO(t)
+
+	var queries int
+	if err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries++
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	size, offset := int64(10), int64(0)
+	pagination := domain.Pagination{Page: 1, Size: &size, Offset: &offset}
+
+	start := time.Now()
+
+	if _, err := d.ListLotteryDraws(ctx, "", pagination); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListLotteryDraws err = %v, want context.Canceled", err)
+	}
+	if _, err := d.ListSecondKillEvents(ctx, "", pagination); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListSecondKillEvents err = %v, want context.Canceled", err)
+	}
+	if _, err := d.ListActiveLotteryDraws(ctx, time.Now().Unix()); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListActiveLotteryDraws err = %v, want context.Canceled", err)
+	}
+	if _, err := d.ListDrawAudits(ctx, 1, pagination); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListDrawAudits err = %v, want context.Canceled", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("canceled list calls took %v, want fast return", elapsed)
+	}
+
+	if queries != 0 {
+		t.Errorf("executed %d queries, want 0", queries)
+	}
+}
+
+// explainQueryPlans 执行 fn 并返回其中每条主表查询在 SQLite 下的执行计划
+func explainQueryPlans(t *testing.T, db *gorm.DB, table string, fn func()) []string {
+	t.Helper()
+
+	type captured struct {
+		sql  string
+		vars []interface{}
+	}
+
+	var statements []captured
+	capture := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			statements = append(statements, captured{sql: tx.Statement.SQL.String(), vars: tx.Statement.Vars})
+		}
+	}
+
+	// Find 走 Query 回调，Scan/Row 走 Row 回调，两者都需要捕获
+	name := "test:capture_" + table
+	if err := db.Callback().Query().After("gorm:query").Register(name, capture); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	defer func() { _ = db.Callback().Query().Remove(name) }()
+
+	if err := db.Callback().Row().After("gorm:row").Register(name, capture); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	defer func() { _ = db.Callback().Row().Remove(name) }()
+
+	fn()
+
+	plans := make([]string, 0, len(statements))
+	for _, stmt := range statements {
+		rows, err := db.Raw("EXPLAIN QUERY PLAN "+stmt.sql, stmt.vars...).Rows()
+		if err != nil {
+			t.Fatalf("explain %q: %v", stmt.sql, err)
+		}
+
+		var plan string
+		for rows.Next() {
+			var id, parent, notUsed int
+			var detail string
+			if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+				t.Fatalf("scan plan: %v", err)
+			}
+			plan += detail + "\n"
+		}
+		_ = rows.Close()
+
+		plans = append(plans, plan)
+	}
+
+	return plans
+}
+
+func TestCategoryStatusFilterUsesIndex(t *testing.T) {
+	d, db := newTestLotteryDrawDAO(t)
+	ctx := context.Background()
+
+	for _, index := range []struct {
+		model interface{}
+		name  string
+	}{
+		{&LotteryDraw{}, "idx_category_status"},
+		{&SecondKillEvent{}, "idx_second_kill_category_status"},
+	} {
+		if !db.Migrator().HasIndex(index.model, index.name) {
+			t.Errorf("index %s not created", index.name)
+		}
+	}
+
+	categories := []string{"", "digital", "coupon", "physical"}
+	statuses := []string{domain.LotteryStatusPending, domain.LotteryStatusActive, domain.LotteryStatusCompleted}
+	draws := make([]LotteryDraw, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		start := int64(1_700_000_000 + i*60)
+		draws = append(draws, LotteryDraw{Name: "draw", StartTime: start, EndTime: start + 3600, Status: statuses[i%3], Category: categories[i%4]})
+	}
+	if err := db.CreateInBatches(&draws, 500).Error; err != nil {
+		t.Fatalf("seed draws: %v", err)
+	}
+	if err := db.Exec("ANALYZE").Error; err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+
+	plans := explainQueryPlans(t, db, "lottery_draws", func() {
+		var ids []int
+		_ = db.WithContext(ctx).Model(&LotteryDraw{}).Where("category = ? AND status = ?", "digital", domain.LotteryStatusActive).Pluck("id", &ids)
+	})
+	if len(plans) == 0 || !strings.Contains(plans[0], "idx_category_status") {
+		t.Errorf("category and status filter plan does not use idx_category_status: %v", plans)
+	}
+
+	got, err := d.GetLotteryDrawByID(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetLotteryDrawByID: %v", err)
+	}
+	if got.Category != "digital" {
+		t.Errorf("category = %q, want digital", got.Category)
+	}
+}
+
+func TestActivityListQueriesUseStatusIndex(t *testing.T) {
+	d, db := newTestLotteryDrawDAO(t)
+	ctx := context.Background()
+
+	statuses := []string{domain.LotteryStatusPending, domain.LotteryStatusActive, domain.LotteryStatusCompleted}
+	draws := make([]LotteryDraw, 0, 3000)
+	events := make([]SecondKillEvent, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		start := int64(1_700_000_000 + i*60)
+		draws = append(draws, LotteryDraw{Name: "draw", StartTime: start, EndTime: start + 3600, Status: statuses[i%3]})
+		events = append(events, SecondKillEvent{Name: "event", StartTime: start, EndTime: start + 3600, Status: statuses[i%3]})
+	}
+	if err := db.CreateInBatches(&draws, 500).Error; err != nil {
+		t.Fatalf("seed draws: %v", err)
+	}
+	if err := db.CreateInBatches(&events, 500).Error; err != nil {
+		t.Fatalf("seed events: %v", err)
+	}
+	if err := db.Exec("ANALYZE").Error; err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+
+	size, offset := int64(10), int64(0)
+	pagination := domain.Pagination{Page: 1, Size: &size, Offset: &offset}
+	now := int64(1_700_100_000)
+
+	cases := []struct {
+		name  string
+		table string
+		index string
+		call  func()
+	}{
+		{"ListLotteryDraws", "lottery_draws", "idx_lottery_status_start", func() { _, _ = d.ListLotteryDraws(ctx, domain.LotteryStatusActive, pagination) }},
+		{"ListPendingLotteryDraws", "lottery_draws", "idx_lottery_status_start", func() { _, _ = d.ListPendingLotteryDraws(ctx, now) }},
+		{"ListActiveLotteryDraws", "lottery_draws", "idx_lottery_status_start", func() { _, _ = d.ListActiveLotteryDraws(ctx, now) }},
+		{"ListSecondKillEvents", "second_kill_events", "idx_second_kill_status_start", func() { _, _ = d.ListSecondKillEvents(ctx, domain.SecondKillStatusActive, pagination) }},
+		{"ListPendingSecondKillEvents", "second_kill_events", "idx_second_kill_status_start", func() { _, _ = d.ListPendingSecondKillEvents(ctx, now) }},
+		{"ListActiveSecondKillEvents", "second_kill_events", "idx_second_kill_status_start", func() { _, _ = d.ListActiveSecondKillEvents(ctx, now) }},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			plans := explainQueryPlans(t, db, tt.table, tt.call)
+			if len(plans) == 0 {
+				t.Fatalf("no query on %s captured", tt.table)
+			}
+			if !strings.Contains(plans[0], tt.index) {
+				t.Errorf("query plan does not use %s:\n%s", tt.index, plans[0])
+			}
+		})
+	}
+}
+
+func TestWinnerOrderingIsStableForIdenticalTimestamps(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, id := range []string{"c", "a", "e", "b", "d"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: 1}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			if _, err := d.DrawWinners(ctx, activityID, 5); err != nil {
+				t.Fatalf("DrawWinners: %v", err)
+			}
+
+			want := []string{"a", "b", "c", "d", "e"}
+			size, offset := int64(10), int64(0)
+			pagination := domain.Pagination{Page: 1, Size: &size, Offset: &offset}
+
+			for i := 0; i < 3; i++ {
+				winners, err := d.ListWinners(ctx, activityID, pagination)
+				if err != nil {
+					t.Fatalf("ListWinners: %v", err)
+				}
+				if got := participantIDs(winners); !equalStrings(got, want) {
+					t.Fatalf("ListWinners order = %v, want %v", got, want)
+				}
+
+				got, err := d.GetLotteryDrawByID(ctx, activityID)
+				if err != nil {
+					t.Fatalf("GetLotteryDrawByID: %v", err)
+				}
+				if ids := participantIDs(got.Participants); !equalStrings(ids, want) {
+					t.Fatalf("preloaded participants order = %v, want %v", ids, want)
+				}
+			}
+		})
+	}
+}
+
+func participantIDs(participants []Participant) []string {
+	ids := make([]string, 0, len(participants))
+	for _, p := range participants {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListLotteryDrawsClampsOffset(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		offset int64
+		want   int
+	}{
+		{"negative", -5, 5},
+		{"zero", 0, 5},
+		{"middle", 3, 2},
+		{"past end", 10, 0},
+		{"enormous", math.MaxInt64, 0},
+	}
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for i := 0; i < 5; i++ {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: fmt.Sprintf("draw-%d", i), StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw: %v", err)
+				}
+			}
+
+			for _, tt := range cases {
+				t.Run(tt.name, func(t *testing.T) {
+					size, offset := int64(10), tt.offset
+					pagination := domain.Pagination{Page: 1, Size: &size, Offset: &offset}
+
+					draws, err := d.ListLotteryDraws(ctx, "", pagination)
+					if err != nil {
+						t.Fatalf("ListLotteryDraws: %v", err)
+					}
+					if len(draws) != tt.want {
+						t.Errorf("got %d draws, want %d", len(draws), tt.want)
+					}
+
+					events, err := d.ListSecondKillEvents(ctx, "", pagination)
+					if err != nil {
+						t.Fatalf("ListSecondKillEvents: %v", err)
+					}
+					if len(events) != 0 {
+						t.Errorf("got %d events, want 0", len(events))
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestClaimSecondKillNeverOversells(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		d, db := newTestLotteryDrawDAO(t)
+		testConcurrentClaims(t, d, db)
+	})
+
+	t.Run("serializable", func(t *testing.T) {
+		_, db := newTestLotteryDrawDAO(t)
+		d := NewLotteryDrawDAO(db, zap.NewNop(), WithClaimIsolationLevel(sql.LevelSerializable))
+		testConcurrentClaims(t, d, db)
+	})
+}
+
+func TestClaimSecondKillEnforcesParticipationRules(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range levelledLotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			// 用户 1 的等级为 3，其余用户为 1
+			d := newDAO(t, func(_ context.Context, userID int64) (int, error) {
+				if userID == 1 {
+					return 3, nil
+				}
+				return 1, nil
+			})
+
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 5, MinUserLevel: 2}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			if _, err := d.ClaimSecondKill(ctx, 1, 1, now); err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+			if _, err := d.ClaimSecondKill(ctx, 1, 1, now); !errors.Is(err, ErrAlreadyClaimed) {
+				t.Errorf("duplicate claim err = %v, want ErrAlreadyClaimed", err)
+			}
+			if _, err := d.ClaimSecondKill(ctx, 1, 2, now); !errors.Is(err, ErrUserLevelTooLow) {
+				t.Errorf("under-level claim err = %v, want ErrUserLevelTooLow", err)
+			}
+
+			event, err := d.GetSecondKillEventByID(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetSecondKillEventByID: %v", err)
+			}
+			if event.SoldCount != 1 || len(event.Participants) != 1 {
+				t.Errorf("sold_count = %d, participants = %d, want 1 and 1", event.SoldCount, len(event.Participants))
+			}
+		})
+	}
+}
+
+func TestPauseAndResumeActivityResolveActivityType(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+			// 秒杀活动与抽奖活动的自增ID相互独立，先创建两个使第二个的ID只属于秒杀活动
+			for _, eventName := range []string{"event-1", "event-2"} {
+				if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: eventName, StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 1}); err != nil {
+					t.Fatalf("CreateSecondKillEvent: %v", err)
+				}
+			}
+
+			if err := d.PauseActivity(ctx, 1); !errors.Is(err, ErrAmbiguousActivityType) {
+				t.Errorf("PauseActivity(ambiguous) err = %v, want ErrAmbiguousActivityType", err)
+			}
+			if err := d.PauseActivity(ctx, 99); !errors.Is(err, ErrActivityNotFound) {
+				t.Errorf("PauseActivity(missing) err = %v, want ErrActivityNotFound", err)
+			}
+
+			if err := d.PauseActivity(ctx, 2); err != nil {
+				t.Fatalf("PauseActivity: %v", err)
+			}
+			if err := d.PauseActivity(ctx, 2); !errors.Is(err, ErrInvalidStatusTransition) {
+				t.Errorf("repeated PauseActivity err = %v, want ErrInvalidStatusTransition", err)
+			}
+			if _, err := d.ClaimSecondKill(ctx, 2, 1, now); !errors.Is(err, ErrActivityPaused) {
+				t.Errorf("ClaimSecondKill on paused event err = %v, want ErrActivityPaused", err)
+			}
+
+			if err := d.ResumeActivity(ctx, 2); err != nil {
+				t.Fatalf("ResumeActivity: %v", err)
+			}
+			event, err := d.GetSecondKillEventByID(ctx, 2)
+			if err != nil {
+				t.Fatalf("GetSecondKillEventByID: %v", err)
+			}
+			if event.Status != domain.SecondKillStatusActive {
+				t.Errorf("status after resume = %q, want %q", event.Status, domain.SecondKillStatusActive)
+			}
+		})
+	}
+}
+
+// testConcurrentClaims 并发抢购同一秒杀活动，校验已售数量不超过库存
+func testConcurrentClaims(t *testing.T, d LotteryDrawDAO, db *gorm.DB) {
+	t.Helper()
+	ctx := context.Background()
+
+	const stock, claimers = 5, 50
+
+	now := time.Now().Unix()
+	event := SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: stock}
+	if err := db.Create(&event).Error; err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+		soldOut int
+	)
+
+	start := make(chan struct{})
+	for i := 0; i < claimers; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			<-start
+
+			_, err := d.ClaimSecondKill(ctx, event.ID, userID, now)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				claimed++
+			case errors.Is(err, ErrSoldOut):
+				soldOut++
+			default:
+				t.Errorf("ClaimSecondKill: %v", err)
+			}
+		}(int64(i + 1))
+	}
+	close(start)
+	wg.Wait()
+
+	if claimed != stock || soldOut != claimers-stock {
+		t.Errorf("claimed = %d, sold out = %d, want %d and %d", claimed, soldOut, stock, claimers-stock)
+	}
+
+	var got SecondKillEvent
+	if err := db.First(&got, event.ID).Error; err != nil {
+		t.Fatalf("reload event: %v", err)
+	}
+	if got.SoldCount > got.Stock {
+		t.Errorf("sold_count = %d exceeds stock %d", got.SoldCount, got.Stock)
+	}
+
+	var participants int64
+	if err := db.Model(&Participant{}).Where("second_kill_id = ?", event.ID).Count(&participants).Error; err != nil {
+		t.Fatalf("count participants: %v", err)
+	}
+	if participants != int64(got.SoldCount) {
+		t.Errorf("participants = %d, want sold_count %d", participants, got.SoldCount)
+	}
+}
+
+func TestCountDistinctParticipatingUsersUsesParticipatedAtIndex(t *testing.T) {
+	d, db := newTestLotteryDrawDAO(t)
+	ctx := context.Background()
+
+	participants := make([]Participant, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		lotteryID := i%10 + 1
+		participants = append(participants, Participant{
+			ID:             fmt.Sprintf("p%d", i),
+			LotteryID:      &lotteryID,
+			UserID:         int64(i % 100),
+			ParticipatedAt: int64(1_700_000_000 + i*60),
+		})
+	}
+	if err := db.CreateInBatches(&participants, 500).Error; err != nil {
+		t.Fatalf("seed participants: %v", err)
+	}
+	if err := db.Exec("ANALYZE").Error; err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+
+	var count int64
+	plans := explainQueryPlans(t, db, "participants", func() {
+		var err error
+		count, err = d.CountDistinctParticipatingUsers(ctx, 1_700_000_000, 1_700_000_000+600*60)
+		if err != nil {
+			t.Fatalf("CountDistinctParticipatingUsers: %v", err)
+		}
+	})
+
+	if count != 100 {
+		t.Errorf("count = %d, want 100", count)
+	}
+	if len(plans) == 0 || !strings.Contains(plans[0], "idx_participated_at") {
+		t.Errorf("query plan does not use idx_participated_at: %v", plans)
+	}
+}
+
+func TestVerifyDrawFairness(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			if impl, ok := d.(*lotteryDrawDAO); ok {
+				var draw LotteryDraw
+				if err := impl.db.Session(&gorm.Session{SkipHooks: true}).First(&draw, activityID).Error; err != nil {
+					t.Fatalf("load draw: %v", err)
+				}
+				if draw.Seed == "" || draw.SeedHash != hashDrawSeed(draw.Seed) {
+					t.Fatalf("seed = %q, seed_hash = %q, want committed seed", draw.Seed, draw.SeedHash)
+				}
+			}
+
+			if _, err := d.VerifyDrawFairness(ctx, activityID); !errors.Is(err, ErrDrawNotVerifiable) {
+				t.Fatalf("VerifyDrawFairness before draw err = %v, want ErrDrawNotVerifiable", err)
+			}
+
+			for i := 0; i < 10; i++ {
+				p := Participant{ID: fmt.Sprintf("p%02d", i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: 1}
+				if err := d.AddParticipant(ctx, p); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", p.ID, err)
+				}
+			}
+
+			winners, err := d.DrawWinners(ctx, activityID, 3)
+			if err != nil {
+				t.Fatalf("DrawWinners: %v", err)
+			}
+
+			ok, err := d.VerifyDrawFairness(ctx, activityID)
+			if err != nil || !ok {
+				t.Fatalf("VerifyDrawFairness = %v, %v, want true", ok, err)
+			}
+
+			var buf bytes.Buffer
+			if err := d.ExportFairnessProof(ctx, activityID, &buf); err != nil {
+				t.Fatalf("ExportFairnessProof: %v", err)
+			}
+
+			var proof FairnessProof
+			if err := json.Unmarshal(buf.Bytes(), &proof); err != nil {
+				t.Fatalf("decode proof: %v", err)
+			}
+			if len(proof.ParticipantIDs) != 10 || !verifyFairnessProof(proof) {
+				t.Fatalf("exported proof with %d participants does not reproduce winners", len(proof.ParticipantIDs))
+			}
+
+			var replacement string
+			for i := 0; i < 10; i++ {
+				id := fmt.Sprintf("p%02d", i)
+				if !containsString(participantIDs(winners), id) {
+					replacement = id
+					break
+				}
+			}
+
+			if err := d.SwapWinner(ctx, activityID, winners[0].ID, replacement); err != nil {
+				t.Fatalf("SwapWinner: %v", err)
+			}
+
+			if ok, err := d.VerifyDrawFairness(ctx, activityID); err != nil || ok {
+				t.Errorf("VerifyDrawFairness after swap = %v, %v, want false", ok, err)
+			}
+		})
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDrawWinnersWaitsForDrawSlot(t *testing.T) {
+	d, db := newTestLotteryDrawDAO(t, WithMaxConcurrentDraws(1))
+	if cap(d.drawSem) != 1 {
+		t.Fatalf("drawSem capacity = %d, want 1", cap(d.drawSem))
+	}
+
+	draw := LotteryDraw{Name: "draw", StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}
+	if err := db.Create(&draw).Error; err != nil {
+		t.Fatalf("create draw: %v", err)
+	}
+	p := Participant{ID: "p", LotteryID: &draw.ID, UserID: 1, ParticipatedAt: 1}
+	if err := db.Create(&p).Error; err != nil {
+		t.Fatalf("create participant: %v", err)
+	}
+
+	// 占用唯一的开奖名额，模拟另一个正在进行的开奖
+	release, err := d.acquireDrawSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireDrawSlot: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := d.DrawWinners(ctx, draw.ID, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DrawWinners while slot held err = %v, want context.DeadlineExceeded", err)
+	}
+
+	release()
+
+	winners, err := d.DrawWinners(context.Background(), draw.ID, 1)
+	if err != nil {
+		t.Fatalf("DrawWinners after release: %v", err)
+	}
+	if len(winners) != 1 {
+		t.Errorf("got %d winners, want 1", len(winners))
+	}
+}
+
+func TestDrawWinnersWithoutParticipants(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			// 已退出的参与者不计入候选
+			activityID := 1
+			if err := d.AddParticipant(ctx, Participant{ID: "withdrawn", LotteryID: &activityID, UserID: 1, ParticipatedAt: now}); err != nil {
+				t.Fatalf("AddParticipant: %v", err)
+			}
+			if err := d.WithdrawParticipation(ctx, "withdrawn"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			winners, err := d.DrawWinners(ctx, activityID, 1)
+			if !errors.Is(err, ErrNoParticipants) {
+				t.Fatalf("DrawWinners err = %v, want ErrNoParticipants", err)
+			}
+			if len(winners) != 0 {
+				t.Errorf("got %d winners, want none", len(winners))
+			}
+
+			got, err := d.GetLotteryDrawByID(ctx, activityID)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			if got.Status != domain.LotteryStatusActive {
+				t.Errorf("status = %q, want %q", got.Status, domain.LotteryStatusActive)
+			}
+		})
+	}
+}
+
+// participationRuleCase 描述一条参与规则的判定场景，抽奖活动以 base 为模板，由用户 1 在 now 时刻参与
+type participationRuleCase struct {
+	name     string
+	mutate   func(*LotteryDraw)
+	existing []Participant
+	level    int
+	now      int64
+	reason   string
+}
+
+// participationRuleCases 覆盖 evaluateParticipation 每条规则的场景，供各参与路径校验判定一致
+var participationRuleCases = []participationRuleCase{
+	{name: "allowed", now: 120, reason: EntryReasonAllowed},
+	{name: "locked", mutate: func(d *LotteryDraw) { d.ParticipationLocked = true }, now: 120, reason: EntryReasonParticipationLocked},
+	{name: "paused", mutate: func(d *LotteryDraw) { d.Status = domain.LotteryStatusPaused }, now: 120, reason: EntryReasonPaused},
+	{name: "not active", mutate: func(d *LotteryDraw) { d.Status = domain.LotteryStatusPending }, now: 120, reason: EntryReasonNotActive},
+	{name: "before start", now: 90, reason: EntryReasonEntryWindowClosed},
+	{name: "entry opens before start", mutate: func(d *LotteryDraw) { d.EntryStartTime = 80 }, now: 90, reason: EntryReasonAllowed},
+	{name: "entry window closed", mutate: func(d *LotteryDraw) { d.EntryEndTime = 150 }, now: 160, reason: EntryReasonEntryWindowClosed},
+	{name: "level too low", mutate: func(d *LotteryDraw) { d.MinUserLevel = 2 }, level: 1, now: 120, reason: EntryReasonUserLevelTooLow},
+	{name: "level met", mutate: func(d *LotteryDraw) { d.MinUserLevel = 2 }, level: 2, now: 120, reason: EntryReasonAllowed},
+	{
+		name:     "activity full",
+		mutate:   func(d *LotteryDraw) { d.MaxParticipants = 1 },
+		existing: []Participant{{ID: "other", UserID: 2, ParticipatedAt: 110}},
+		now:      120,
+		reason:   EntryReasonActivityFull,
+	},
+	{
+		name:     "withdrawn entries free the cap",
+		mutate:   func(d *LotteryDraw) { d.MaxParticipants = 1 },
+		existing: []Participant{{ID: "other", UserID: 2, ParticipatedAt: 110, Withdrawn: true}},
+		now:      120,
+		reason:   EntryReasonAllowed,
+	},
+	{
+		name:     "entry limit reached",
+		mutate:   func(d *LotteryDraw) { d.MaxEntriesPerUser = 1 },
+		existing: []Participant{{ID: "mine", UserID: 1, ParticipatedAt: 110}},
+		now:      120,
+		reason:   EntryReasonEntryLimitReached,
+	},
+	{
+		name:     "cooldown",
+		mutate:   func(d *LotteryDraw) { d.EntryCooldownSeconds = 30 },
+		existing: []Participant{{ID: "mine", UserID: 1, ParticipatedAt: 110, Withdrawn: true}},
+		now:      120,
+		reason:   EntryReasonCooldown,
+	},
+	{
+		name:     "cooldown elapsed",
+		mutate:   func(d *LotteryDraw) { d.EntryCooldownSeconds = 30 },
+		existing: []Participant{{ID: "mine", UserID: 1, ParticipatedAt: 110}},
+		now:      140,
+		reason:   EntryReasonAllowed,
+	},
+}
+
+// createParticipationRuleDraw 按场景创建抽奖活动，活动 ID 为 1
+func createParticipationRuleDraw(t *testing.T, d LotteryDrawDAO, tt participationRuleCase) {
+	t.Helper()
+
+	draw := LotteryDraw{Name: "draw", StartTime: 100, EndTime: 200, Status: domain.LotteryStatusActive}
+	if tt.mutate != nil {
+		tt.mutate(&draw)
+	}
+	draw.Participants = tt.existing
+	if err := d.CreateLotteryDraw(context.Background(), draw); err != nil {
+		t.Fatalf("CreateLotteryDraw: %v", err)
+	}
+}
+
+func TestCanUserEnterMatchesAddParticipant(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range levelledLotteryDrawDAOFactories {
+		for _, tt := range participationRuleCases {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				d := newDAO(t, fixedUserLevel(tt.level))
+				createParticipationRuleDraw(t, d, tt)
+
+				allowed, reason, err := d.CanUserEnter(ctx, 1, 1, tt.level, tt.now)
+				if err != nil {
+					t.Fatalf("CanUserEnter: %v", err)
+				}
+				if reason != tt.reason || allowed != (reason == EntryReasonAllowed) {
+					t.Errorf("CanUserEnter = (%v, %q), want reason %q", allowed, reason, tt.reason)
+				}
+
+				// AddParticipant 必须与 CanUserEnter 的判定完全一致
+				activityID := 1
+				addErr := d.AddParticipant(ctx, Participant{ID: "new", LotteryID: &activityID, UserID: 1, ParticipatedAt: tt.now})
+				addReason := EntryReasonAllowed
+				if addErr != nil {
+					var ok bool
+					if addReason, ok = entryRejectionReason(addErr); !ok {
+						t.Fatalf("AddParticipant returned unexpected error: %v", addErr)
+					}
+				}
+				if addReason != reason {
+					t.Errorf("AddParticipant reason = %q (err %v), CanUserEnter reason = %q", addReason, addErr, reason)
+				}
+			})
+		}
+	}
+
+	d := NewInMemoryLotteryDrawDAO()
+	if _, _, err := d.CanUserEnter(ctx, 1, 1, 0, 120); !errors.Is(err, ErrActivityNotFound) {
+		t.Errorf("missing activity err = %v, want ErrActivityNotFound", err)
+	}
+	gormDAO, _ := newTestLotteryDrawDAO(t)
+	if _, _, err := gormDAO.CanUserEnter(ctx, 1, 1, 0, 120); !errors.Is(err, ErrActivityNotFound) {
+		t.Errorf("missing activity err = %v, want ErrActivityNotFound", err)
+	}
+}
+
+func TestListJoinableActivitiesForUserMatchesCanUserEnter(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		for _, tt := range participationRuleCases {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				d := newDAO(t)
+				createParticipationRuleDraw(t, d, tt)
+
+				allowed, _, err := d.CanUserEnter(ctx, 1, 1, tt.level, tt.now)
+				if err != nil {
+					t.Fatalf("CanUserEnter: %v", err)
+				}
+
+				// 已有未退出参与记录的活动不属于"尚未参与"
+				joined := false
+				for _, p := range tt.existing {
+					joined = joined || (p.UserID == 1 && !p.Withdrawn)
+				}
+
+				activities, err := d.ListJoinableActivitiesForUser(ctx, 1, tt.level, tt.now, 10)
+				if err != nil {
+					t.Fatalf("ListJoinableActivitiesForUser: %v", err)
+				}
+				if listed, want := len(activities) == 1, allowed && !joined; listed != want {
+					t.Errorf("listed = %v, want %v (CanUserEnter allowed = %v)", listed, want, allowed)
+				}
+			})
+		}
+
+		t.Run(name+"/locked second kill", func(t *testing.T) {
+			d := newDAO(t)
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: 100, EndTime: 200, Status: domain.SecondKillStatusActive, Stock: 1, ParticipationLocked: true}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			activities, err := d.ListJoinableActivitiesForUser(ctx, 1, 0, 120, 10)
+			if err != nil {
+				t.Fatalf("ListJoinableActivitiesForUser: %v", err)
+			}
+			if len(activities) != 0 {
+				t.Errorf("activities = %+v, want locked event excluded", activities)
+			}
+		})
+	}
+}
+
+func TestListWinnersForActivitiesPagesAcrossChunks(t *testing.T) {
+	d, db := newTestLotteryDrawDAO(t)
+	ctx := context.Background()
+
+	// 活动ID跨越多个分批，每个活动两名中奖者和一名未中奖者
+	activityIDs := []int{feedIDChunkSize*2 + 1, 1, feedIDChunkSize + 1}
+	for _, id := range activityIDs {
+		draw := LotteryDraw{ID: id, Name: fmt.Sprintf("draw-%d", id), StartTime: 1, EndTime: 2, Status: domain.LotteryStatusCompleted}
+		if err := db.Create(&draw).Error; err != nil {
+			t.Fatalf("create draw: %v", err)
+		}
+
+		for i, winner := range []bool{true, false, true} {
+			p := Participant{ID: fmt.Sprintf("%d-%d", id, i), LotteryID: &draw.ID, UserID: int64(i), ParticipatedAt: 1, IsWinner: winner}
+			if err := db.Create(&p).Error; err != nil {
+				t.Fatalf("create participant: %v", err)
+			}
+		}
+	}
+
+	var got []string
+	for size, offset := int64(4), int64(0); ; offset += size {
+		records, err := d.ListWinnersForActivities(ctx, activityIDs, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+		if err != nil {
+			t.Fatalf("ListWinnersForActivities: %v", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, r := range records {
+			got = append(got, r.ParticipantID)
+		}
+	}
+
+	want := []string{"1-0", "1-2", "501-0", "501-2", "1001-0", "1001-2"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("winners = %v, want %v", got, want)
+	}
+}
+
+func TestAddParticipantExternalRefUniqueIndex(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"a", "b"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			ref := "ref-1"
+			add := func(id string, lotteryID int, externalRef *string) error {
+				return d.AddParticipant(ctx, Participant{ID: id, LotteryID: &lotteryID, UserID: 1, ParticipatedAt: 1, ExternalRef: externalRef})
+			}
+
+			if err := add("p1", 1, &ref); err != nil {
+				t.Fatalf("first AddParticipant: %v", err)
+			}
+			if err := add("p2", 1, &ref); !errors.Is(err, ErrDuplicateExternalRef) {
+				t.Errorf("duplicate ref err = %v, want ErrDuplicateExternalRef", err)
+			}
+			if err := add("p3", 2, &ref); err != nil {
+				t.Errorf("same ref in another activity: %v", err)
+			}
+
+			// 没有外部参与编号的记录不受唯一索引约束
+			for _, id := range []string{"p4", "p5"} {
+				if err := add(id, 1, nil); err != nil {
+					t.Errorf("AddParticipant without ref: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDrawWinnersRejectsUndrawableStatus(t *testing.T) {
+	// 开启人数不足自动取消，确认被拒绝的活动不会被重复取消
+	d, db := newTestLotteryDrawDAO(t, WithCancelBelowMinParticipants(true))
+	ctx := context.Background()
+
+	for _, status := range []string{domain.LotteryStatusPending, domain.LotteryStatusPaused, domain.LotteryStatusCancelled} {
+		draw := LotteryDraw{Name: status, StartTime: 1, EndTime: 2, Status: status, MinParticipants: 5}
+		if err := db.Create(&draw).Error; err != nil {
+			t.Fatalf("create draw: %v", err)
+		}
+
+		p := Participant{ID: status, LotteryID: &draw.ID, UserID: 1, ParticipatedAt: 1}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create participant: %v", err)
+		}
+
+		if _, err := d.DrawWinners(ctx, draw.ID, 1); !errors.Is(err, ErrInvalidStatusTransition) {
+			t.Errorf("%s: DrawWinners err = %v, want ErrInvalidStatusTransition", status, err)
+		}
+
+		var got LotteryDraw
+		if err := db.First(&got, draw.ID).Error; err != nil {
+			t.Fatalf("load draw: %v", err)
+		}
+		if got.Status != status || got.CancelReason != "" {
+			t.Errorf("%s: status = %q, cancel reason = %q, want unchanged", status, got.Status, got.CancelReason)
+		}
+	}
+}
+
+func TestInstantDrawAndReserveEnforceParticipationRules(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			pending := LotteryDraw{Name: "pending", StartTime: now + 3600, EndTime: now + 7200, Status: domain.LotteryStatusPending,
+				Prizes: []Prize{{Name: "prize", Quantity: 1, Remaining: 1}}}
+			if err := d.CreateLotteryDraw(ctx, pending); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			if _, _, err := d.InstantDraw(ctx, 1, 1, 1); !errors.Is(err, ErrLotteryDrawNotActive) {
+				t.Errorf("InstantDraw on pending draw err = %v, want ErrLotteryDrawNotActive", err)
+			}
+			if _, _, err := d.InstantDraw(ctx, 99, 1, 1); !errors.Is(err, ErrActivityNotFound) {
+				t.Errorf("InstantDraw on missing draw err = %v, want ErrActivityNotFound", err)
+			}
+
+			draw, err := d.GetLotteryDrawByID(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			if len(draw.Participants) != 0 {
+				t.Errorf("participants = %d, want 0", len(draw.Participants))
+			}
+
+			paused := SecondKillEvent{Name: "paused", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusPaused, Stock: 1}
+			if err := d.CreateSecondKillEvent(ctx, paused); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			if _, err := d.ReserveSecondKill(ctx, 1, 1, now+60); !errors.Is(err, ErrActivityPaused) {
+				t.Errorf("ReserveSecondKill on paused event err = %v, want ErrActivityPaused", err)
+			}
+		})
+	}
+}
+
+func TestLiveParticipantCountTracksInsertsAndWithdrawals(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	d, _ := newTestLotteryDrawDAO(t, WithRedis(client))
+
+	if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "live", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+		t.Fatalf("CreateLotteryDraw: %v", err)
+	}
+
+	assertLive := func(step string, want int64) {
+		t.Helper()
+
+		got, err := d.GetLiveParticipantCount(ctx, 1)
+		if err != nil {
+			t.Fatalf("%s: GetLiveParticipantCount: %v", step, err)
+		}
+		actual, err := d.CountActiveParticipants(ctx, 1)
+		if err != nil {
+			t.Fatalf("%s: CountActiveParticipants: %v", step, err)
+		}
+		if got != want || actual != want {
+			t.Errorf("%s: live = %d, db = %d, want %d", step, got, actual, want)
+		}
+	}
+
+	// 首次读取回填计数器，之后的增减都作用在已存在的键上
+	assertLive("initial", 0)
+
+	activityID := 1
+	if err := d.AddParticipant(ctx, Participant{ID: "p1", LotteryID: &activityID, UserID: 1, ParticipatedAt: now}); err != nil {
+		t.Fatalf("AddParticipant: %v", err)
+	}
+	assertLive("after AddParticipant", 1)
+
+	_, instant, err := d.InstantDraw(ctx, activityID, 2, 0)
+	if err != nil {
+		t.Fatalf("InstantDraw: %v", err)
+	}
+	assertLive("after InstantDraw", 2)
+
+	if err := d.WithdrawParticipation(ctx, instant.ID); err != nil {
+		t.Fatalf("WithdrawParticipation: %v", err)
+	}
+	assertLive("after WithdrawParticipation", 1)
+
+	// 重复退出不改变退出标记，计数器也不应再次扣减
+	if err := d.WithdrawParticipation(ctx, instant.ID); err != nil {
+		t.Fatalf("WithdrawParticipation again: %v", err)
+	}
+	assertLive("after repeated WithdrawParticipation", 1)
+
+	if err := d.WithdrawParticipation(ctx, "missing"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("WithdrawParticipation on missing participant err = %v, want gorm.ErrRecordNotFound", err)
+	}
+}
+
+func TestDrawSeedHiddenUntilDrawn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			// 定时任务在结束时间到达后将活动置为完成，但此时尚未开奖
+			draw := LotteryDraw{Name: "ended", StartTime: now - 7200, EndTime: now - 60, Status: domain.LotteryStatusCompleted,
+				Participants: []Participant{
+					{ID: "p1", UserID: 1, ParticipatedAt: now - 3600},
+					{ID: "p2", UserID: 2, ParticipatedAt: now - 3600},
+				}}
+			if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			assertSeedHidden := func(step string) {
+				t.Helper()
+
+				got, err := d.GetLotteryDrawByID(ctx, 1)
+				if err != nil {
+					t.Fatalf("%s: GetLotteryDrawByID: %v", step, err)
+				}
+				if got.Seed != "" || got.SeedHash == "" {
+					t.Errorf("%s: GetLotteryDrawByID seed = %q, seed_hash = %q, want hidden seed and published hash", step, got.Seed, got.SeedHash)
+				}
+
+				size, offset := int64(10), int64(0)
+				list, err := d.ListLotteryDraws(ctx, "", domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+				if err != nil {
+					t.Fatalf("%s: ListLotteryDraws: %v", step, err)
+				}
+				if len(list) != 1 || list[0].Seed != "" {
+					t.Errorf("%s: ListLotteryDraws = %+v, want one draw without seed", step, list)
+				}
+
+				if _, err := d.VerifyDrawFairness(ctx, 1); !errors.Is(err, ErrDrawNotVerifiable) {
+					t.Errorf("%s: VerifyDrawFairness err = %v, want ErrDrawNotVerifiable", step, err)
+				}
+			}
+
+			assertSeedHidden("after end_time")
+
+			if err := d.WithdrawParticipation(ctx, "p1"); !errors.Is(err, ErrWithdrawalClosed) {
+				t.Errorf("WithdrawParticipation after end_time err = %v, want ErrWithdrawalClosed", err)
+			}
+
+			if _, err := d.DrawWinners(ctx, 1, 1); err != nil {
+				t.Fatalf("DrawWinners: %v", err)
+			}
+
+			got, err := d.GetLotteryDrawByID(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			if got.DrawnAt == 0 || got.Seed == "" || hashDrawSeed(got.Seed) != got.SeedHash {
+				t.Errorf("after draw drawn_at = %d, seed = %q, want revealed seed matching its hash", got.DrawnAt, got.Seed)
+			}
+
+			if ok, err := d.VerifyDrawFairness(ctx, 1); err != nil || !ok {
+				t.Errorf("VerifyDrawFairness after draw = %v, %v, want true", ok, err)
+			}
+		})
+	}
+}
+
+func TestSetParticipationLockResolvesActivityType(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			// ID 1 同时存在于两张表中，ID 2 只属于秒杀活动
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+			for _, eventName := range []string{"event-1", "event-2"} {
+				if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: eventName, StartTime: now, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 1}); err != nil {
+					t.Fatalf("CreateSecondKillEvent: %v", err)
+				}
+			}
+
+			if err := d.SetParticipationLock(ctx, 2, true); err != nil {
+				t.Fatalf("SetParticipationLock: %v", err)
+			}
+
+			locked, err := d.ListParticipationLockedActivities(ctx)
+			if err != nil {
+				t.Fatalf("ListParticipationLockedActivities: %v", err)
+			}
+			if len(locked) != 1 || locked[0].Type != domain.ActivityTypeSecondKill || locked[0].ID != 2 {
+				t.Errorf("locked = %+v, want only second kill event 2", locked)
+			}
+
+			// 重复设置相同的值不应被视为活动不存在
+			if err := d.SetParticipationLock(ctx, 2, true); err != nil {
+				t.Errorf("SetParticipationLock with unchanged value: %v", err)
+			}
+
+			if err := d.SetParticipationLock(ctx, 3, true); !errors.Is(err, ErrActivityNotFound) {
+				t.Errorf("SetParticipationLock on missing activity err = %v, want ErrActivityNotFound", err)
+			}
+			if err := d.SetParticipationLock(ctx, 1, true); !errors.Is(err, ErrAmbiguousActivityType) {
+				t.Errorf("SetParticipationLock on ambiguous ID err = %v, want ErrAmbiguousActivityType", err)
+			}
+		})
+	}
+}
+
+func TestSecondKillWarnings(t *testing.T) {
+	const now = int64(1_700_000_000)
+
+	valid := SecondKillEvent{Name: "event", StartTime: now + 60, EndTime: now + 3600, Status: domain.SecondKillStatusPending, Stock: 10}
+
+	tests := []struct {
+		name   string
+		mutate func(*SecondKillEvent)
+		want   []string
+	}{
+		{name: "valid", mutate: func(*SecondKillEvent) {}, want: []string{}},
+		{name: "zero stock", mutate: func(e *SecondKillEvent) { e.Stock = 0 }, want: []string{"库存为 0"}},
+		{name: "oversold", mutate: func(e *SecondKillEvent) { e.SoldCount = 11 }, want: []string{"已售数量 11 超过库存 10"}},
+		{name: "end before start", mutate: func(e *SecondKillEvent) { e.EndTime = e.StartTime - 1 }, want: []string{"结束时间不晚于开始时间"}},
+		{name: "start passed while pending", mutate: func(e *SecondKillEvent) { e.StartTime = now - 60 }, want: []string{"开始时间已过但活动仍未开始"}},
+		{name: "negative grace period", mutate: func(e *SecondKillEvent) { e.GracePeriodSeconds = -1 }, want: []string{"宽限期为负数"}},
+		{name: "locked", mutate: func(e *SecondKillEvent) { e.ParticipationLocked = true }, want: []string{"活动参与已被锁定"}},
+		{name: "invalid image", mutate: func(e *SecondKillEvent) { e.ImageURL = "ftp://example.com/a.png" }, want: []string{"活动图片地址不合法"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := valid
+			tt.mutate(&event)
+
+			if got := secondKillWarnings(event, now); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("secondKillWarnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSecondKillEventUsesGivenTime(t *testing.T) {
+	ctx := context.Background()
+	const now = int64(1_700_000_000)
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now + 60, EndTime: now + 3600, Status: domain.SecondKillStatusPending, Stock: 10}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			warnings, err := d.ValidateSecondKillEvent(ctx, 1, now)
+			if err != nil || len(warnings) != 0 {
+				t.Errorf("before start = (%q, %v), want no warnings", warnings, err)
+			}
+
+			warnings, err = d.ValidateSecondKillEvent(ctx, 1, now+120)
+			if err != nil || fmt.Sprint(warnings) != fmt.Sprint([]string{"开始时间已过但活动仍未开始"}) {
+				t.Errorf("after start = (%q, %v), want start passed warning", warnings, err)
+			}
+
+			if _, err := d.ValidateSecondKillEvent(ctx, 2, now); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("missing event err = %v, want gorm.ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestGetSecondKillBurnRate(t *testing.T) {
+	ctx := context.Background()
+	const now = int64(1_700_000_000)
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 3600, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 10}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			// 窗口外一次、窗口内四次有效抢购，另有一次窗口内的抢购已退款
+			for i, at := range []int64{now - 20, now - 7, now - 5, now - 3, now - 1, now - 2} {
+				claim, err := d.ClaimSecondKill(ctx, 1, int64(i+1), at)
+				if err != nil {
+					t.Fatalf("ClaimSecondKill(%d): %v", i+1, err)
+				}
+				if i == 5 {
+					if err := d.RefundSecondKillClaim(ctx, claim.ID, func(int64) error { return nil }); err != nil {
+						t.Fatalf("RefundSecondKillClaim: %v", err)
+					}
+				}
+			}
+
+			rate, selloutTs, err := d.GetSecondKillBurnRate(ctx, 1, 8, now)
+			if err != nil {
+				t.Fatalf("GetSecondKillBurnRate: %v", err)
+			}
+			// 剩余库存 5，每秒售出 0.5，预计 10 秒后售罄
+			if rate != 0.5 || selloutTs != now+10 {
+				t.Errorf("burn rate = (%v, %d), want (0.5, %d)", rate, selloutTs, now+10)
+			}
+
+			rate, selloutTs, err = d.GetSecondKillBurnRate(ctx, 1, 8, now+100)
+			if err != nil || rate != 0 || selloutTs != 0 {
+				t.Errorf("idle burn rate = (%v, %d, %v), want (0, 0, nil)", rate, selloutTs, err)
+			}
+
+			if _, _, err := d.GetSecondKillBurnRate(ctx, 1, 0, now); !errors.Is(err, ErrInvalidTimeWindow) {
+				t.Errorf("zero window err = %v, want ErrInvalidTimeWindow", err)
+			}
+
+			for i := int64(0); i < 5; i++ {
+				if _, err := d.ClaimSecondKill(ctx, 1, 100+i, now); err != nil {
+					t.Fatalf("ClaimSecondKill(%d): %v", 100+i, err)
+				}
+			}
+			if _, _, err := d.GetSecondKillBurnRate(ctx, 1, 8, now); !errors.Is(err, ErrSoldOut) {
+				t.Errorf("sold out err = %v, want ErrSoldOut", err)
+			}
+		})
+	}
+}
+
+func TestListTrendingActivities(t *testing.T) {
+	ctx := context.Background()
+	const now = int64(1_700_000_000)
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, draw := range []LotteryDraw{
+				{Name: "steady", StartTime: now - 3600, EndTime: now + 3600, Status: domain.LotteryStatusActive},
+				{Name: "ending", StartTime: now - 3600, EndTime: now + 50, Status: domain.LotteryStatusActive},
+			} {
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "flash", StartTime: now - 3600, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 10}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			// steady 在 sinceTs 之后有 3 次参与，另有 1 次早于 sinceTs；ending 有 4 次参与；flash 有 2 次抢购
+			entries := map[int][]int64{1: {now - 500, now - 30, now - 20, now - 10}, 2: {now - 40, now - 30, now - 20, now - 10}}
+			for lotteryID, times := range entries {
+				lotteryID := lotteryID
+				for i, at := range times {
+					p := Participant{ID: fmt.Sprintf("l%d-%d", lotteryID, i), LotteryID: &lotteryID, UserID: int64(i + 1), ParticipatedAt: at}
+					if err := d.AddParticipant(ctx, p); err != nil {
+						t.Fatalf("AddParticipant(%s): %v", p.ID, err)
+					}
+				}
+			}
+			for i, at := range []int64{now - 20, now - 10} {
+				if _, err := d.ClaimSecondKill(ctx, 1, int64(i+1), at); err != nil {
+					t.Fatalf("ClaimSecondKill(%d): %v", i+1, err)
+				}
+			}
+
+			names := func(activities []ActivitySummary) string {
+				var out []string
+				for _, a := range activities {
+					out = append(out, a.Type+":"+a.Name)
+				}
+				return fmt.Sprint(out)
+			}
+
+			sinceTs := now - 100
+			trending, err := d.ListTrendingActivities(ctx, sinceTs, 10, now)
+			if err != nil {
+				t.Fatalf("ListTrendingActivities: %v", err)
+			}
+			want := fmt.Sprint([]string{domain.ActivityTypeLottery + ":ending", domain.ActivityTypeLottery + ":steady", domain.ActivityTypeSecondKill + ":flash"})
+			if got := names(trending); got != want {
+				t.Errorf("trending = %s, want %s", got, want)
+			}
+
+			if trending, err = d.ListTrendingActivities(ctx, sinceTs, 1, now); err != nil || names(trending) != fmt.Sprint([]string{domain.ActivityTypeLottery + ":ending"}) {
+				t.Errorf("limited trending = (%s, %v), want only ending", names(trending), err)
+			}
+
+			// ending 在 now+100 时已结束，不再参与排序
+			trending, err = d.ListTrendingActivities(ctx, sinceTs, 10, now+100)
+			want = fmt.Sprint([]string{domain.ActivityTypeLottery + ":steady", domain.ActivityTypeSecondKill + ":flash"})
+			if err != nil || names(trending) != want {
+				t.Errorf("trending after ending closed = (%s, %v), want %s", names(trending), err, want)
+			}
+		})
+	}
+}
+
+func TestGetParticipantRankExcludesWithdrawn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 3600, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, id := range []string{"a", "b", "c"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: now + int64(i)}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+
+			if rank, err := d.GetParticipantRank(ctx, activityID, "c"); err != nil || rank != 3 {
+				t.Errorf("rank before withdrawal = (%d, %v), want 3", rank, err)
+			}
+
+			if err := d.WithdrawParticipation(ctx, "a"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			if rank, err := d.GetParticipantRank(ctx, activityID, "c"); err != nil || rank != 2 {
+				t.Errorf("rank after withdrawal = (%d, %v), want 2", rank, err)
+			}
+			if _, err := d.GetParticipantRank(ctx, activityID, "a"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("withdrawn participant rank err = %v, want gorm.ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestGetLotteryDrawWithParticipantPageExcludesWithdrawn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 3600, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, id := range []string{"a", "b", "c", "d"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: now + int64(i)}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "a"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			size, offset := int64(2), int64(0)
+			draw, err := d.GetLotteryDrawWithParticipantPage(ctx, activityID, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("GetLotteryDrawWithParticipantPage: %v", err)
+			}
+			if got := participantIDs(draw.Participants); !equalStrings(got, []string{"b", "c"}) || draw.ParticipantTotal != 3 {
+				t.Errorf("page = %v, total = %d, want [b c] and 3", got, draw.ParticipantTotal)
+			}
+
+			offset = 2
+			draw, err = d.GetLotteryDrawWithParticipantPage(ctx, activityID, domain.Pagination{Page: 2, Size: &size, Offset: &offset})
+			if err != nil || !equalStrings(participantIDs(draw.Participants), []string{"d"}) || draw.ParticipantTotal != 3 {
+				t.Errorf("second page = (%v, total %d, %v), want [d] and 3", participantIDs(draw.Participants), draw.ParticipantTotal, err)
+			}
+		})
+	}
+}
+
+func TestGetLotteryDrawForUserIgnoresWithdrawn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 3600, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			if err := d.AddParticipant(ctx, Participant{ID: "p1", LotteryID: &activityID, UserID: 7, ParticipatedAt: now}); err != nil {
+				t.Fatalf("AddParticipant: %v", err)
+			}
+
+			draw, participated, err := d.GetLotteryDrawForUser(ctx, activityID, 7)
+			if err != nil || draw.Name != "draw" || !participated {
+				t.Errorf("before withdrawal = (%q, %v, %v), want draw and participated", draw.Name, participated, err)
+			}
+			if _, participated, err := d.GetLotteryDrawForUser(ctx, activityID, 8); err != nil || participated {
+				t.Errorf("other user participated = (%v, %v), want false", participated, err)
+			}
+
+			if err := d.WithdrawParticipation(ctx, "p1"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+			if _, participated, err := d.GetLotteryDrawForUser(ctx, activityID, 7); err != nil || participated {
+				t.Errorf("after withdrawal participated = (%v, %v), want false", participated, err)
+			}
+
+			if _, _, err := d.GetLotteryDrawForUser(ctx, 2, 7); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("missing draw err = %v, want gorm.ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestListDrawAuditsOrdersAndFiltersByActivity(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			// 每个活动两名参与者、一名中奖者，返回中奖者和未中奖者的参与记录ID
+			drawOne := func(activityID int) (string, string) {
+				t.Helper()
+
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: fmt.Sprintf("draw-%d", activityID), StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%d): %v", activityID, err)
+				}
+				for i := 0; i < 2; i++ {
+					p := Participant{ID: fmt.Sprintf("%d-%d", activityID, i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: 1}
+					if err := d.AddParticipant(ctx, p); err != nil {
+						t.Fatalf("AddParticipant(%s): %v", p.ID, err)
+					}
+				}
+
+				winners, err := d.DrawWinners(ctx, activityID, 1)
+				if err != nil || len(winners) != 1 {
+					t.Fatalf("DrawWinners(%d) = (%d winners, %v), want 1", activityID, len(winners), err)
+				}
+				if winners[0].ID == fmt.Sprintf("%d-0", activityID) {
+					return winners[0].ID, fmt.Sprintf("%d-1", activityID)
+				}
+				return winners[0].ID, fmt.Sprintf("%d-0", activityID)
+			}
+
+			winner, other := drawOne(1)
+			otherWinner, otherLoser := drawOne(2)
+
+			if err := d.SwapWinner(ContextWithActor(ctx, 100), 1, winner, other); err != nil {
+				t.Fatalf("first SwapWinner: %v", err)
+			}
+			if err := d.SwapWinner(ContextWithActor(ctx, 200), 2, otherWinner, otherLoser); err != nil {
+				t.Fatalf("SwapWinner on activity 2: %v", err)
+			}
+			if err := d.SwapWinner(ContextWithActor(ctx, 101), 1, other, winner); err != nil {
+				t.Fatalf("second SwapWinner: %v", err)
+			}
+
+			size, offset := int64(10), int64(0)
+			audits, err := d.ListDrawAudits(ctx, 1, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListDrawAudits: %v", err)
+			}
+
+			// 只包含活动 1 的记录，最新的在前
+			type auditView struct {
+				Actor          int64
+				Action         string
+				ParticipantIDs []string
+			}
+			var got []auditView
+			for _, a := range audits {
+				if a.ActivityID != 1 {
+					t.Errorf("audit %d belongs to activity %d, want 1", a.ID, a.ActivityID)
+				}
+				got = append(got, auditView{Actor: a.Actor, Action: a.Action, ParticipantIDs: a.ParticipantIDs})
+			}
+			want := []auditView{
+				{Actor: 101, Action: DrawAuditActionSwapWinner, ParticipantIDs: []string{other, winner}},
+				{Actor: 100, Action: DrawAuditActionSwapWinner, ParticipantIDs: []string{winner, other}},
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("audits = %+v, want %+v", got, want)
+			}
+
+			size, offset = 1, 1
+			page, err := d.ListDrawAudits(ctx, 1, domain.Pagination{Page: 2, Size: &size, Offset: &offset})
+			if err != nil || len(page) != 1 || page[0].Actor != 100 {
+				t.Errorf("second page = (%+v, %v), want the first swap", page, err)
+			}
+
+			if audits, err := d.ListDrawAudits(ctx, 3, domain.Pagination{Page: 1, Size: &size, Offset: &offset}); err != nil || len(audits) != 0 {
+				t.Errorf("audits for activity without records = (%+v, %v), want none", audits, err)
+			}
+		})
+	}
+}
+
+func TestRefundSecondKillClaimRollsBackOnCallbackError(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			claim, err := d.ClaimSecondKill(ctx, 1, 7, now)
+			if err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+
+			size, offset := int64(10), int64(0)
+			pagination := domain.Pagination{Page: 1, Size: &size, Offset: &offset}
+
+			assertState := func(step string, wantSold int, wantClaims int) {
+				t.Helper()
+
+				event, err := d.GetSecondKillEventByID(ctx, 1)
+				if err != nil {
+					t.Fatalf("%s: GetSecondKillEventByID: %v", step, err)
+				}
+				claims, err := d.ListUserSecondKillClaims(ctx, 7, pagination)
+				if err != nil {
+					t.Fatalf("%s: ListUserSecondKillClaims: %v", step, err)
+				}
+				if event.SoldCount != wantSold || len(claims) != wantClaims {
+					t.Errorf("%s: sold = %d, claims = %d, want %d and %d", step, event.SoldCount, len(claims), wantSold, wantClaims)
+				}
+			}
+
+			errRefund := errors.New("payment gateway unavailable")
+			if err := d.RefundSecondKillClaim(ctx, claim.ID, func(int64) error { return errRefund }); !errors.Is(err, errRefund) {
+				t.Fatalf("RefundSecondKillClaim with failing callback err = %v, want %v", err, errRefund)
+			}
+			assertState("after failed refund", 1, 1)
+
+			refund := func(int64) error { return nil }
+			if name == "inMemory" {
+				// 内存实现在释放锁后执行回调，回调中再次调用 DAO 不应死锁，且此时退款尚未生效
+				refund = func(int64) error {
+					event, err := d.GetSecondKillEventByID(ctx, 1)
+					if err == nil && event.SoldCount != 1 {
+						t.Errorf("sold during callback = %d, want 1", event.SoldCount)
+					}
+					return err
+				}
+			}
+
+			if err := d.RefundSecondKillClaim(ctx, claim.ID, refund); err != nil {
+				t.Fatalf("RefundSecondKillClaim: %v", err)
+			}
+			assertState("after refund", 0, 0)
+
+			if err := d.RefundSecondKillClaim(ctx, claim.ID, func(int64) error { return nil }); !errors.Is(err, ErrClaimNotRefundable) {
+				t.Errorf("second RefundSecondKillClaim err = %v, want ErrClaimNotRefundable", err)
+			}
+		})
+	}
+}
+
+func TestListUserSecondKillClaims(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"first", "second", "third"} {
+				if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: name, StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 5}); err != nil {
+					t.Fatalf("CreateSecondKillEvent(%s): %v", name, err)
+				}
+			}
+
+			first, err := d.ClaimSecondKill(ctx, 1, 7, now-20)
+			if err != nil {
+				t.Fatalf("ClaimSecondKill(1): %v", err)
+			}
+			second, err := d.ClaimSecondKill(ctx, 2, 7, now-10)
+			if err != nil {
+				t.Fatalf("ClaimSecondKill(2): %v", err)
+			}
+			refunded, err := d.ClaimSecondKill(ctx, 3, 7, now)
+			if err != nil {
+				t.Fatalf("ClaimSecondKill(3): %v", err)
+			}
+			if _, err := d.ClaimSecondKill(ctx, 1, 8, now); err != nil {
+				t.Fatalf("ClaimSecondKill(other user): %v", err)
+			}
+			if err := d.RefundSecondKillClaim(ctx, refunded.ID, func(int64) error { return nil }); err != nil {
+				t.Fatalf("RefundSecondKillClaim: %v", err)
+			}
+
+			size, offset := int64(10), int64(0)
+			claims, err := d.ListUserSecondKillClaims(ctx, 7, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListUserSecondKillClaims: %v", err)
+			}
+
+			// 已退款的记录和其他用户的记录不出现，其余按抢购时间倒序
+			if len(claims) != 2 || claims[0].ID != second.ID || claims[1].ID != first.ID {
+				t.Fatalf("claims = %+v, want [%s %s]", claims, second.ID, first.ID)
+			}
+			if claims[0].SecondKillID == nil || *claims[0].SecondKillID != 2 || claims[0].UserID != 7 {
+				t.Errorf("claims[0] = %+v, want second kill 2 for user 7", claims[0])
+			}
+
+			size = 1
+			page, err := d.ListUserSecondKillClaims(ctx, 7, domain.Pagination{Page: 2, Size: &size, Offset: &size})
+			if err != nil || len(page) != 1 || page[0].ID != first.ID {
+				t.Errorf("second page = (%+v, %v), want [%s]", page, err, first.ID)
+			}
+		})
+	}
+}
+
+func TestFlushSecondKillCacheToDB(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	d, _ := newTestLotteryDrawDAO(t, WithRedis(client))
+
+	if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 2}); err != nil {
+		t.Fatalf("CreateSecondKillEvent: %v", err)
+	}
+
+	// 数据库路径的抢购占用一份库存，Redis 路径只剩一份可登记
+	if _, err := d.ClaimSecondKill(ctx, 1, 1, now); err != nil {
+		t.Fatalf("ClaimSecondKill: %v", err)
+	}
+
+	if err := d.ClaimSecondKillCached(ctx, 1, 2, now); err != nil {
+		t.Fatalf("ClaimSecondKillCached: %v", err)
+	}
+	if err := d.ClaimSecondKillCached(ctx, 1, 2, now); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("repeated ClaimSecondKillCached err = %v, want ErrAlreadyClaimed", err)
+	}
+	if err := d.ClaimSecondKillCached(ctx, 1, 3, now); !errors.Is(err, ErrSoldOut) {
+		t.Errorf("ClaimSecondKillCached beyond stock err = %v, want ErrSoldOut", err)
+	}
+
+	// 模拟超出库存的历史登记：刷新时只能按抢购时间写入剩余库存数量的记录
+	mr.HSet(secondKillWinnersKey(1), "4", fmt.Sprint(now+1))
+	mr.HSet(secondKillWinnersKey(1), "1", fmt.Sprint(now))
+
+	flushed, err := d.FlushSecondKillCacheToDB(ctx, 1)
+	if err != nil {
+		t.Fatalf("FlushSecondKillCacheToDB: %v", err)
+	}
+	if flushed != 1 {
+		t.Errorf("flushed = %d, want 1", flushed)
+	}
+
+	event, err := d.GetSecondKillEventByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetSecondKillEventByID: %v", err)
+	}
+	if event.SoldCount != 2 {
+		t.Errorf("sold_count = %d, want 2", event.SoldCount)
+	}
+
+	for userID, want := range map[int64]bool{1: true, 2: true, 4: false} {
+		joined, err := d.HasUserParticipatedInSecondKill(ctx, 1, userID)
+		if err != nil {
+			t.Fatalf("HasUserParticipatedInSecondKill(%d): %v", userID, err)
+		}
+		if joined != want {
+			t.Errorf("user %d participated = %v, want %v", userID, joined, want)
+		}
+	}
+
+	if keys, _ := mr.HKeys(secondKillWinnersKey(1)); len(keys) != 0 {
+		t.Errorf("cache key still holds %v after flush", keys)
+	}
+
+	if flushed, err := d.FlushSecondKillCacheToDB(ctx, 1); err != nil || flushed != 0 {
+		t.Errorf("second FlushSecondKillCacheToDB = %d, %v, want 0, nil", flushed, err)
+	}
+
+	if err := d.ClaimSecondKillCached(ctx, 1, 5, now); !errors.Is(err, ErrSoldOut) {
+		t.Errorf("ClaimSecondKillCached after sell-out err = %v, want ErrSoldOut", err)
+	}
+}
+
+func TestClaimSecondKillCachedRejectsRepeatedClaims(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	// 用户 4 的等级为 1，其余用户为 2
+	d, _ := newTestLotteryDrawDAO(t, WithRedis(client), WithUserLevelResolver(func(_ context.Context, userID int64) (int, error) {
+		if userID == 4 {
+			return 1, nil
+		}
+		return 2, nil
+	}))
+
+	if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 10, MinUserLevel: 2}); err != nil {
+		t.Fatalf("CreateSecondKillEvent: %v", err)
+	}
+
+	if err := d.ClaimSecondKillCached(ctx, 1, 4, now); !errors.Is(err, ErrUserLevelTooLow) {
+		t.Errorf("under-level ClaimSecondKillCached err = %v, want ErrUserLevelTooLow", err)
+	}
+
+	// 数据库路径已抢购的用户不能再通过 Redis 路径抢购
+	if _, err := d.ClaimSecondKill(ctx, 1, 1, now); err != nil {
+		t.Fatalf("ClaimSecondKill: %v", err)
+	}
+	if err := d.ClaimSecondKillCached(ctx, 1, 1, now); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("ClaimSecondKillCached after ClaimSecondKill err = %v, want ErrAlreadyClaimed", err)
+	}
+
+	// 登记被持久化并从抢购结果中删除后，同一用户仍不能再次抢购
+	if err := d.ClaimSecondKillCached(ctx, 1, 2, now); err != nil {
+		t.Fatalf("ClaimSecondKillCached: %v", err)
+	}
+	if flushed, err := d.FlushSecondKillCacheToDB(ctx, 1); err != nil || flushed != 1 {
+		t.Fatalf("FlushSecondKillCacheToDB = %d, %v, want 1, nil", flushed, err)
+	}
+	if err := d.ClaimSecondKillCached(ctx, 1, 2, now); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("ClaimSecondKillCached after flush err = %v, want ErrAlreadyClaimed", err)
+	}
+	// 已抢购用户集合过期后由数据库中的参与记录拒绝
+	mr.Del(secondKillClaimedUsersKey(1))
+	if err := d.ClaimSecondKillCached(ctx, 1, 2, now); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("ClaimSecondKillCached after set expiry err = %v, want ErrAlreadyClaimed", err)
+	}
+
+	// 绕过脚本写入的重复登记在刷新时被丢弃：用户 1 已有参与记录，用户 3 以两种字段形式登记
+	mr.HSet(secondKillWinnersKey(1), "1", fmt.Sprint(now))
+	mr.HSet(secondKillWinnersKey(1), "3", fmt.Sprint(now))
+	mr.HSet(secondKillWinnersKey(1), "03", fmt.Sprint(now+1))
+
+	flushed, err := d.FlushSecondKillCacheToDB(ctx, 1)
+	if err != nil {
+		t.Fatalf("FlushSecondKillCacheToDB: %v", err)
+	}
+	if flushed != 1 {
+		t.Errorf("flushed = %d, want 1", flushed)
+	}
+
+	event, err := d.GetSecondKillEventByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetSecondKillEventByID: %v", err)
+	}
+	if event.SoldCount != 3 || len(event.Participants) != 3 {
+		t.Errorf("sold_count = %d, participants = %d, want 3 and 3", event.SoldCount, len(event.Participants))
+	}
+}
+
+func TestRefreshStatusesForIDsFollowsScheduledStatus(t *testing.T) {
+	ctx := context.Background()
+	const now = 1000
+
+	draws := []struct {
+		name      string
+		status    string
+		startTime int64
+		endTime   int64
+		want      string
+	}{
+		{name: "pending not started", status: domain.LotteryStatusPending, startTime: 1100, endTime: 1200, want: domain.LotteryStatusPending},
+		{name: "pending started", status: domain.LotteryStatusPending, startTime: 1000, endTime: 1200, want: domain.LotteryStatusActive},
+		{name: "pending already ended", status: domain.LotteryStatusPending, startTime: 900, endTime: 1000, want: domain.LotteryStatusCompleted},
+		{name: "active running", status: domain.LotteryStatusActive, startTime: 900, endTime: 1001, want: domain.LotteryStatusActive},
+		{name: "active ended", status: domain.LotteryStatusActive, startTime: 900, endTime: 1000, want: domain.LotteryStatusCompleted},
+		{name: "paused ended", status: domain.LotteryStatusPaused, startTime: 900, endTime: 950, want: domain.LotteryStatusPaused},
+		{name: "cancelled", status: domain.LotteryStatusCancelled, startTime: 900, endTime: 950, want: domain.LotteryStatusCancelled},
+	}
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			ids := make([]int, 0, len(draws)+1)
+			var wantChanged int64
+			for i, tt := range draws {
+				draw := LotteryDraw{Name: tt.name, Status: tt.status, StartTime: tt.startTime, EndTime: tt.endTime}
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", tt.name, err)
+				}
+				ids = append(ids, i+1)
+
+				if got := domain.ScheduledLotteryStatus(tt.status, tt.startTime, tt.endTime, now); got != tt.want {
+					t.Errorf("ScheduledLotteryStatus(%s) = %s, want %s", tt.name, got, tt.want)
+				}
+				if tt.want != tt.status {
+					wantChanged++
+				}
+			}
+
+			// 不存在的 ID 被忽略
+			ids = append(ids, len(draws)+100)
+
+			changed, err := d.RefreshStatusesForIDs(ctx, ids, now)
+			if err != nil {
+				t.Fatalf("RefreshStatusesForIDs: %v", err)
+			}
+			if changed != wantChanged {
+				t.Errorf("changed = %d, want %d", changed, wantChanged)
+			}
+
+			for i, tt := range draws {
+				got, err := d.GetLotteryDrawByID(ctx, i+1)
+				if err != nil {
+					t.Fatalf("GetLotteryDrawByID(%s): %v", tt.name, err)
+				}
+				if got.Status != tt.want {
+					t.Errorf("%s: status = %s, want %s", tt.name, got.Status, tt.want)
+				}
+			}
+
+			// 再次刷新不应产生变化
+			if changed, err := d.RefreshStatusesForIDs(ctx, ids, now); err != nil || changed != 0 {
+				t.Errorf("second refresh = (%d, %v), want (0, nil)", changed, err)
+			}
+
+			if _, err := d.RefreshStatusesForIDs(ctx, nil, now); !errors.Is(err, ErrEmptyIDs) {
+				t.Errorf("empty ids err = %v, want ErrEmptyIDs", err)
+			}
+		})
+	}
+}
+
+func TestGroupParticipantsByMetaField(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, metadata := range []map[string]string{
+				{"ip": "10.0.0.1", "device_id": "a"},
+				{"ip": "10.0.0.1"},
+				{"ip": "10.0.0.2"},
+				// 值中包含字段名的记录不能被误归入该字段的分组
+				{"device_id": "ip"},
+				nil,
+			} {
+				if err := d.AddParticipant(ctx, Participant{ID: fmt.Sprintf("entry-%d", i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: now + int64(i), Metadata: metadata}); err != nil {
+					t.Fatalf("AddParticipant(%d): %v", i, err)
+				}
+			}
+
+			groups, err := d.GroupParticipantsByMetaField(ctx, activityID, "ip")
+			if err != nil {
+				t.Fatalf("GroupParticipantsByMetaField: %v", err)
+			}
+			if len(groups) != 2 || len(groups["10.0.0.1"]) != 2 || len(groups["10.0.0.2"]) != 1 {
+				t.Fatalf("groups = %+v, want 10.0.0.1 x2 and 10.0.0.2 x1", groups)
+			}
+			if groups["10.0.0.1"][0].ID != "entry-0" || groups["10.0.0.1"][1].ID != "entry-1" {
+				t.Errorf("10.0.0.1 group = %+v, want entry-0 and entry-1 in participation order", groups["10.0.0.1"])
+			}
+
+			if _, err := d.GroupParticipantsByMetaField(ctx, activityID, "ip') OR 1=1 --"); !errors.Is(err, ErrInvalidMetaField) {
+				t.Errorf("unlisted field err = %v, want ErrInvalidMetaField", err)
+			}
+		})
+	}
+}
+
+func TestListNonWinnersExcludesWithdrawn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive,
+				Prizes: []Prize{{Name: "prize", Quantity: 1, Remaining: 1}}}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			if won, _, err := d.InstantDraw(ctx, 1, 1, 1); err != nil || !won {
+				t.Fatalf("InstantDraw = %v, %v, want win", won, err)
+			}
+			activityID := 1
+			for _, id := range []string{"stays", "leaves"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: 2, ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "leaves"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			size, offset := int64(10), int64(0)
+			nonWinners, err := d.ListNonWinners(ctx, activityID, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListNonWinners: %v", err)
+			}
+			if len(nonWinners) != 1 || nonWinners[0].ID != "stays" {
+				t.Errorf("ListNonWinners = %+v, want only participant stays", nonWinners)
+			}
+		})
+	}
+}
+
+func TestMergeActivitiesSkipsTargetUsersAndRespectsCap(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			// 活动 1 上限 3 人，活动 3 不限人数
+			for _, draw := range []LotteryDraw{
+				{Name: "capped-target", MaxParticipants: 3},
+				{Name: "capped-source"},
+				{Name: "open-target"},
+				{Name: "open-source"},
+			} {
+				draw.StartTime, draw.EndTime, draw.Status = now-60, now+3600, domain.LotteryStatusActive
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+
+			entries := []struct {
+				id         string
+				activityID int
+				userID     int64
+			}{
+				{"t1-u1", 1, 1}, {"t1-u2", 1, 2},
+				{"s2-u2", 2, 2}, {"s2-u3", 2, 3}, {"s2-u4", 2, 4},
+				{"t3-u1", 3, 1},
+				{"s4-u1", 4, 1}, {"s4-u5", 4, 5}, {"s4-u5-again", 4, 5},
+			}
+			for i, e := range entries {
+				activityID := e.activityID
+				if err := d.AddParticipant(ctx, Participant{ID: e.id, LotteryID: &activityID, UserID: e.userID, ParticipatedAt: now + int64(i)}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", e.id, err)
+				}
+			}
+
+			// 用户 2 已在目标活动中被跳过，用户 3 迁移后达到上限，用户 4 留在源活动
+			moved, err := d.MergeActivities(ctx, 2, 1)
+			if err != nil || moved != 1 {
+				t.Fatalf("MergeActivities(capped) = %d, %v, want 1, nil", moved, err)
+			}
+			if count, err := d.CountActiveParticipants(ctx, 1); err != nil || count != 3 {
+				t.Errorf("capped target participants = %d, %v, want 3", count, err)
+			}
+			if count, err := d.CountActiveParticipants(ctx, 2); err != nil || count != 2 {
+				t.Errorf("capped source participants = %d, %v, want 2", count, err)
+			}
+
+			// 用户 1 已在目标活动中被跳过，用户 5 的两条记录只迁移一条
+			moved, err = d.MergeActivities(ctx, 4, 3)
+			if err != nil || moved != 1 {
+				t.Fatalf("MergeActivities(open) = %d, %v, want 1, nil", moved, err)
+			}
+
+			target, err := d.GetLotteryDrawByID(ctx, 3)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			var got []string
+			for _, p := range target.Participants {
+				got = append(got, p.ID)
+			}
+			if len(got) != 2 || got[0] != "t3-u1" || got[1] != "s4-u5" {
+				t.Errorf("open target participants = %v, want [t3-u1 s4-u5]", got)
+			}
+
+			source, err := d.GetLotteryDrawByID(ctx, 4)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			if source.Status != domain.LotteryStatusCancelled {
+				t.Errorf("source status = %q, want %q", source.Status, domain.LotteryStatusCancelled)
+			}
+		})
+	}
+}
+
+func TestRemoveUsersFromActivitiesRestoresStockAndPrizes(t *testing.T) {
+	ctx := ContextWithActor(context.Background(), 42)
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive,
+				Prizes: []Prize{{Name: "prize", Quantity: 2, Remaining: 2}}}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			// 用户 5 中奖占用一份奖品，用户 6 未中奖
+			won, winner, err := d.InstantDraw(ctx, 1, 5, 1)
+			if err != nil || !won {
+				t.Fatalf("InstantDraw = %v, %v, want win", won, err)
+			}
+			activityID := 1
+			if err := d.AddParticipant(ctx, Participant{ID: "entry", LotteryID: &activityID, UserID: 6, ParticipatedAt: now}); err != nil {
+				t.Fatalf("AddParticipant: %v", err)
+			}
+
+			removed, err := d.RemoveUsersFromActivities(ctx, []int{1}, []int64{5})
+			if err != nil || removed != 1 {
+				t.Fatalf("remove from lottery = (%d, %v), want (1, nil)", removed, err)
+			}
+
+			snapshot, err := d.SnapshotActivity(ctx, 1)
+			if err != nil {
+				t.Fatalf("SnapshotActivity: %v", err)
+			}
+			if snapshot.ParticipantCount != 1 || snapshot.WinnerCount != 0 || snapshot.PrizeRemaining != 2 {
+				t.Errorf("lottery after removal = %d participants, %d winners, %d prizes remaining, want 1, 0 and 2",
+					snapshot.ParticipantCount, snapshot.WinnerCount, snapshot.PrizeRemaining)
+			}
+
+			size, offset := int64(10), int64(0)
+			audits, err := d.ListDrawAudits(ctx, 1, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListDrawAudits: %v", err)
+			}
+			if len(audits) != 1 || audits[0].Action != DrawAuditActionRemoveUsers || audits[0].Actor != 42 ||
+				len(audits[0].ParticipantIDs) != 1 || audits[0].ParticipantIDs[0] != winner.ID {
+				t.Errorf("audits = %+v, want one remove_users audit for %s by actor 42", audits, winner.ID)
+			}
+
+			// 创建秒杀活动后 ID 1 同时存在于两张表中，ID 2 只属于秒杀活动
+			for _, eventName := range []string{"event-1", "event-2"} {
+				if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: eventName, StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 2}); err != nil {
+					t.Fatalf("CreateSecondKillEvent: %v", err)
+				}
+			}
+			if _, err := d.ClaimSecondKill(ctx, 2, 6, now); err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+
+			// 任一活动不明确或不存在时不删除任何记录
+			if _, err := d.RemoveUsersFromActivities(ctx, []int{2, 1}, []int64{6}); !errors.Is(err, ErrAmbiguousActivityType) {
+				t.Errorf("ambiguous activity err = %v, want ErrAmbiguousActivityType", err)
+			}
+			if _, err := d.RemoveUsersFromActivities(ctx, []int{2, 99}, []int64{6}); !errors.Is(err, ErrActivityNotFound) {
+				t.Errorf("missing activity err = %v, want ErrActivityNotFound", err)
+			}
+
+			removed, err = d.RemoveUsersFromActivities(ctx, []int{2}, []int64{6})
+			if err != nil || removed != 1 {
+				t.Fatalf("remove from second kill = (%d, %v), want (1, nil)", removed, err)
+			}
+
+			event, err := d.GetSecondKillEventByID(ctx, 2)
+			if err != nil {
+				t.Fatalf("GetSecondKillEventByID: %v", err)
+			}
+			if len(event.Participants) != 0 || event.SoldCount != 0 {
+				t.Errorf("second kill after removal = %d participants, sold %d, want 0 and 0", len(event.Participants), event.SoldCount)
+			}
+
+			// 用户 6 在抽奖活动中的参与不受秒杀活动移除影响
+			draw, err := d.GetLotteryDrawByID(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			if len(draw.Participants) != 1 || draw.Participants[0].UserID != 6 {
+				t.Errorf("lottery participants = %+v, want only user 6", draw.Participants)
+			}
+		})
+	}
+}
+
+func TestSnapshotActivityResolvesActivityType(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive,
+				Prizes: []Prize{{Name: "prize", Quantity: 3, Remaining: 2}}}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, userID := range []int64{1, 2, 2} {
+				if err := d.AddParticipant(ctx, Participant{ID: fmt.Sprintf("entry-%d", i), LotteryID: &activityID, UserID: userID, ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant: %v", err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "entry-0"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			lottery, err := d.SnapshotActivity(ctx, 1)
+			if err != nil {
+				t.Fatalf("SnapshotActivity(lottery): %v", err)
+			}
+			if lottery.ActivityType != domain.ActivityTypeLottery || lottery.Name != "draw" ||
+				lottery.ParticipantCount != 2 || lottery.WithdrawnCount != 1 || lottery.UniqueUsers != 1 ||
+				lottery.PrizeQuantity != 3 || lottery.PrizeRemaining != 2 || lottery.SnapshotAt == 0 {
+				t.Errorf("lottery snapshot = %+v", lottery)
+			}
+
+			// 创建秒杀活动后 ID 1 同时存在于两张表中，ID 2 只属于秒杀活动
+			for _, eventName := range []string{"event-1", "event"} {
+				if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: eventName, StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 5}); err != nil {
+					t.Fatalf("CreateSecondKillEvent: %v", err)
+				}
+			}
+			if _, err := d.ClaimSecondKill(ctx, 2, 9, now); err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+
+			event, err := d.SnapshotActivity(ctx, 2)
+			if err != nil {
+				t.Fatalf("SnapshotActivity(second kill): %v", err)
+			}
+			if event.ActivityType != domain.ActivityTypeSecondKill || event.Name != "event" ||
+				event.ParticipantCount != 1 || event.UniqueUsers != 1 || event.Stock != 5 || event.SoldCount != 1 {
+				t.Errorf("second kill snapshot = %+v", event)
+			}
+
+			if _, err := d.SnapshotActivity(ctx, 3); !errors.Is(err, ErrActivityNotFound) {
+				t.Errorf("missing activity err = %v, want ErrActivityNotFound", err)
+			}
+			if _, err := d.SnapshotActivity(ctx, 1); !errors.Is(err, ErrAmbiguousActivityType) {
+				t.Errorf("ambiguous activity err = %v, want ErrAmbiguousActivityType", err)
+			}
+		})
+	}
+}
+
+func TestBulkCreateLotteryDrawsIsAtomic(t *testing.T) {
+	ctx := context.Background()
+
+	draw := func(name string, start, end int64) LotteryDraw {
+		return LotteryDraw{Name: name, StartTime: start, EndTime: end, Status: domain.LotteryStatusPending}
+	}
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+			if err := d.CreateLotteryDraw(ctx, draw("taken", 100, 200)); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			exists := func(name string) bool {
+				t.Helper()
+				ok, err := d.ExistsLotteryDrawByName(ctx, name)
+				if err != nil {
+					t.Fatalf("ExistsLotteryDrawByName(%s): %v", name, err)
+				}
+				return ok
+			}
+
+			// 校验失败的条目使整批不创建
+			result, err := d.BulkCreateLotteryDraws(ctx, []LotteryDraw{draw("a", 100, 200), draw("b", 200, 100)})
+			if !errors.Is(err, ErrInvalidTimeWindow) {
+				t.Errorf("invalid window err = %v, want ErrInvalidTimeWindow", err)
+			}
+			if len(result.Succeeded) != 0 || len(result.Failed) != 1 || result.Failed[0].Index != 1 || exists("a") {
+				t.Errorf("invalid window result = %+v, want only item 1 failed and nothing created", result)
+			}
+
+			// 批次内重名同样使整批不创建
+			if _, err := d.BulkCreateLotteryDraws(ctx, []LotteryDraw{draw("a", 100, 200), draw("a", 100, 200)}); !errors.Is(err, ErrDuplicateLotteryDrawName) {
+				t.Errorf("in-batch duplicate err = %v, want ErrDuplicateLotteryDrawName", err)
+			}
+
+			// 与已有活动重名时事务回滚，批次内其他条目也不创建
+			result, err = d.BulkCreateLotteryDraws(ctx, []LotteryDraw{draw("d", 100, 200), draw("taken", 100, 200)})
+			if !errors.Is(err, ErrDuplicateLotteryDrawName) {
+				t.Errorf("existing duplicate err = %v, want ErrDuplicateLotteryDrawName", err)
+			}
+			if len(result.Succeeded) != 0 || exists("a") || exists("d") {
+				t.Errorf("existing duplicate created %v, want nothing", result.Succeeded)
+			}
+
+			result, err = d.BulkCreateLotteryDraws(ctx, []LotteryDraw{draw("e", 100, 200), draw("f", 100, 200)})
+			if err != nil || fmt.Sprint(result.Succeeded) != "[0 1]" || !exists("e") || !exists("f") {
+				t.Errorf("valid batch = (%+v, %v), want both created", result, err)
+			}
+		})
+	}
+}
+
+func TestBulkCreateLotteryDrawsBestEffort(t *testing.T) {
+	ctx := context.Background()
+
+	draw := func(name string, start, end int64) LotteryDraw {
+		return LotteryDraw{Name: name, StartTime: start, EndTime: end, Status: domain.LotteryStatusPending}
+	}
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+			if err := d.CreateLotteryDraw(ctx, draw("taken", 100, 200)); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			result, err := d.BulkCreateLotteryDrawsBestEffort(ctx, []LotteryDraw{
+				draw("a", 100, 200), draw("b", 200, 100), draw("taken", 100, 200), draw("c", 100, 200), draw("a", 100, 200),
+			})
+			if err != nil {
+				t.Fatalf("BulkCreateLotteryDrawsBestEffort: %v", err)
+			}
+			if fmt.Sprint(result.Succeeded) != "[0 3]" || len(result.Failed) != 1 || result.Failed[0].Index != 1 ||
+				len(result.Skipped) != 2 || result.Skipped[0].Index != 2 || result.Skipped[1].Index != 4 {
+				t.Errorf("result = %+v, want succeeded [0 3], failed [1], skipped [2 4]", result)
+			}
+			for _, name := range []string{"a", "c"} {
+				if ok, err := d.ExistsLotteryDrawByName(ctx, name); err != nil || !ok {
+					t.Errorf("ExistsLotteryDrawByName(%s) = (%v, %v), want created", name, ok, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExtendLotteryDraw(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, draw := range []LotteryDraw{
+				{Name: "active", StartTime: 100, EndTime: 200, Status: domain.LotteryStatusActive},
+				{Name: "pending", StartTime: 100, EndTime: 200, Status: domain.LotteryStatusPending},
+			} {
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+
+			if err := d.ExtendLotteryDraw(ctx, 1, 300); err != nil {
+				t.Fatalf("ExtendLotteryDraw: %v", err)
+			}
+			draw, err := d.GetLotteryDrawByID(ctx, 1)
+			if err != nil || draw.EndTime != 300 {
+				t.Errorf("end time after extension = (%d, %v), want 300", draw.EndTime, err)
+			}
+
+			// 只允许向后延长
+			for _, end := range []int64{300, 250} {
+				if err := d.ExtendLotteryDraw(ctx, 1, end); !errors.Is(err, ErrInvalidEndTime) {
+					t.Errorf("ExtendLotteryDraw(%d) err = %v, want ErrInvalidEndTime", end, err)
+				}
+			}
+
+			if err := d.ExtendLotteryDraw(ctx, 2, 300); !errors.Is(err, ErrLotteryDrawNotActive) {
+				t.Errorf("pending draw err = %v, want ErrLotteryDrawNotActive", err)
+			}
+			if err := d.ExtendLotteryDraw(ctx, 3, 300); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("missing draw err = %v, want gorm.ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestGlobalParticipationByDay(t *testing.T) {
+	ctx := context.Background()
+	const day0 = int64(1_699_920_000) // UTC 零点
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: day0, EndTime: day0 + 3*secondsPerDay, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: day0, EndTime: day0 + 3*secondsPerDay, Status: domain.SecondKillStatusActive, Stock: 5}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			activityID := 1
+			for i, at := range []int64{day0 + 10, day0 + 20, day0 + 2*secondsPerDay + 5} {
+				if err := d.AddParticipant(ctx, Participant{ID: fmt.Sprintf("p%d", i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: at}); err != nil {
+					t.Fatalf("AddParticipant(%d): %v", i, err)
+				}
+			}
+			// 秒杀抢购同样计入全平台统计
+			if _, err := d.ClaimSecondKill(ctx, 1, 9, day0+30); err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+
+			days, err := d.GlobalParticipationByDay(ctx, day0+5, day0+2*secondsPerDay+100)
+			if err != nil {
+				t.Fatalf("GlobalParticipationByDay: %v", err)
+			}
+			want := []DayCount{{Day: day0, Count: 3}, {Day: day0 + secondsPerDay, Count: 0}, {Day: day0 + 2*secondsPerDay, Count: 1}}
+			if fmt.Sprint(days) != fmt.Sprint(want) {
+				t.Errorf("days = %v, want %v", days, want)
+			}
+
+			if days, err := d.GlobalParticipationByDay(ctx, day0+secondsPerDay, day0); err != nil || len(days) != 0 {
+				t.Errorf("inverted range = (%v, %v), want empty", days, err)
+			}
+		})
+	}
+}
+
+func TestListStuckActiveActivities(t *testing.T) {
+	ctx := context.Background()
+	const now = int64(1_700_000_000)
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, draw := range []LotteryDraw{
+				{Name: "stuck-late", StartTime: now - 3600, EndTime: now - 10, Status: domain.LotteryStatusActive},
+				{Name: "running", StartTime: now - 3600, EndTime: now + 10, Status: domain.LotteryStatusActive},
+				{Name: "completed", StartTime: now - 3600, EndTime: now - 100, Status: domain.LotteryStatusCompleted},
+				{Name: "stuck-early", StartTime: now - 3600, EndTime: now - 100, Status: domain.LotteryStatusActive},
+			} {
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+			for _, event := range []SecondKillEvent{
+				{Name: "running", StartTime: now - 3600, EndTime: now + 10, Status: domain.SecondKillStatusActive, Stock: 1},
+				{Name: "stuck", StartTime: now - 3600, EndTime: now - 10, Status: domain.SecondKillStatusActive, Stock: 1},
+				{Name: "completed", StartTime: now - 3600, EndTime: now - 10, Status: domain.SecondKillStatusCompleted, Stock: 1},
+			} {
+				if err := d.CreateSecondKillEvent(ctx, event); err != nil {
+					t.Fatalf("CreateSecondKillEvent(%s): %v", event.Name, err)
+				}
+			}
+
+			draws, err := d.ListStuckActiveDraws(ctx, now)
+			if err != nil {
+				t.Fatalf("ListStuckActiveDraws: %v", err)
+			}
+			var drawNames []string
+			for _, draw := range draws {
+				drawNames = append(drawNames, draw.Name)
+			}
+			// 按结束时间排序，结束最早的排在前面
+			if fmt.Sprint(drawNames) != "[stuck-early stuck-late]" {
+				t.Errorf("stuck draws = %v, want [stuck-early stuck-late]", drawNames)
+			}
+
+			events, err := d.ListStuckActiveSecondKillEvents(ctx, now)
+			if err != nil {
+				t.Fatalf("ListStuckActiveSecondKillEvents: %v", err)
+			}
+			if len(events) != 1 || events[0].Name != "stuck" {
+				t.Errorf("stuck events = %+v, want only stuck", events)
+			}
+		})
+	}
+}
+
+func TestResolveActivityType(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			// 抽奖活动 1、2 和秒杀活动 1：ID 1 同时存在于两张表，ID 2 只属于抽奖活动
+			for _, name := range []string{"draw-1", "draw-2"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: 100, EndTime: 200, Status: domain.LotteryStatusPending}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event-1", StartTime: 100, EndTime: 200, Status: domain.SecondKillStatusPending, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			tests := []struct {
+				id       int
+				wantType string
+				wantErr  error
+			}{
+				{id: 1, wantErr: ErrAmbiguousActivityType},
+				{id: 2, wantType: domain.ActivityTypeLottery},
+				{id: 3, wantErr: ErrActivityNotFound},
+			}
+			for _, tt := range tests {
+				got, err := d.ResolveActivityType(ctx, tt.id)
+				if got != tt.wantType || !errors.Is(err, tt.wantErr) {
+					t.Errorf("ResolveActivityType(%d) = (%q, %v), want (%q, %v)", tt.id, got, err, tt.wantType, tt.wantErr)
+				}
+			}
+
+			// 只有秒杀活动时同一ID解析为秒杀类型
+			secondKillOnly := newDAO(t)
+			if err := secondKillOnly.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event-1", StartTime: 100, EndTime: 200, Status: domain.SecondKillStatusPending, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+			if got, err := secondKillOnly.ResolveActivityType(ctx, 1); err != nil || got != domain.ActivityTypeSecondKill {
+				t.Errorf("second-kill-only ResolveActivityType(1) = (%q, %v), want %q", got, err, domain.ActivityTypeSecondKill)
+			}
+		})
+	}
+}
+
+func TestCountActiveParticipantsKeepsWithdrawnRows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"draw", "other"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			activityID, otherID := 1, 2
+			for i, id := range []string{"a", "b", "c"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			if err := d.AddParticipant(ctx, Participant{ID: "x", LotteryID: &otherID, UserID: 1, ParticipatedAt: now}); err != nil {
+				t.Fatalf("AddParticipant(x): %v", err)
+			}
+
+			if err := d.WithdrawParticipation(ctx, "b"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			if count, err := d.CountActiveParticipants(ctx, activityID); err != nil || count != 2 {
+				t.Errorf("CountActiveParticipants = (%d, %v), want 2", count, err)
+			}
+			if count, err := d.CountActiveParticipants(ctx, otherID); err != nil || count != 1 {
+				t.Errorf("CountActiveParticipants(other) = (%d, %v), want 1", count, err)
+			}
+
+			// 退出只设置标记，记录仍保留用于审计
+			draw, err := d.GetLotteryDrawByID(ctx, activityID)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			withdrawn := map[string]bool{}
+			for _, p := range draw.Participants {
+				withdrawn[p.ID] = p.Withdrawn
+			}
+			if len(withdrawn) != 3 || !withdrawn["b"] || withdrawn["a"] || withdrawn["c"] {
+				t.Errorf("stored participants = %v, want a, b (withdrawn) and c", withdrawn)
+			}
+		})
+	}
+}
+
+func TestListUserWins(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			// 每个活动只有一名参与者，开奖结果确定
+			seed := []struct {
+				draw          LotteryDraw
+				participantID string
+				userID        int64
+				at            int64
+			}{
+				{draw: LotteryDraw{Name: "first", Prizes: []Prize{{Name: "gold", Quantity: 1, Remaining: 1, Value: 10}}}, participantID: "a", userID: 7, at: 1},
+				{draw: LotteryDraw{Name: "second"}, participantID: "b", userID: 7, at: 2},
+				{draw: LotteryDraw{Name: "third"}, participantID: "c", userID: 8, at: 2},
+			}
+			for i, s := range seed {
+				activityID := i + 1
+				s.draw.StartTime, s.draw.EndTime, s.draw.Status = 1, 2, domain.LotteryStatusActive
+				if err := d.CreateLotteryDraw(ctx, s.draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", s.draw.Name, err)
+				}
+				if err := d.AddParticipant(ctx, Participant{ID: s.participantID, LotteryID: &activityID, UserID: s.userID, ParticipatedAt: s.at}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", s.participantID, err)
+				}
+				if _, err := d.DrawWinners(ctx, activityID, 1); err != nil {
+					t.Fatalf("DrawWinners(%d): %v", activityID, err)
+				}
+			}
+
+			size, offset := int64(10), int64(0)
+			wins, err := d.ListUserWins(ctx, 7, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListUserWins: %v", err)
+			}
+			if len(wins) != 2 {
+				t.Fatalf("got %d wins, want 2: %+v", len(wins), wins)
+			}
+
+			// 按参与时间倒序，未分配奖品的中奖记录奖品名称为空
+			if w := wins[0]; w.ParticipantID != "b" || w.ActivityID != 2 || w.ActivityName != "second" || w.PrizeID != nil || w.PrizeName != "" {
+				t.Errorf("wins[0] = %+v, want b in second without prize", w)
+			}
+			if w := wins[1]; w.ParticipantID != "a" || w.ActivityID != 1 || w.ActivityName != "first" || w.PrizeID == nil || w.PrizeName != "gold" {
+				t.Errorf("wins[1] = %+v, want a in first with gold", w)
+			}
+
+			size = 1
+			page, err := d.ListUserWins(ctx, 7, domain.Pagination{Page: 2, Size: &size, Offset: &size})
+			if err != nil || len(page) != 1 || page[0].ParticipantID != "a" {
+				t.Errorf("second page = (%+v, %v), want [a]", page, err)
+			}
+		})
+	}
+}
+
+func TestCloneLotteryDrawCopiesPrizesIndependently(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			source := LotteryDraw{
+				Name:      "source",
+				StartTime: 1,
+				EndTime:   2,
+				Status:    domain.LotteryStatusActive,
+				Prizes:    []Prize{{Name: "gold", Quantity: 2, Remaining: 2, Value: 10}},
+			}
+			if err := d.CreateLotteryDraw(ctx, source); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			sourceID := 1
+			for i, id := range []string{"a", "b"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &sourceID, UserID: int64(i + 1), ParticipatedAt: 1}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			if _, err := d.DrawWinners(ctx, sourceID, 2); err != nil {
+				t.Fatalf("DrawWinners: %v", err)
+			}
+
+			// 已开奖的模板同样可以复制，新活动的奖品数量按总数重置
+			cloneID, err := d.CloneLotteryDraw(ctx, sourceID, "clone", 10, 20)
+			if err != nil {
+				t.Fatalf("CloneLotteryDraw: %v", err)
+			}
+
+			// 调整模板奖品不影响复制出的奖品
+			if err := d.SetPrizeRemaining(ctx, 1, 1); err != nil {
+				t.Fatalf("SetPrizeRemaining: %v", err)
+			}
+
+			snapshot, err := d.SnapshotActivity(ctx, cloneID)
+			if err != nil {
+				t.Fatalf("SnapshotActivity: %v", err)
+			}
+			if snapshot.PrizeQuantity != 2 || snapshot.PrizeRemaining != 2 || snapshot.WinnerCount != 0 {
+				t.Errorf("clone snapshot = %+v, want 2/2 prizes and no winners", snapshot)
+			}
+
+			clone, err := d.GetLotteryDrawByID(ctx, cloneID)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			if clone.Status != domain.LotteryStatusPending || len(clone.Participants) != 0 {
+				t.Errorf("clone status = %q with %d participants, want pending and none", clone.Status, len(clone.Participants))
+			}
+		})
+	}
+}
+
+func TestMarkWinners(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, id := range []string{"u1", "u2", "u3"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: now + int64(i)}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "u3"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			// 未参与的用户和已退出的用户都记为跳过
+			result, err := d.MarkWinners(ctx, activityID, []int64{2, 9, 3, 1})
+			if err != nil {
+				t.Fatalf("MarkWinners: %v", err)
+			}
+			if fmt.Sprint(result.Succeeded) != "[0 3]" || len(result.Skipped) != 2 || result.Skipped[0].Index != 1 || result.Skipped[1].Index != 2 {
+				t.Errorf("result = %+v, want succeeded [0 3] and skipped [1 2]", result)
+			}
+
+			size, offset := int64(10), int64(0)
+			winners, err := d.ListWinners(ctx, activityID, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListWinners: %v", err)
+			}
+			if got := participantIDs(winners); !equalStrings(got, []string{"u1", "u2"}) {
+				t.Errorf("winners = %v, want [u1 u2]", got)
+			}
+
+			if result, err := d.MarkWinners(ctx, activityID, nil); err != nil || len(result.Succeeded)+len(result.Skipped) != 0 {
+				t.Errorf("empty MarkWinners = (%+v, %v), want empty result", result, err)
+			}
+		})
+	}
+}
+
+func TestGetNextEligibleActivity(t *testing.T) {
+	ctx := context.Background()
+	const now = int64(1_700_000_000)
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			// joined 开放提前报名，用户 7 报名后活动回到待开始状态
+			for _, draw := range []LotteryDraw{
+				{Name: "joined", StartTime: now + 100, EndTime: now + 3600, EntryStartTime: now - 100, EntryEndTime: now + 100, Status: domain.LotteryStatusActive},
+				{Name: "gated", StartTime: now + 50, EndTime: now + 3600, Status: domain.LotteryStatusPending, MinUserLevel: 5},
+				{Name: "started", StartTime: now - 10, EndTime: now + 3600, Status: domain.LotteryStatusPending},
+				{Name: "later", StartTime: now + 300, EndTime: now + 3600, Status: domain.LotteryStatusPending},
+			} {
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+			joinedID := 1
+			if err := d.AddParticipant(ctx, Participant{ID: "early", LotteryID: &joinedID, UserID: 7, ParticipatedAt: now}); err != nil {
+				t.Fatalf("AddParticipant: %v", err)
+			}
+			if err := d.UpdateLotteryDrawStatus(ctx, joinedID, domain.LotteryStatusPending); err != nil {
+				t.Fatalf("UpdateLotteryDrawStatus: %v", err)
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "flash", StartTime: now + 200, EndTime: now + 3600, Status: domain.SecondKillStatusPending, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			tests := []struct {
+				name      string
+				userID    int64
+				userLevel int
+				now       int64
+				wantType  string
+				wantName  string
+				wantErr   error
+			}{
+				{name: "skips joined and gated", userID: 7, userLevel: 1, now: now, wantType: domain.ActivityTypeSecondKill, wantName: "flash"},
+				{name: "level unlocks gated", userID: 7, userLevel: 5, now: now, wantType: domain.ActivityTypeLottery, wantName: "gated"},
+				{name: "other user", userID: 8, userLevel: 1, now: now, wantType: domain.ActivityTypeLottery, wantName: "joined"},
+				{name: "nothing upcoming", userID: 7, userLevel: 5, now: now + 1000, wantErr: ErrNoUpcomingActivity},
+			}
+			for _, tt := range tests {
+				got, err := d.GetNextEligibleActivity(ctx, tt.userID, tt.userLevel, tt.now)
+				if !errors.Is(err, tt.wantErr) || got.Type != tt.wantType || got.Name != tt.wantName {
+					t.Errorf("%s: GetNextEligibleActivity = (%s %q, %v), want (%s %q, %v)", tt.name, got.Type, got.Name, err, tt.wantType, tt.wantName, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestCountSecondKillOutcomes(t *testing.T) {
+	ctx := context.Background()
+	const now = int64(1_700_000_000)
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			events := []struct {
+				event    SecondKillEvent
+				complete bool
+			}{
+				{event: SecondKillEvent{Name: "sold-out", EndTime: now + 100, Stock: 1}, complete: true},
+				{event: SecondKillEvent{Name: "leftover", EndTime: now + 200, Stock: 2}, complete: true},
+				{event: SecondKillEvent{Name: "out-of-range", EndTime: now + 10_000, Stock: 1}, complete: true},
+				{event: SecondKillEvent{Name: "still-active", EndTime: now + 300, Stock: 1}},
+			}
+			for i, e := range events {
+				id := i + 1
+				e.event.StartTime, e.event.Status = now-60, domain.SecondKillStatusActive
+				if err := d.CreateSecondKillEvent(ctx, e.event); err != nil {
+					t.Fatalf("CreateSecondKillEvent(%s): %v", e.event.Name, err)
+				}
+				if _, err := d.ClaimSecondKill(ctx, id, 7, now); err != nil {
+					t.Fatalf("ClaimSecondKill(%s): %v", e.event.Name, err)
+				}
+				if e.complete {
+					if err := d.UpdateSecondKillEventStatus(ctx, id, domain.SecondKillStatusCompleted); err != nil {
+						t.Fatalf("UpdateSecondKillEventStatus(%s): %v", e.event.Name, err)
+					}
+				}
+			}
+
+			soldOut, leftover, err := d.CountSecondKillOutcomes(ctx, now, now+1000)
+			if err != nil || soldOut != 1 || leftover != 1 {
+				t.Errorf("CountSecondKillOutcomes = (%d, %d, %v), want (1, 1)", soldOut, leftover, err)
+			}
+
+			if soldOut, leftover, err := d.CountSecondKillOutcomes(ctx, now+20_000, now+30_000); err != nil || soldOut != 0 || leftover != 0 {
+				t.Errorf("empty range = (%d, %d, %v), want (0, 0)", soldOut, leftover, err)
+			}
+		})
+	}
+}
+
+func TestExpireStaleReservations(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"first", "second"} {
+				if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: name, StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 3}); err != nil {
+					t.Fatalf("CreateSecondKillEvent(%s): %v", name, err)
+				}
+			}
+
+			reserve := func(eventID int, userID, expiresAt int64) SecondKillReservation {
+				t.Helper()
+				r, err := d.ReserveSecondKill(ctx, eventID, userID, expiresAt)
+				if err != nil {
+					t.Fatalf("ReserveSecondKill(%d, %d): %v", eventID, userID, err)
+				}
+				return r
+			}
+
+			stale := reserve(1, 1, now+10)
+			reserve(1, 2, now+1000)
+			confirmed := reserve(1, 3, now+20)
+			reserve(2, 1, now+30)
+			if _, err := d.ConfirmSecondKillReservation(ctx, confirmed.ID, now+5); err != nil {
+				t.Fatalf("ConfirmSecondKillReservation: %v", err)
+			}
+
+			// 已确认和未过期的预留不回收，两个活动的过期预留都归还库存
+			reclaimed, err := d.ExpireStaleReservations(ctx, now+100)
+			if err != nil || reclaimed != 2 {
+				t.Fatalf("ExpireStaleReservations = (%d, %v), want 2", reclaimed, err)
+			}
+			for id, wantSold := range map[int]int{1: 2, 2: 0} {
+				event, err := d.GetSecondKillEventByID(ctx, id)
+				if err != nil || event.SoldCount != wantSold {
+					t.Errorf("event %d sold = (%d, %v), want %d", id, event.SoldCount, err, wantSold)
+				}
+			}
+
+			if _, err := d.ConfirmSecondKillReservation(ctx, stale.ID, now+5); !errors.Is(err, ErrReservationUnavailable) {
+				t.Errorf("confirm expired reservation err = %v, want ErrReservationUnavailable", err)
+			}
+
+			if reclaimed, err := d.ExpireStaleReservations(ctx, now+100); err != nil || reclaimed != 0 {
+				t.Errorf("repeated ExpireStaleReservations = (%d, %v), want 0", reclaimed, err)
+			}
+		})
+	}
+}
+
+func TestImageURLValidationAndListing(t *testing.T) {
+	ctx := context.Background()
+
+	for _, raw := range []string{"", "http://example.com/a.png", "https://cdn.example.com/banner.jpg?v=2"} {
+		if err := validateImageURL(raw); err != nil {
+			t.Errorf("validateImageURL(%q) = %v, want nil", raw, err)
+		}
+	}
+	for _, raw := range []string{"ftp://example.com/a.png", "/relative.png", "https://", "javascript:alert(1)", "http://%zz"} {
+		if err := validateImageURL(raw); !errors.Is(err, ErrInvalidImageURL) {
+			t.Errorf("validateImageURL(%q) = %v, want ErrInvalidImageURL", raw, err)
+		}
+	}
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			const drawImage, eventImage = "https://example.com/draw.png", "https://example.com/event.png"
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: 100, EndTime: 200, Status: domain.LotteryStatusPending, ImageURL: drawImage}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: 100, EndTime: 200, Status: domain.SecondKillStatusPending, Stock: 1, ImageURL: eventImage}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			size, offset := int64(10), int64(0)
+			pagination := domain.Pagination{Page: 1, Size: &size, Offset: &offset}
+
+			draws, err := d.ListLotteryDraws(ctx, "", pagination)
+			if err != nil || len(draws) != 1 || draws[0].ImageURL != drawImage {
+				t.Errorf("ListLotteryDraws = (%+v, %v), want image %q", draws, err, drawImage)
+			}
+			events, err := d.ListSecondKillEvents(ctx, "", pagination)
+			if err != nil || len(events) != 1 || events[0].ImageURL != eventImage {
+				t.Errorf("ListSecondKillEvents = (%+v, %v), want image %q", events, err, eventImage)
+			}
+			if event, err := d.GetSecondKillEventByID(ctx, 1); err != nil || event.ImageURL != eventImage {
+				t.Errorf("GetSecondKillEventByID image = (%q, %v), want %q", event.ImageURL, err, eventImage)
+			}
+		})
+	}
+}
+
+func TestGetSecondKillFunnel(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"event", "other"} {
+				if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: name, StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 10}); err != nil {
+					t.Fatalf("CreateSecondKillEvent(%s): %v", name, err)
+				}
+			}
+
+			// 活动 1：四次预留，其中一次确认；另有一次直接抢购也计入购买
+			var reservations []SecondKillReservation
+			for userID := int64(1); userID <= 4; userID++ {
+				r, err := d.ReserveSecondKill(ctx, 1, userID, now+600)
+				if err != nil {
+					t.Fatalf("ReserveSecondKill(%d): %v", userID, err)
+				}
+				reservations = append(reservations, r)
+			}
+			if _, err := d.ConfirmSecondKillReservation(ctx, reservations[0].ID, now); err != nil {
+				t.Fatalf("ConfirmSecondKillReservation: %v", err)
+			}
+			if _, err := d.ClaimSecondKill(ctx, 1, 5, now); err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+			if _, err := d.ReserveSecondKill(ctx, 2, 1, now+600); err != nil {
+				t.Fatalf("ReserveSecondKill(other): %v", err)
+			}
+
+			stats, err := d.GetSecondKillFunnel(ctx, 1, 40)
+			if err != nil {
+				t.Fatalf("GetSecondKillFunnel: %v", err)
+			}
+			want := FunnelStats{Views: 40, Reservations: 4, Confirmations: 1, Purchases: 2, ReservationToConfirmation: 0.25}
+			if stats != want {
+				t.Errorf("funnel = %+v, want %+v", stats, want)
+			}
+
+			// 没有预留时转化率为 0，不做除零
+			if stats, err := d.GetSecondKillFunnel(ctx, 3, 0); err != nil || stats != (FunnelStats{}) {
+				t.Errorf("empty funnel = (%+v, %v), want zero value", stats, err)
+			}
+		})
+	}
+}
+
+func TestIterateParticipants(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"draw", "other"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			// 参与时间相同的记录按ID排序，批次边界落在相同时间的记录之间时不能遗漏或重复
+			activityID, otherID := 1, 2
+			for i, p := range []struct {
+				id string
+				at int64
+			}{{"e", 1}, {"b", 1}, {"d", 2}, {"a", 1}, {"c", 2}} {
+				if err := d.AddParticipant(ctx, Participant{ID: p.id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: p.at}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", p.id, err)
+				}
+			}
+			if err := d.AddParticipant(ctx, Participant{ID: "x", LotteryID: &otherID, UserID: 1, ParticipatedAt: 1}); err != nil {
+				t.Fatalf("AddParticipant(x): %v", err)
+			}
+
+			var batches [][]string
+			collect := func(batch []Participant) error {
+				batches = append(batches, participantIDs(batch))
+				return nil
+			}
+
+			if err := d.IterateParticipants(ctx, activityID, 2, collect); err != nil {
+				t.Fatalf("IterateParticipants: %v", err)
+			}
+			if want := "[[a b] [e c] [d]]"; fmt.Sprint(batches) != want {
+				t.Errorf("batches = %v, want %s", batches, want)
+			}
+
+			batches = nil
+			if err := d.IterateParticipants(ctx, activityID, 0, collect); err != nil || fmt.Sprint(batches) != "[[a b e c d]]" {
+				t.Errorf("default batch size = (%v, %v), want one batch of five", batches, err)
+			}
+
+			errStop := errors.New("stop")
+			calls := 0
+			err := d.IterateParticipants(ctx, activityID, 2, func([]Participant) error {
+				calls++
+				return errStop
+			})
+			if !errors.Is(err, errStop) || calls != 1 {
+				t.Errorf("stopping iteration = (%v, %d calls), want errStop after 1 call", err, calls)
+			}
+		})
+	}
+}
+
+func TestParticipationByHourOfDay(t *testing.T) {
+	ctx := context.Background()
+	const day0 = int64(1_699_920_000) // UTC 零点
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"draw", "other"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: day0, EndTime: day0 + 2*secondsPerDay, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			// 不同日期的同一小时合并统计
+			activityID, otherID := 1, 2
+			for i, at := range []int64{day0 + 10, day0 + 3*3600 + 5, day0 + secondsPerDay + 3*3600 + 100, day0 + secondsPerDay + 23*3600} {
+				if err := d.AddParticipant(ctx, Participant{ID: fmt.Sprintf("p%d", i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: at}); err != nil {
+					t.Fatalf("AddParticipant(%d): %v", i, err)
+				}
+			}
+			if err := d.AddParticipant(ctx, Participant{ID: "x", LotteryID: &otherID, UserID: 1, ParticipatedAt: day0 + 5*3600}); err != nil {
+				t.Fatalf("AddParticipant(x): %v", err)
+			}
+
+			hours, err := d.ParticipationByHourOfDay(ctx, activityID)
+			if err != nil {
+				t.Fatalf("ParticipationByHourOfDay: %v", err)
+			}
+			var want [24]int64
+			want[0], want[3], want[23] = 1, 2, 1
+			if hours != want {
+				t.Errorf("hours = %v, want %v", hours, want)
+			}
+		})
+	}
+}
+
+func TestGetTotalAwardedValue(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draw := LotteryDraw{
+				Name:      "draw",
+				StartTime: 1,
+				EndTime:   2,
+				Status:    domain.LotteryStatusActive,
+				Prizes: []Prize{
+					{Name: "gold", Quantity: 1, Remaining: 1, Value: 100},
+					{Name: "silver", Quantity: 2, Remaining: 2, Value: 30},
+				},
+			}
+			if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i := 0; i < 4; i++ {
+				if err := d.AddParticipant(ctx, Participant{ID: fmt.Sprintf("p%d", i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: 1}); err != nil {
+					t.Fatalf("AddParticipant(%d): %v", i, err)
+				}
+			}
+
+			if total, err := d.GetTotalAwardedValue(ctx, activityID); err != nil || total != 0 {
+				t.Errorf("total before draw = (%d, %v), want 0", total, err)
+			}
+
+			// 四名中奖者只有三份奖品，未分配奖品的中奖者不计入总价值
+			if _, err := d.DrawWinners(ctx, activityID, 4); err != nil {
+				t.Fatalf("DrawWinners: %v", err)
+			}
+			if total, err := d.GetTotalAwardedValue(ctx, activityID); err != nil || total != 160 {
+				t.Errorf("total after draw = (%d, %v), want 160", total, err)
+			}
+
+			if total, err := d.GetTotalAwardedValue(ctx, 2); err != nil || total != 0 {
+				t.Errorf("total for missing activity = (%d, %v), want 0", total, err)
+			}
+		})
+	}
+}
+
+func TestListLotteryDrawsModifiedSince(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			before := time.Now().Unix() - 1
+			for _, drawName := range []string{"first", "second"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: drawName, StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", drawName, err)
+				}
+			}
+
+			size, offset := int64(1), int64(0)
+			page, err := d.ListLotteryDrawsModifiedSince(ctx, before, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListLotteryDrawsModifiedSince: %v", err)
+			}
+			if len(page) != 1 || page[0].Name != "first" {
+				t.Fatalf("first page = %+v, want [first]", page)
+			}
+
+			offset = 1
+			page, err = d.ListLotteryDrawsModifiedSince(ctx, before, domain.Pagination{Page: 2, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListLotteryDrawsModifiedSince: %v", err)
+			}
+			if len(page) != 1 || page[0].Name != "second" {
+				t.Fatalf("second page = %+v, want [second]", page)
+			}
+
+			size, offset = 10, 0
+			page, err = d.ListLotteryDrawsModifiedSince(ctx, time.Now().Unix()+60, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListLotteryDrawsModifiedSince: %v", err)
+			}
+			if len(page) != 0 {
+				t.Errorf("future since returned %d draws, want none", len(page))
+			}
+		})
+	}
+}
+
+func TestSwapWinner(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draw := LotteryDraw{
+				Name:      "draw",
+				StartTime: now - 60,
+				EndTime:   now + 3600,
+				Status:    domain.LotteryStatusActive,
+				Prizes:    []Prize{{Name: "gold", Quantity: 1, Remaining: 1, Value: 100}},
+			}
+			if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, id := range []string{"a", "b", "c"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "c"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			winners, err := d.DrawWinners(ctx, activityID, 1)
+			if err != nil || len(winners) != 1 {
+				t.Fatalf("DrawWinners = (%v, %v), want one winner", winners, err)
+			}
+			winner, loser := winners[0].ID, "a"
+			if winner == "a" {
+				loser = "b"
+			}
+			prizeID := winners[0].PrizeID
+			if prizeID == nil {
+				t.Fatalf("winner %s has no prize", winner)
+			}
+
+			if err := d.SwapWinner(ctx, activityID, loser, winner); !errors.Is(err, ErrParticipantNotWinner) {
+				t.Errorf("SwapWinner from non-winner err = %v, want ErrParticipantNotWinner", err)
+			}
+			if err := d.SwapWinner(ctx, activityID, winner, "c"); !errors.Is(err, ErrInvalidReplacementWinner) {
+				t.Errorf("SwapWinner to withdrawn err = %v, want ErrInvalidReplacementWinner", err)
+			}
+			if err := d.SwapWinner(ctx, activityID, winner, winner); !errors.Is(err, ErrInvalidReplacementWinner) {
+				t.Errorf("SwapWinner to existing winner err = %v, want ErrInvalidReplacementWinner", err)
+			}
+			if err := d.SwapWinner(ctx, 2, winner, loser); !errors.Is(err, ErrParticipantNotWinner) {
+				t.Errorf("SwapWinner on other activity err = %v, want ErrParticipantNotWinner", err)
+			}
+
+			if err := d.SwapWinner(ctx, activityID, winner, loser); err != nil {
+				t.Fatalf("SwapWinner: %v", err)
+			}
+
+			// 奖品随中奖资格一起转给替补者
+			size, offset := int64(10), int64(0)
+			got, err := d.ListWinners(ctx, activityID, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListWinners: %v", err)
+			}
+			if len(got) != 1 || got[0].ID != loser {
+				t.Fatalf("winners after swap = %v, want [%s]", participantIDs(got), loser)
+			}
+			if got[0].PrizeID == nil || *got[0].PrizeID != *prizeID {
+				t.Errorf("replacement prize = %v, want %d", got[0].PrizeID, *prizeID)
+			}
+		})
+	}
+}
+
+func TestTopParticipantsByEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"draw", "other"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			activityID, otherID := 1, 2
+			entries := []struct {
+				id       string
+				activity *int
+				userID   int64
+			}{
+				{"a1", &activityID, 3},
+				{"a2", &activityID, 3},
+				{"b1", &activityID, 2},
+				{"b2", &activityID, 2},
+				{"c1", &activityID, 1},
+				{"d1", &activityID, 4},
+				{"d2", &activityID, 4},
+				{"d3", &activityID, 4},
+				{"x1", &otherID, 1},
+				{"x2", &otherID, 1},
+				{"x3", &otherID, 1},
+			}
+			for _, e := range entries {
+				if err := d.AddParticipant(ctx, Participant{ID: e.id, LotteryID: e.activity, UserID: e.userID, ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", e.id, err)
+				}
+			}
+			// 退出的参与记录不计入次数
+			for _, id := range []string{"d2", "d3"} {
+				if err := d.WithdrawParticipation(ctx, id); err != nil {
+					t.Fatalf("WithdrawParticipation(%s): %v", id, err)
+				}
+			}
+
+			got, err := d.TopParticipantsByEntries(ctx, activityID, 3)
+			if err != nil {
+				t.Fatalf("TopParticipantsByEntries: %v", err)
+			}
+			want := []UserEntryCount{{UserID: 2, Entries: 2}, {UserID: 3, Entries: 2}, {UserID: 1, Entries: 1}}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("TopParticipantsByEntries = %+v, want %+v", got, want)
+			}
+
+			if got, err := d.TopParticipantsByEntries(ctx, activityID, 0); err != nil || len(got) != 0 {
+				t.Errorf("TopParticipantsByEntries(topN=0) = (%+v, %v), want empty", got, err)
+			}
+		})
+	}
+}
+
+func TestWithPoolConfigAppliesToSQLDB(t *testing.T) {
+	d, db := newTestLotteryDrawDAO(t, WithPoolConfig(PoolConfig{MaxOpenConns: 5, MaxIdleConns: 2, ConnMaxLifetime: time.Minute}))
+	if d.pool == nil {
+		t.Fatal("pool config not recorded on DAO")
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+	if got := sqlDB.Stats().MaxOpenConnections; got != 5 {
+		t.Errorf("MaxOpenConnections = %d, want 5", got)
+	}
+
+	// 零值字段保持 sql.DB 原有设置
+	NewLotteryDrawDAO(db, zap.NewNop(), WithPoolConfig(PoolConfig{MaxIdleConns: 1}))
+	if got := sqlDB.Stats().MaxOpenConnections; got != 5 {
+		t.Errorf("MaxOpenConnections after zero-valued config = %d, want 5", got)
+	}
+}
+
+func TestGetLotteryDrawsByNames(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, drawName := range []string{"alpha", "beta", "alpha"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: drawName, StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", drawName, err)
+				}
+			}
+
+			got, err := d.GetLotteryDrawsByNames(ctx, []string{"alpha", "beta", "missing"})
+			if err != nil {
+				t.Fatalf("GetLotteryDrawsByNames: %v", err)
+			}
+			if len(got) != 2 {
+				t.Fatalf("GetLotteryDrawsByNames returned %d draws, want 2", len(got))
+			}
+			// 名称重复时保留ID最小的活动
+			if got["alpha"].ID != 1 || got["beta"].ID != 2 {
+				t.Errorf("ids = alpha:%d beta:%d, want alpha:1 beta:2", got["alpha"].ID, got["beta"].ID)
+			}
+			if _, ok := got["missing"]; ok {
+				t.Error("missing name present in result")
+			}
+
+			if got, err := d.GetLotteryDrawsByNames(ctx, nil); err != nil || len(got) != 0 {
+				t.Errorf("GetLotteryDrawsByNames(nil) = (%v, %v), want empty", got, err)
+			}
+		})
+	}
+}
+
+func TestGetPrizeWinnerCounts(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draw := LotteryDraw{
+				Name:      "draw",
+				StartTime: 1,
+				EndTime:   2,
+				Status:    domain.LotteryStatusActive,
+				Prizes: []Prize{
+					{Name: "gold", Quantity: 1, Remaining: 1, Value: 100},
+					{Name: "silver", Quantity: 2, Remaining: 2, Value: 30},
+				},
+			}
+			if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i := 0; i < 5; i++ {
+				if err := d.AddParticipant(ctx, Participant{ID: fmt.Sprintf("p%d", i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: 1}); err != nil {
+					t.Fatalf("AddParticipant(%d): %v", i, err)
+				}
+			}
+
+			if counts, err := d.GetPrizeWinnerCounts(ctx, activityID); err != nil || len(counts) != 0 {
+				t.Fatalf("counts before draw = (%v, %v), want empty", counts, err)
+			}
+
+			// 中奖人数超过奖品数量时，多出的中奖者没有奖品，不计入统计
+			winners, err := d.DrawWinners(ctx, activityID, 4)
+			if err != nil {
+				t.Fatalf("DrawWinners: %v", err)
+			}
+			want := map[int]int64{}
+			for _, w := range winners {
+				if w.PrizeID != nil {
+					want[*w.PrizeID]++
+				}
+			}
+			if len(want) != 2 {
+				t.Fatalf("winners cover %d prizes, want 2", len(want))
+			}
+
+			counts, err := d.GetPrizeWinnerCounts(ctx, activityID)
+			if err != nil {
+				t.Fatalf("GetPrizeWinnerCounts: %v", err)
+			}
+			if !reflect.DeepEqual(counts, want) {
+				t.Errorf("GetPrizeWinnerCounts = %v, want %v", counts, want)
+			}
+			var total int64
+			for _, c := range counts {
+				total += c
+			}
+			if total != 3 {
+				t.Errorf("total prize winners = %d, want 3", total)
+			}
+		})
+	}
+}
+
+func TestFilterUserJoinedActivities(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for i := 0; i < 4; i++ {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: fmt.Sprintf("draw%d", i+1), StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%d): %v", i+1, err)
+				}
+			}
+
+			join := func(id string, activityID int, userID int64) {
+				t.Helper()
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: userID, ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			join("a", 3, 1)
+			join("b", 1, 1)
+			join("c", 1, 1)
+			join("d", 2, 1)
+			join("e", 4, 2)
+			if err := d.WithdrawParticipation(ctx, "d"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			got, err := d.FilterUserJoinedActivities(ctx, 1, []int{4, 3, 2, 1, 99})
+			if err != nil {
+				t.Fatalf("FilterUserJoinedActivities: %v", err)
+			}
+			if want := []int{1, 3}; !reflect.DeepEqual(got, want) {
+				t.Errorf("FilterUserJoinedActivities = %v, want %v", got, want)
+			}
+
+			if got, err := d.FilterUserJoinedActivities(ctx, 1, nil); err != nil || len(got) != 0 {
+				t.Errorf("FilterUserJoinedActivities(nil) = (%v, %v), want empty", got, err)
+			}
+		})
+	}
+}
+
+func TestSetPrizeRemaining(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draw := LotteryDraw{
+				Name:      "draw",
+				StartTime: 1,
+				EndTime:   2,
+				Status:    domain.LotteryStatusActive,
+				Prizes: []Prize{
+					{Name: "gold", Quantity: 3, Remaining: 3, Value: 10},
+					{Name: "silver", Quantity: 2, Remaining: 2, Value: 5},
+				},
+			}
+			if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			if err := d.SetPrizeRemaining(ctx, 1, -1); !errors.Is(err, ErrInvalidPrizeRemaining) {
+				t.Errorf("SetPrizeRemaining(-1) err = %v, want ErrInvalidPrizeRemaining", err)
+			}
+			if err := d.SetPrizeRemaining(ctx, 1, 4); !errors.Is(err, ErrInvalidPrizeRemaining) {
+				t.Errorf("SetPrizeRemaining above quantity err = %v, want ErrInvalidPrizeRemaining", err)
+			}
+			if err := d.SetPrizeRemaining(ctx, 99, 0); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("SetPrizeRemaining on missing prize err = %v, want ErrRecordNotFound", err)
+			}
+
+			if err := d.SetPrizeRemaining(ctx, 1, 0); err != nil {
+				t.Fatalf("SetPrizeRemaining(0): %v", err)
+			}
+			snapshot, err := d.SnapshotActivity(ctx, 1)
+			if err != nil {
+				t.Fatalf("SnapshotActivity: %v", err)
+			}
+			if snapshot.PrizeQuantity != 5 || snapshot.PrizeRemaining != 2 {
+				t.Errorf("snapshot prizes = %d/%d, want 2/5 remaining", snapshot.PrizeRemaining, snapshot.PrizeQuantity)
+			}
+
+			// 上限为奖品总数，可以恢复到满额
+			if err := d.SetPrizeRemaining(ctx, 1, 3); err != nil {
+				t.Fatalf("SetPrizeRemaining(3): %v", err)
+			}
+			if snapshot, err := d.SnapshotActivity(ctx, 1); err != nil || snapshot.PrizeRemaining != 5 {
+				t.Errorf("PrizeRemaining after restore = (%d, %v), want 5", snapshot.PrizeRemaining, err)
+			}
+		})
+	}
+}
+
+func TestAddParticipantEnforcesEntryWindow(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draws := []LotteryDraw{
+				{Name: "windowed", StartTime: 100, EndTime: 200, EntryStartTime: 80, EntryEndTime: 150, Status: domain.LotteryStatusActive},
+				{Name: "default", StartTime: 100, EndTime: 200, Status: domain.LotteryStatusActive},
+			}
+			for _, draw := range draws {
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+
+			cases := []struct {
+				activityID int
+				at         int64
+				wantErr    error
+			}{
+				{1, 79, ErrEntryWindowClosed},
+				{1, 80, nil},
+				{1, 150, nil},
+				// 展示时间内但报名已截止
+				{1, 151, ErrEntryWindowClosed},
+				// 未设置报名时间时沿用展示时间
+				{2, 99, ErrEntryWindowClosed},
+				{2, 100, nil},
+				{2, 200, nil},
+				{2, 201, ErrEntryWindowClosed},
+			}
+			for i, c := range cases {
+				activityID := c.activityID
+				p := Participant{ID: fmt.Sprintf("p%d", i), LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: c.at}
+				if err := d.AddParticipant(ctx, p); !errors.Is(err, c.wantErr) {
+					t.Errorf("AddParticipant(activity %d at %d) err = %v, want %v", c.activityID, c.at, err, c.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestListActivitiesNeedingDraw(t *testing.T) {
+	ctx := context.Background()
+	now := int64(1000)
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draws := []LotteryDraw{
+				{Name: "overdue", StartTime: 50, EndTime: 500, Status: domain.LotteryStatusActive},
+				{Name: "oldest", StartTime: 50, EndTime: 300, Status: domain.LotteryStatusActive},
+				{Name: "completed", StartTime: 50, EndTime: 200, Status: domain.LotteryStatusCompleted},
+				{Name: "cancelled", StartTime: 50, EndTime: 200, Status: domain.LotteryStatusCancelled},
+				{Name: "running", StartTime: 50, EndTime: 2000, Status: domain.LotteryStatusActive},
+				{Name: "ending now", StartTime: 50, EndTime: now, Status: domain.LotteryStatusActive},
+			}
+			for _, draw := range draws {
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+
+			overdueID := 1
+			for i, id := range []string{"a", "b"} {
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &overdueID, UserID: int64(i + 1), ParticipatedAt: 100}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+			// 部分中奖但未完成的活动仍在待开奖队列中
+			if _, err := d.MarkWinners(ctx, overdueID, []int64{1}); err != nil {
+				t.Fatalf("MarkWinners: %v", err)
+			}
+
+			size, offset := int64(10), int64(0)
+			got, err := d.ListActivitiesNeedingDraw(ctx, now, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListActivitiesNeedingDraw: %v", err)
+			}
+			want := []LotteryDrawSummary{
+				{ID: 2, Name: "oldest", StartTime: 50, EndTime: 300, Status: domain.LotteryStatusActive},
+				{ID: 1, Name: "overdue", StartTime: 50, EndTime: 500, Status: domain.LotteryStatusActive, ParticipantCount: 2, HasWinners: true},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ListActivitiesNeedingDraw = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFilterJoinedForFeed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for i := 0; i < 3; i++ {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: fmt.Sprintf("draw%d", i+1), StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%d): %v", i+1, err)
+				}
+			}
+
+			for i, activityID := range []int{1, 2, 3} {
+				activityID := activityID
+				if err := d.AddParticipant(ctx, Participant{ID: fmt.Sprintf("p%d", i), LotteryID: &activityID, UserID: 1, ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%d): %v", activityID, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "p1"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			// 活动ID超过单批数量，已参与的活动分布在不同批次中
+			ids := make([]int, 0, 2*feedIDChunkSize)
+			for i := 0; i < 2*feedIDChunkSize; i++ {
+				ids = append(ids, 1000+i)
+			}
+			ids[0], ids[feedIDChunkSize+1], ids[len(ids)-1] = 1, 2, 3
+
+			got, err := d.FilterJoinedForFeed(ctx, 1, ids)
+			if err != nil {
+				t.Fatalf("FilterJoinedForFeed: %v", err)
+			}
+			if len(got) != len(ids) {
+				t.Fatalf("FilterJoinedForFeed returned %d entries, want %d", len(got), len(ids))
+			}
+			for _, id := range ids {
+				want := id == 1 || id == 3
+				if joined, ok := got[id]; !ok || joined != want {
+					t.Errorf("joined[%d] = (%v, %v), want %v", id, joined, ok, want)
+				}
+			}
+
+			if got, err := d.FilterJoinedForFeed(ctx, 2, []int{1, 3}); err != nil || got[1] || got[3] || len(got) != 2 {
+				t.Errorf("FilterJoinedForFeed(other user) = (%v, %v), want all false", got, err)
+			}
+		})
+	}
+}
+
+func TestGetLotteryDrawsByIDsOrdered(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for i := 0; i < 4; i++ {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: fmt.Sprintf("draw%d", i+1), StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%d): %v", i+1, err)
+				}
+			}
+
+			// 保持输入顺序，忽略不存在的ID，重复ID只保留第一次出现的位置
+			got, err := d.GetLotteryDrawsByIDsOrdered(ctx, []int{3, 99, 1, 3, 4})
+			if err != nil {
+				t.Fatalf("GetLotteryDrawsByIDsOrdered: %v", err)
+			}
+			var ids []int
+			for _, draw := range got {
+				ids = append(ids, draw.ID)
+			}
+			if want := []int{3, 1, 4}; !reflect.DeepEqual(ids, want) {
+				t.Errorf("ids = %v, want %v", ids, want)
+			}
+			if len(got) > 0 && got[0].Name != "draw3" {
+				t.Errorf("first draw name = %q, want draw3", got[0].Name)
+			}
+
+			if got, err := d.GetLotteryDrawsByIDsOrdered(ctx, nil); err != nil || len(got) != 0 {
+				t.Errorf("GetLotteryDrawsByIDsOrdered(nil) = (%v, %v), want empty", got, err)
+			}
+		})
+	}
+}
+
+func TestCountLateJoiners(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 1000, EndTime: now + 100, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+
+			activityID := 1
+			for i, p := range []struct {
+				id string
+				at int64
+			}{{"early", now - 900}, {"edge", now - 100}, {"late", now}, {"gone", now}} {
+				if err := d.AddParticipant(ctx, Participant{ID: p.id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: p.at}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", p.id, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "gone"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			// 窗口为 [EndTime-200, EndTime]，边界上的参与记录计入，已退出的不计入
+			if count, err := d.CountLateJoiners(ctx, activityID, 200); err != nil || count != 2 {
+				t.Errorf("CountLateJoiners(200) = (%d, %v), want 2", count, err)
+			}
+			if count, err := d.CountLateJoiners(ctx, activityID, 2000); err != nil || count != 3 {
+				t.Errorf("CountLateJoiners(2000) = (%d, %v), want 3", count, err)
+			}
+			if count, err := d.CountLateJoiners(ctx, activityID, 0); err != nil || count != 0 {
+				t.Errorf("CountLateJoiners(0) = (%d, %v), want 0", count, err)
+			}
+			if _, err := d.CountLateJoiners(ctx, 99, 200); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("CountLateJoiners on missing activity err = %v, want ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestIterateLotteryDraws(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			statuses := []string{
+				domain.LotteryStatusActive,
+				domain.LotteryStatusPending,
+				domain.LotteryStatusActive,
+				domain.LotteryStatusActive,
+				domain.LotteryStatusCompleted,
+			}
+			for i, status := range statuses {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: fmt.Sprintf("draw%d", i+1), StartTime: 1, EndTime: 2, Status: status}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%d): %v", i+1, err)
+				}
+			}
+
+			var ids []int
+			collect := func(draw LotteryDraw) error {
+				ids = append(ids, draw.ID)
+				return nil
+			}
+
+			// 批大小整除结果数时也要正确结束
+			if err := d.IterateLotteryDraws(ctx, " Active ", 3, collect); err != nil {
+				t.Fatalf("IterateLotteryDraws(active): %v", err)
+			}
+			if want := []int{1, 3, 4}; !reflect.DeepEqual(ids, want) {
+				t.Errorf("active ids = %v, want %v", ids, want)
+			}
+
+			ids = nil
+			if err := d.IterateLotteryDraws(ctx, "", 2, collect); err != nil {
+				t.Fatalf("IterateLotteryDraws(all): %v", err)
+			}
+			if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(ids, want) {
+				t.Errorf("all ids = %v, want %v", ids, want)
+			}
+
+			if err := d.IterateLotteryDraws(ctx, "unknown", 2, collect); !errors.Is(err, ErrInvalidStatus) {
+				t.Errorf("IterateLotteryDraws(unknown) err = %v, want ErrInvalidStatus", err)
+			}
+
+			errStop := errors.New("stop")
+			calls := 0
+			err := d.IterateLotteryDraws(ctx, "", 2, func(LotteryDraw) error {
+				calls++
+				return errStop
+			})
+			if !errors.Is(err, errStop) || calls != 1 {
+				t.Errorf("stopping iteration = (%v, %d calls), want errStop after 1 call", err, calls)
+			}
+		})
+	}
+}
+
+func TestGetParticipationPercentiles(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"draw", "empty"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: now - 100, EndTime: now + 100, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			activityID := 1
+			for i, p := range []struct {
+				id string
+				at int64
+			}{{"d", now - 10}, {"a", now - 40}, {"gone", now - 35}, {"c", now - 20}, {"b", now - 30}} {
+				if err := d.AddParticipant(ctx, Participant{ID: p.id, LotteryID: &activityID, UserID: int64(i + 1), ParticipatedAt: p.at}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", p.id, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "gone"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			// 四条有效记录，百分位 p 对应第 ceil(p*4) 条记录的参与时间
+			got, err := d.GetParticipationPercentiles(ctx, activityID, []float64{0.5, 0.1, 0.75, 1, 0.5})
+			if err != nil {
+				t.Fatalf("GetParticipationPercentiles: %v", err)
+			}
+			want := map[float64]int64{0.1: now - 40, 0.5: now - 30, 0.75: now - 20, 1: now - 10}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetParticipationPercentiles = %v, want %v", got, want)
+			}
+
+			if got, err := d.GetParticipationPercentiles(ctx, 2, []float64{0.5}); err != nil || len(got) != 0 {
+				t.Errorf("percentiles without participants = (%v, %v), want empty", got, err)
+			}
+			for _, p := range []float64{0, -0.5, 1.5} {
+				if _, err := d.GetParticipationPercentiles(ctx, activityID, []float64{0.5, p}); !errors.Is(err, ErrInvalidPercentile) {
+					t.Errorf("GetParticipationPercentiles(%v) err = %v, want ErrInvalidPercentile", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExistsLotteryDrawByNameUsesCache(t *testing.T) {
+	ctx := context.Background()
+	d, db := newTestLotteryDrawDAO(t, WithNameExistsCache(time.Minute))
+
+	var queries int
+	if err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries++
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if exists, err := d.ExistsLotteryDrawByName(ctx, "draw"); err != nil || exists {
+		t.Fatalf("ExistsLotteryDrawByName before create = (%v, %v), want false", exists, err)
+	}
+	if queries != 1 {
+		t.Fatalf("queries after first lookup = %d, want 1", queries)
+	}
+
+	// 缓存命中时不查询数据库，绕过 DAO 写入的数据在 ttl 内不可见
+	if err := db.Create(&LotteryDraw{Name: "draw", StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}).Error; err != nil {
+		t.Fatalf("create draw: %v", err)
+	}
+	queries = 0
+	if exists, err := d.ExistsLotteryDrawByName(ctx, "draw"); err != nil || exists {
+		t.Errorf("cached ExistsLotteryDrawByName = (%v, %v), want stale false", exists, err)
+	}
+	if queries != 0 {
+		t.Errorf("cached lookup ran %d queries, want 0", queries)
+	}
+
+	// 通过 DAO 创建活动会刷新缓存
+	if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "other", StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+		t.Fatalf("CreateLotteryDraw: %v", err)
+	}
+	queries = 0
+	if exists, err := d.ExistsLotteryDrawByName(ctx, "other"); err != nil || !exists {
+		t.Errorf("ExistsLotteryDrawByName after create = (%v, %v), want true", exists, err)
+	}
+	if queries != 0 {
+		t.Errorf("lookup after create ran %d queries, want 0", queries)
+	}
+
+	uncached, _ := newTestLotteryDrawDAO(t)
+	if uncached.nameCache != nil {
+		t.Error("name cache enabled without WithNameExistsCache")
+	}
+}
+
+func TestListCancelledForLowParticipation(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draws := []LotteryDraw{
+				{Name: "low", Status: domain.LotteryStatusCancelled, CancelReason: CancelReasonBelowMinParticipants},
+				{Name: "manual", Status: domain.LotteryStatusCancelled},
+				{Name: "merged", Status: domain.LotteryStatusCancelled, CancelReason: CancelReasonMerged},
+				{Name: "low again", Status: domain.LotteryStatusCancelled, CancelReason: CancelReasonBelowMinParticipants},
+				{Name: "reopened", Status: domain.LotteryStatusActive, CancelReason: CancelReasonBelowMinParticipants},
+			}
+			for _, draw := range draws {
+				draw.StartTime, draw.EndTime = 1, 2
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+
+			size, offset := int64(10), int64(0)
+			got, err := d.ListCancelledForLowParticipation(ctx, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+			if err != nil {
+				t.Fatalf("ListCancelledForLowParticipation: %v", err)
+			}
+			var names []string
+			for _, draw := range got {
+				names = append(names, draw.Name)
+			}
+			// 更新时间相同时按ID倒序
+			if want := []string{"low again", "low"}; !equalStrings(names, want) {
+				t.Errorf("ListCancelledForLowParticipation = %v, want %v", names, want)
+			}
+		})
+	}
+}
+
+func TestDrawWinnersCancelsBelowMinIntoLowParticipationList(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestLotteryDrawDAO(t, WithCancelBelowMinParticipants(true))
+
+	if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: 1, EndTime: 2, MinParticipants: 2, Status: domain.LotteryStatusActive}); err != nil {
+		t.Fatalf("CreateLotteryDraw: %v", err)
+	}
+	activityID := 1
+	if err := d.AddParticipant(ctx, Participant{ID: "a", LotteryID: &activityID, UserID: 1, ParticipatedAt: 1}); err != nil {
+		t.Fatalf("AddParticipant: %v", err)
+	}
+
+	// 人数不足时活动被取消，仍返回 ErrBelowMinParticipants 告知调用方
+	if _, err := d.DrawWinners(ctx, activityID, 1); !errors.Is(err, ErrBelowMinParticipants) {
+		t.Fatalf("DrawWinners err = %v, want ErrBelowMinParticipants", err)
+	}
+
+	size, offset := int64(10), int64(0)
+	got, err := d.ListCancelledForLowParticipation(ctx, domain.Pagination{Page: 1, Size: &size, Offset: &offset})
+	if err != nil {
+		t.Fatalf("ListCancelledForLowParticipation: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != activityID || len(got[0].Participants) != 1 {
+		t.Errorf("ListCancelledForLowParticipation = %+v, want the cancelled draw with its participant", got)
+	}
+}
+
+func TestGetAverageEntriesPerUser(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"draw", "other"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			if avg, err := d.GetAverageEntriesPerUser(ctx, 1); err != nil || avg != 0 {
+				t.Errorf("average without participants = (%v, %v), want 0", avg, err)
+			}
+
+			activityID, otherID := 1, 2
+			for _, e := range []struct {
+				id       string
+				activity *int
+				userID   int64
+			}{
+				{"a1", &activityID, 1},
+				{"a2", &activityID, 1},
+				{"a3", &activityID, 1},
+				{"b1", &activityID, 2},
+				{"c1", &activityID, 3},
+				{"x1", &otherID, 2},
+				{"x2", &otherID, 2},
+			} {
+				if err := d.AddParticipant(ctx, Participant{ID: e.id, LotteryID: e.activity, UserID: e.userID, ParticipatedAt: now}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", e.id, err)
+				}
+			}
+			// 用户 3 唯一的参与记录已退出，不计入参与次数和用户数
+			if err := d.WithdrawParticipation(ctx, "c1"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+
+			if avg, err := d.GetAverageEntriesPerUser(ctx, activityID); err != nil || avg != 2 {
+				t.Errorf("GetAverageEntriesPerUser = (%v, %v), want 2", avg, err)
+			}
+		})
+	}
+}
+
+func TestGetUserLastParticipation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if last, err := d.GetUserLastParticipation(ctx, 1); err != nil || last != 0 {
+				t.Errorf("last participation without entries = (%d, %v), want 0", last, err)
+			}
+
+			for _, name := range []string{"draw", "other"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: now - 600, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+
+			activityID, otherID := 1, 2
+			if err := d.AddParticipant(ctx, Participant{ID: "a", LotteryID: &activityID, UserID: 1, ParticipatedAt: now - 500}); err != nil {
+				t.Fatalf("AddParticipant(a): %v", err)
+			}
+			if err := d.AddParticipant(ctx, Participant{ID: "b", LotteryID: &otherID, UserID: 1, ParticipatedAt: now - 100}); err != nil {
+				t.Fatalf("AddParticipant(b): %v", err)
+			}
+			if err := d.AddParticipant(ctx, Participant{ID: "c", LotteryID: &activityID, UserID: 2, ParticipatedAt: now - 10}); err != nil {
+				t.Fatalf("AddParticipant(c): %v", err)
+			}
+
+			// 退出不会重置冷却时间
+			if err := d.WithdrawParticipation(ctx, "b"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+			if last, err := d.GetUserLastParticipation(ctx, 1); err != nil || last != now-100 {
+				t.Errorf("GetUserLastParticipation = (%d, %v), want %d", last, err, now-100)
+			}
+
+			// 秒杀活动的参与记录同样计入
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+			if _, err := d.ClaimSecondKill(ctx, 1, 1, now); err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+			if last, err := d.GetUserLastParticipation(ctx, 1); err != nil || last != now {
+				t.Errorf("GetUserLastParticipation after claim = (%d, %v), want %d", last, err, now)
+			}
+		})
+	}
+}
+
+func TestFindOrphanParticipants(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: 1, EndTime: 2, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: 1, EndTime: 2, Status: domain.SecondKillStatusActive, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			activityID, eventID, missingID := 1, 1, 99
+			insertStoredParticipant(t, d, Participant{ID: "lottery", LotteryID: &activityID, UserID: 1, ParticipatedAt: 1})
+			insertStoredParticipant(t, d, Participant{ID: "event", SecondKillID: &eventID, UserID: 1, ParticipatedAt: 1})
+			insertStoredParticipant(t, d, Participant{ID: "no-event", SecondKillID: &missingID, UserID: 2, ParticipatedAt: 3})
+			insertStoredParticipant(t, d, Participant{ID: "no-lottery", LotteryID: &missingID, UserID: 3, ParticipatedAt: 2})
+			insertStoredParticipant(t, d, Participant{ID: "unlinked", UserID: 4, ParticipatedAt: 2})
+
+			orphans, err := d.FindOrphanParticipants(ctx)
+			if err != nil {
+				t.Fatalf("FindOrphanParticipants: %v", err)
+			}
+			// 按参与时间和ID排序
+			if got, want := participantIDs(orphans), []string{"no-lottery", "unlinked", "no-event"}; !equalStrings(got, want) {
+				t.Errorf("FindOrphanParticipants = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestAnonymizeUserParticipations(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: "draw", StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+				t.Fatalf("CreateLotteryDraw: %v", err)
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			activityID := 1
+			for _, p := range []Participant{
+				{ID: "a", LotteryID: &activityID, UserID: 1, ParticipatedAt: now, Metadata: map[string]string{"ip": "10.0.0.1"}},
+				{ID: "b", LotteryID: &activityID, UserID: 1, ParticipatedAt: now},
+				{ID: "c", LotteryID: &activityID, UserID: 2, ParticipatedAt: now, Metadata: map[string]string{"ip": "10.0.0.2"}},
+			} {
+				if err := d.AddParticipant(ctx, p); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", p.ID, err)
+				}
+			}
+			if _, err := d.MarkWinners(ctx, activityID, []int64{1}); err != nil {
+				t.Fatalf("MarkWinners: %v", err)
+			}
+			reservation, err := d.ReserveSecondKill(ctx, 1, 1, now+600)
+			if err != nil {
+				t.Fatalf("ReserveSecondKill: %v", err)
+			}
+
+			count, err := d.AnonymizeUserParticipations(ctx, 1)
+			if err != nil || count != 2 {
+				t.Fatalf("AnonymizeUserParticipations = (%d, %v), want 2", count, err)
+			}
+
+			draw, err := d.GetLotteryDrawByID(ctx, activityID)
+			if err != nil {
+				t.Fatalf("GetLotteryDrawByID: %v", err)
+			}
+			for _, p := range draw.Participants {
+				switch p.ID {
+				case "a", "b":
+					if p.UserID != AnonymizedUserID || len(p.Metadata) != 0 {
+						t.Errorf("participant %s = user %d metadata %v, want anonymized without metadata", p.ID, p.UserID, p.Metadata)
+					}
+				case "c":
+					if p.UserID != 2 || p.Metadata["ip"] != "10.0.0.2" {
+						t.Errorf("other user's participant changed: %+v", p)
+					}
+				}
+			}
+			// 中奖标记保持不变
+			if wins, entries, err := d.GetUserWinRate(ctx, AnonymizedUserID); err != nil || wins == 0 || entries != 2 {
+				t.Errorf("anonymized win rate = (%d, %d, %v), want winners kept across 2 entries", wins, entries, err)
+			}
+
+			// 预留记录同样被匿名化，确认后生成的参与记录不再关联原用户
+			claim, err := d.ConfirmSecondKillReservation(ctx, reservation.ID, now)
+			if err != nil {
+				t.Fatalf("ConfirmSecondKillReservation: %v", err)
+			}
+			if claim.UserID != AnonymizedUserID {
+				t.Errorf("confirmed claim user = %d, want %d", claim.UserID, AnonymizedUserID)
+			}
+
+			if count, err := d.AnonymizeUserParticipations(ctx, 1); err != nil || count != 0 {
+				t.Errorf("second AnonymizeUserParticipations = (%d, %v), want 0", count, err)
+			}
+			if count, err := d.AnonymizeUserParticipations(ctx, AnonymizedUserID); err != nil || count != 0 {
+				t.Errorf("AnonymizeUserParticipations(AnonymizedUserID) = (%d, %v), want 0", count, err)
+			}
+		})
+	}
+}
+
+func TestGetTimeToFill(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			draws := []LotteryDraw{
+				{Name: "capped", StartTime: now - 100, EndTime: now + 100, MaxParticipants: 2, Status: domain.LotteryStatusActive},
+				{Name: "uncapped", StartTime: now - 100, EndTime: now + 100, Status: domain.LotteryStatusActive},
+			}
+			for _, draw := range draws {
+				if err := d.CreateLotteryDraw(ctx, draw); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", draw.Name, err)
+				}
+			}
+
+			activityID := 1
+			join := func(id string, userID int64, at int64) {
+				t.Helper()
+				if err := d.AddParticipant(ctx, Participant{ID: id, LotteryID: &activityID, UserID: userID, ParticipatedAt: at}); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", id, err)
+				}
+			}
+
+			join("a", 1, now-90)
+			if seconds, filled, err := d.GetTimeToFill(ctx, activityID); err != nil || filled || seconds != 200 {
+				t.Errorf("GetTimeToFill before full = (%d, %v, %v), want (200, false)", seconds, filled, err)
+			}
+
+			join("b", 2, now-50)
+			if seconds, filled, err := d.GetTimeToFill(ctx, activityID); err != nil || !filled || seconds != 50 {
+				t.Errorf("GetTimeToFill = (%d, %v, %v), want (50, true)", seconds, filled, err)
+			}
+
+			// 已退出的参与记录不计入，满员时间推迟到下一名参与者
+			if err := d.WithdrawParticipation(ctx, "b"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+			join("c", 3, now-20)
+			if seconds, filled, err := d.GetTimeToFill(ctx, activityID); err != nil || !filled || seconds != 80 {
+				t.Errorf("GetTimeToFill after withdrawal = (%d, %v, %v), want (80, true)", seconds, filled, err)
+			}
+
+			if _, _, err := d.GetTimeToFill(ctx, 2); !errors.Is(err, ErrNoParticipantCap) {
+				t.Errorf("GetTimeToFill(uncapped) err = %v, want ErrNoParticipantCap", err)
+			}
+			if _, _, err := d.GetTimeToFill(ctx, 99); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("GetTimeToFill(missing) err = %v, want ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFindOversoldEvents(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for i, e := range []struct{ stock, sold int }{{5, 5}, {2, 3}, {1, 4}, {3, 4}, {4, 0}} {
+				event := SecondKillEvent{Name: fmt.Sprintf("event%d", i+1), StartTime: 1, EndTime: 2, Status: domain.SecondKillStatusActive, Stock: e.stock, SoldCount: e.sold}
+				if err := d.CreateSecondKillEvent(ctx, event); err != nil {
+					t.Fatalf("CreateSecondKillEvent(%d): %v", i+1, err)
+				}
+			}
+
+			events, err := d.FindOversoldEvents(ctx)
+			if err != nil {
+				t.Fatalf("FindOversoldEvents: %v", err)
+			}
+			// 超卖数量降序，相同时按ID升序
+			var got []string
+			for _, e := range events {
+				got = append(got, fmt.Sprintf("%d:%d", e.ID, e.OversoldBy))
+			}
+			if want := []string{"3:3", "2:1", "4:1"}; !equalStrings(got, want) {
+				t.Errorf("FindOversoldEvents = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetUserWinRate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for name, newDAO := range lotteryDrawDAOFactories {
+		t.Run(name, func(t *testing.T) {
+			d := newDAO(t)
+
+			for _, name := range []string{"won", "lost"} {
+				if err := d.CreateLotteryDraw(ctx, LotteryDraw{Name: name, StartTime: now - 60, EndTime: now + 3600, Status: domain.LotteryStatusActive}); err != nil {
+					t.Fatalf("CreateLotteryDraw(%s): %v", name, err)
+				}
+			}
+			if err := d.CreateSecondKillEvent(ctx, SecondKillEvent{Name: "event", StartTime: now - 60, EndTime: now + 3600, Status: domain.SecondKillStatusActive, Stock: 1}); err != nil {
+				t.Fatalf("CreateSecondKillEvent: %v", err)
+			}
+
+			wonID, lostID := 1, 2
+			for _, p := range []Participant{
+				{ID: "a", LotteryID: &wonID, UserID: 1, ParticipatedAt: now},
+				{ID: "c", LotteryID: &wonID, UserID: 2, ParticipatedAt: now},
+				{ID: "b", LotteryID: &lostID, UserID: 1, ParticipatedAt: now},
+				{ID: "w", LotteryID: &lostID, UserID: 1, ParticipatedAt: now},
+			} {
+				if err := d.AddParticipant(ctx, p); err != nil {
+					t.Fatalf("AddParticipant(%s): %v", p.ID, err)
+				}
+			}
+			if err := d.WithdrawParticipation(ctx, "w"); err != nil {
+				t.Fatalf("WithdrawParticipation: %v", err)
+			}
+			if _, err := d.MarkWinners(ctx, wonID, []int64{1}); err != nil {
+				t.Fatalf("MarkWinners: %v", err)
+			}
+			if _, err := d.ClaimSecondKill(ctx, 1, 1, now); err != nil {
+				t.Fatalf("ClaimSecondKill: %v", err)
+			}
+
+			// 秒杀抢购计入参与次数，已退出的记录不计入
+			if wins, entries, err := d.GetUserWinRate(ctx, 1); err != nil || wins != 1 || entries != 3 {
+				t.Errorf("GetUserWinRate(1) = (%d, %d, %v), want (1, 3)", wins, entries, err)
+			}
+			if wins, entries, err := d.GetUserWinRate(ctx, 2); err != nil || wins != 0 || entries != 1 {
+				t.Errorf("GetUserWinRate(2) = (%d, %d, %v), want (0, 1)", wins, entries, err)
+			}
+			if wins, entries, err := d.GetUserWinRate(ctx, 9); err != nil || wins != 0 || entries != 0 {
+				t.Errorf("GetUserWinRate(9) = (%d, %d, %v), want (0, 0)", wins, entries, err)
+			}
+		})
+	}
+}
+
+func TestMigrateParticipantExternalRefSkipsWhenMigrated(t *testing.T) {
+	open := func(t *testing.T) *gorm.DB {
+		t.Helper()
+		db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatalf("get sql.DB: %v", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+		t.Cleanup(func() { _ = sqlDB.Close() })
+		return db
+	}
+	externalRef := func(t *testing.T, db *gorm.DB) sql.NullString {
+		t.Helper()
+		var ref sql.NullString
+		if err := db.Raw("SELECT external_ref FROM participants WHERE id = ?", "a").Scan(&ref).Error; err != nil {
+			t.Fatalf("select external_ref: %v", err)
+		}
+		return ref
+	}
+
+	// 唯一索引创建前的历史表：空字符串需要置为 NULL
+	legacy := open(t)
+	if err := legacy.Exec("CREATE TABLE participants (id varchar(64) PRIMARY KEY, external_ref varchar(64))").Error; err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	if err := legacy.Exec("INSERT INTO participants (id, external_ref) VALUES (?, ?)", "a", "").Error; err != nil {
+		t.Fatalf("insert legacy row: %v", err)
+	}
+	if err := migrateParticipantExternalRef(legacy); err != nil {
+		t.Fatalf("migrateParticipantExternalRef(legacy): %v", err)
+	}
+	if ref := externalRef(t, legacy); ref.Valid {
+		t.Errorf("legacy external_ref = %q, want NULL", ref.String)
+	}
+
+	// 唯一索引已存在时迁移已完成，不再更新数据
+	migrated := open(t)
+	if err := migrated.AutoMigrate(&Participant{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	empty := ""
+	if err := migrated.Create(&Participant{ID: "a", UserID: 1, ParticipatedAt: 1, ExternalRef: &empty}).Error; err != nil {
+		t.Fatalf("insert row: %v", err)
+	}
+	if err := migrateParticipantExternalRef(migrated); err != nil {
+		t.Fatalf("migrateParticipantExternalRef(migrated): %v", err)
+	}
+	if ref := externalRef(t, migrated); !ref.Valid || ref.String != "" {
+		t.Errorf("migrated external_ref = %+v, want untouched empty string", ref)
+	}
+}
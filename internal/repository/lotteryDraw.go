@@ -25,6 +25,7 @@ type LotteryDrawRepository interface {
 	ExistsSecondKillEventByName(ctx context.Context, name string) (bool, error)
 	HasUserParticipatedInSecondKill(ctx context.Context, id int, userID int64) (bool, error)
 	AddSecondKillParticipant(ctx context.Context, dp domain.Participant) error
+	ListUserSecondKillClaims(ctx context.Context, userID int64, pagination domain.Pagination) ([]domain.Participant, error)
 
 	// 活动状态管理方法
 	ListPendingLotteryDraws(ctx context.Context, currentTime int64) ([]domain.LotteryDraw, error)
@@ -188,6 +189,17 @@ func (r *lotteryDrawRepository) AddSecondKillParticipant(ctx context.Context, dp
 	return nil
 }
 
+// ListUserSecondKillClaims 获取用户成功抢购的秒杀记录，按抢购时间倒序排列
+func (r *lotteryDrawRepository) ListUserSecondKillClaims(ctx context.Context, userID int64, pagination domain.Pagination) ([]domain.Participant, error) {
+	claims, err := r.dao.ListUserSecondKillClaims(ctx, userID, pagination)
+	if err != nil {
+		r.logger.Error("获取用户秒杀记录失败", zap.Error(err), zap.Int64("UserID", userID))
+		return nil, err
+	}
+
+	return convertToDomainParticipants(claims), nil
+}
+
 // ListPendingLotteryDraws 获取所有待激活的抽奖活动
 func (r *lotteryDrawRepository) ListPendingLotteryDraws(ctx context.Context, currentTime int64) ([]domain.LotteryDraw, error) {
 	lotteryDraws, err := r.dao.ListPendingLotteryDraws(ctx, currentTime)
@@ -259,27 +271,42 @@ func (r *lotteryDrawRepository) ListActiveSecondKillEvents(ctx context.Context,
 // convertToDAOLotteryDraw 将 domain.LotteryDraw 转换为 dao.LotteryDraw
 func convertToDAOLotteryDraw(d domain.LotteryDraw) dao.LotteryDraw {
 	return dao.LotteryDraw{
-		ID:           d.ID,
-		Name:         d.Name,
-		Description:  d.Description,
-		StartTime:    d.StartTime,
-		EndTime:      d.EndTime,
-		Status:       d.Status,
-		Participants: convertToDAOParticipants(d.Participants),
+		ID:             d.ID,
+		Name:           d.Name,
+		Description:    d.Description,
+		ImageURL:       d.ImageURL,
+		StartTime:      d.StartTime,
+		EndTime:        d.EndTime,
+		EntryStartTime: d.EntryStartTime,
+		EntryEndTime:   d.EntryEndTime,
+		Status:         d.Status,
+		Category:       d.Category,
+		Participants:   convertToDAOParticipants(d.Participants),
 	}
 }
 
-// convertToDomainLotteryDraw 将 dao.LotteryDraw 转换为 domain.LotteryDraw
+// convertToDomainLotteryDraw 将 dao.LotteryDraw 转换为 domain.LotteryDraw，开奖种子仅在开奖后返回
 func convertToDomainLotteryDraw(d dao.LotteryDraw) domain.LotteryDraw {
-	return domain.LotteryDraw{
-		ID:           d.ID,
-		Name:         d.Name,
-		Description:  d.Description,
-		StartTime:    d.StartTime,
-		EndTime:      d.EndTime,
-		Status:       d.Status,
-		Participants: convertToDomainParticipants(d.Participants),
+	draw := domain.LotteryDraw{
+		ID:             d.ID,
+		Name:           d.Name,
+		Description:    d.Description,
+		ImageURL:       d.ImageURL,
+		StartTime:      d.StartTime,
+		EndTime:        d.EndTime,
+		EntryStartTime: d.EntryStartTime,
+		EntryEndTime:   d.EntryEndTime,
+		SeedHash:       d.SeedHash,
+		Status:         d.Status,
+		Category:       d.Category,
+		Participants:   convertToDomainParticipants(d.Participants),
+	}
+
+	if d.DrawnAt > 0 {
+		draw.Seed = d.Seed
 	}
+
+	return draw
 }
 
 // convertToDomainLotteryDraws 将 dao.LotteryDraw 列表转换为 domain.LotteryDraw 列表
@@ -299,9 +326,11 @@ func convertToDAOSecondKillEvent(e domain.SecondKillEvent) dao.SecondKillEvent {
 		ID:           e.ID,
 		Name:         e.Name,
 		Description:  e.Description,
+		ImageURL:     e.ImageURL,
 		StartTime:    e.StartTime,
 		EndTime:      e.EndTime,
 		Status:       e.Status,
+		Category:     e.Category,
 		Participants: convertToDAOParticipants(e.Participants),
 	}
 }
@@ -312,9 +341,11 @@ func convertToDomainSecondKillEvent(e dao.SecondKillEvent) domain.SecondKillEven
 		ID:           e.ID,
 		Name:         e.Name,
 		Description:  e.Description,
+		ImageURL:     e.ImageURL,
 		StartTime:    e.StartTime,
 		EndTime:      e.EndTime,
 		Status:       e.Status,
+		Category:     e.Category,
 		Participants: convertToDomainParticipants(e.Participants),
 	}
 }
@@ -338,9 +369,19 @@ func convertToDAOParticipant(p domain.Participant) dao.Participant {
 		SecondKillID:   p.SecondKillID,
 		UserID:         p.UserID,
 		ParticipatedAt: p.ParticipatedAt,
+		ExternalRef:    externalRefPtr(p.ExternalRef),
 	}
 }
 
+// externalRefPtr 将领域层的外部参与编号转换为数据库的可空字段，空字符串表示没有外部参与编号
+func externalRefPtr(ref string) *string {
+	if ref == "" {
+		return nil
+	}
+
+	return &ref
+}
+
 // convertToDAOParticipants 将 domain.Participant 列表转换为 dao.Participant 列表
 func convertToDAOParticipants(domainParticipants []domain.Participant) []dao.Participant {
 	if len(domainParticipants) == 0 {
@@ -357,13 +398,19 @@ func convertToDAOParticipants(domainParticipants []domain.Participant) []dao.Par
 
 // convertToDomainParticipant 将 dao.Participant 转换为 domain.Participant
 func convertToDomainParticipant(p dao.Participant) domain.Participant {
-	return domain.Participant{
+	participant := domain.Participant{
 		ID:             p.ID,
 		LotteryID:      p.LotteryID,
 		SecondKillID:   p.SecondKillID,
 		UserID:         p.UserID,
 		ParticipatedAt: p.ParticipatedAt,
 	}
+
+	if p.ExternalRef != nil {
+		participant.ExternalRef = *p.ExternalRef
+	}
+
+	return participant
 }
 
 // convertToDomainParticipants 将 dao.Participant 列表转换为 domain.Participant 列表
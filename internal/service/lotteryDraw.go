@@ -485,11 +485,14 @@ func (s *lotteryDrawService) CreateLotteryDraw(ctx context.Context, input domain
 
 	// 创建抽奖活动
 	lotteryDraw := domain.LotteryDraw{
-		Name:        input.Name,
-		Description: input.Description,
-		StartTime:   input.StartTime,
-		EndTime:     input.EndTime,
-		Status:      status,
+		Name:           input.Name,
+		Description:    input.Description,
+		ImageURL:       input.ImageURL,
+		StartTime:      input.StartTime,
+		EndTime:        input.EndTime,
+		EntryStartTime: input.EntryStartTime,
+		EntryEndTime:   input.EntryEndTime,
+		Status:         status,
 	}
 
 	if err := s.repo.CreateLotteryDraw(ctx, lotteryDraw); err != nil {
@@ -563,6 +566,7 @@ func (s *lotteryDrawService) CreateSecondKillEvent(ctx context.Context, input do
 	secondKillEvent := domain.SecondKillEvent{
 		Name:        input.Name,
 		Description: input.Description,
+		ImageURL:    input.ImageURL,
 		StartTime:   input.StartTime,
 		EndTime:     input.EndTime,
 		Status:      status,
@@ -608,6 +612,9 @@ func validateLotteryDrawInput(input domain.LotteryDraw) error {
 	if input.StartTime >= input.EndTime {
 		return errors.New("无效的抽奖活动时间范围")
 	}
+	if input.EntryStartTime != 0 && input.EntryEndTime != 0 && input.EntryStartTime >= input.EntryEndTime {
+		return errors.New("无效的抽奖活动报名时间范围")
+	}
 	return nil
 }
 